@@ -3,102 +3,65 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/tasiov/golulo/cmd/golulo/internal"
 )
 
-// AccountSettings represents user account settings
-type AccountSettings struct {
-	Owner            string  `json:"owner"`
-	AllowedProtocols string  `json:"allowedProtocols"`
-	Homebase         *string `json:"homebase"`
-	MinimumRate      float64 `json:"minimumRate"` // number
-}
-
-// AccountResponse represents the response from the account API
-type AccountResponse struct {
-	Data struct {
-		TotalValue     float64         `json:"totalValue"`
-		InterestEarned float64         `json:"interestEarned"`
-		RealtimeAPY    float64         `json:"realtimeAPY"`
-		Settings       AccountSettings `json:"settings"`
-	} `json:"data"`
-}
-
 var accountCmd = &cobra.Command{
-	Use:   "account",
+	Use:   "account [wallet|profile]",
 	Short: "Get account information",
+	Long: `Shows the Lulo account of the configured keypair's wallet, or of the given
+wallet address or profile name. A wallet address needs no keypair.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Create Solana client to get wallet pubkey
-		client, err := internal.NewSolanaClient()
-		if err != nil {
-			return fmt.Errorf("failed to create client: %w", err)
+		var wallet solana.PublicKey
+		if len(args) == 1 {
+			_, resolved, err := internal.ResolveWallet(args[0])
+			if err != nil {
+				return err
+			}
+			wallet = resolved
+		} else {
+			// Create Solana client to get wallet pubkey
+			client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+			if err != nil {
+				return fmt.Errorf("failed to create client: %w", err)
+			}
+			wallet = client.WalletPubKey()
 		}
 
-		log.WithField("wallet", client.WalletPubKey().String()).
-			Info("Fetching account information")
+		log := commandLogger(cmd).WithField("wallet", wallet.String())
+		log.Info("Fetching account information")
 
-		// Create HTTP request
-		url := "https://api.flexlend.fi/account"
-		req, err := http.NewRequest("GET", url, nil)
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
 		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
+			return err
 		}
 
-		log.WithField("url", url).Debug("Making API request")
-
-		// Set headers
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("x-wallet-pubkey", client.WalletPubKey().String())
-
-		apiKey := viper.GetString("lulo-api-key")
-		if apiKey == "" {
-			return fmt.Errorf("FLEXLEND_API_KEY environment variable not set")
-		}
-		req.Header.Set("x-api-key", apiKey)
-
-		// Make the request
-		httpClient := &http.Client{}
-		resp, err := httpClient.Do(req)
+		account, err := luloClient.GetAccount(cmd.Context(), wallet)
 		if err != nil {
-			log.WithError(err).Error("Failed to make request")
-			return fmt.Errorf("failed to make request: %w", err)
-		}
-		defer resp.Body.Close()
-
-		// Check status code
-		if resp.StatusCode != http.StatusOK {
-			log.WithField("statusCode", resp.StatusCode).Error("Unexpected status code")
-			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		}
-
-		// Parse response
-		var response AccountResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			log.WithError(err).Error("Failed to decode response")
-			return fmt.Errorf("failed to decode response: %w", err)
+			return err
 		}
 
 		// Log account information
-		log.WithFields(log.Fields{
-			"totalValue":     response.Data.TotalValue,
-			"interestEarned": response.Data.InterestEarned,
-			"realtimeAPY":    response.Data.RealtimeAPY,
+		log.WithFields(logrus.Fields{
+			"totalValue":     account.TotalValue,
+			"interestEarned": account.InterestEarned,
+			"realtimeAPY":    account.RealtimeAPY,
 		}).Info("Account overview")
 
-		log.WithFields(log.Fields{
-			"owner":            response.Data.Settings.Owner,
-			"allowedProtocols": response.Data.Settings.AllowedProtocols,
-			"homebase":         response.Data.Settings.Homebase,
-			"minimumRate":      response.Data.Settings.MinimumRate,
+		log.WithFields(logrus.Fields{
+			"owner":            account.Settings.Owner,
+			"allowedProtocols": account.Settings.AllowedProtocols,
+			"homebase":         account.Settings.Homebase,
+			"minimumRate":      account.Settings.MinimumRate,
 		}).Debug("Account settings")
 
 		// Pretty print the response
-		prettyJSON, err := json.MarshalIndent(response.Data, "", "  ")
+		prettyJSON, err := json.MarshalIndent(account, "", "  ")
 		if err != nil {
 			return fmt.Errorf("failed to format response: %w", err)
 		}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var alertOnce bool
+
+var alertCmd = &cobra.Command{
+	Use:   "alert",
+	Short: "Evaluate alert rules and send notifications",
+}
+
+var alertRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Periodically evaluate the alert rules from the config file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, notifiers, err := loadAlertConfig()
+		if err != nil {
+			return err
+		}
+		if len(cfg.Rules) == 0 {
+			return fmt.Errorf("no alert rules configured under alerts.rules")
+		}
+
+		// Create Solana client to get wallet pubkey
+		client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		state, err := internal.LoadAlertState(cfg.StateFile, client.WalletPubKey())
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		commandLogger(cmd).WithFields(logrus.Fields{
+			"rules":     len(cfg.Rules),
+			"notifiers": len(notifiers),
+			"interval":  cfg.Interval,
+		}).Info("Starting alert loop")
+
+		for {
+			if err := evaluateAlertsOnce(ctx, cfg, notifiers, luloClient, client, state); err != nil {
+				if alertOnce {
+					return err
+				}
+				commandLogger(cmd).WithError(err).Warn("Alert evaluation failed")
+			}
+			if alertOnce {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(cfg.Interval):
+			}
+		}
+	},
+}
+
+var alertTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Send a test notification to every configured notifier",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, notifiers, err := loadAlertConfig()
+		if err != nil {
+			return err
+		}
+
+		alert := internal.Alert{Rule: "test", Message: "golulo test notification", Time: time.Now()}
+		for i, notifier := range notifiers {
+			if err := notifier.Notify(cmd.Context(), alert); err != nil {
+				return fmt.Errorf("notifier %d: %w", i, err)
+			}
+		}
+		fmt.Printf("Sent test notification to %d notifier(s)\n", len(notifiers))
+		return nil
+	},
+}
+
+// loadAlertConfig reads and validates the alerts section of the config
+func loadAlertConfig() (*internal.AlertConfig, []internal.Notifier, error) {
+	var cfg internal.AlertConfig
+	if err := viper.UnmarshalKey("alerts", &cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse alerts config: %w", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+
+	for _, rule := range cfg.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	notifiers := make([]internal.Notifier, 0, len(cfg.Notifiers))
+	for _, notifierCfg := range cfg.Notifiers {
+		notifier, err := internal.NewNotifier(notifierCfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if len(notifiers) == 0 {
+		return nil, nil, fmt.Errorf("no notifiers configured under alerts.notifiers")
+	}
+	return &cfg, notifiers, nil
+}
+
+// evaluateAlertsOnce fetches fresh data, evaluates the rules and sends notifications.
+// Only alerts some notifier delivered are recorded, the others are retried on
+// the next evaluation. State is saved after notifying so a crash never drops an alert.
+func evaluateAlertsOnce(ctx context.Context, cfg *internal.AlertConfig, notifiers []internal.Notifier, luloClient *internal.LuloClient, client *internal.SolanaClient, state *internal.AlertState) error {
+	account, err := luloClient.GetAccount(ctx, client.WalletPubKey())
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	rates, err := luloClient.GetRates(ctx)
+	if err != nil {
+		internal.LoggerFrom(ctx).WithError(err).Warn("Failed to get rates, skipping rate based rules")
+		rates = nil
+	}
+
+	alerts := internal.EvaluateAlerts(cfg.Rules, account, rates, state, time.Now(), cfg.NotifyResolved)
+	for _, alert := range alerts {
+		internal.LoggerFrom(ctx).WithFields(logrus.Fields{
+			"rule":     alert.Rule,
+			"resolved": alert.Resolved,
+		}).Info(alert.Message)
+
+		if err := internal.NotifyAll(ctx, notifiers, alert); err != nil {
+			internal.LoggerFrom(ctx).WithField("rule", alert.Rule).Warn("No notifier delivered the alert, retrying on the next evaluation")
+			continue
+		}
+		state.MarkDelivered(alert)
+	}
+
+	return state.Save()
+}
+
+func init() {
+	rootCmd.AddCommand(alertCmd)
+	alertCmd.AddCommand(alertRunCmd)
+	alertCmd.AddCommand(alertTestCmd)
+	alertRunCmd.Flags().BoolVar(&alertOnce, "once", false, "Evaluate the rules once and exit")
+}
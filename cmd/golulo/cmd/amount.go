@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+// parseAmount parses an --amount value, either a token amount ("12.5") or a
+// percentage ("50%"), returning the decimal without the percent sign
+func parseAmount(s string) (value string, percent bool, err error) {
+	value = strings.TrimSpace(s)
+	if strings.HasSuffix(value, "%") {
+		percent = true
+		value = strings.TrimSuffix(value, "%")
+	}
+
+	// Validate exactly rather than in base units, so neither large nor tiny
+	// amounts are rejected before the token's decimals are known
+	amount, err := internal.ParseDecimal(value)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid amount %q", s)
+	}
+	if amount.Sign() == 0 {
+		return "", false, fmt.Errorf("amount must be greater than zero")
+	}
+	if percent && amount.Cmp(big.NewRat(100, 1)) > 0 {
+		return "", false, fmt.Errorf("percentage must not exceed 100%%")
+	}
+	return value, percent, nil
+}
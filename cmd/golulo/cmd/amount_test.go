@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		amount  string
+		value   string
+		percent bool
+		wantErr string
+	}{
+		{amount: "12.5", value: "12.5"},
+		{amount: " 100 ", value: "100"},
+		{amount: "500", value: "500"},
+		{amount: "1000000000000", value: "1000000000000"},
+		{amount: "184467440737095516150", value: "184467440737095516150"},
+		{amount: "0.000000000000000000001", value: "0.000000000000000000001"},
+		{amount: "10%", value: "10", percent: true},
+		{amount: "50%", value: "50", percent: true},
+		{amount: "100%", value: "100", percent: true},
+		{amount: "100.0000%", value: "100.0000", percent: true},
+		{amount: "0.5%", value: "0.5", percent: true},
+		{amount: "100.0001%", wantErr: "must not exceed 100%"},
+		{amount: "150%", wantErr: "must not exceed 100%"},
+		{amount: "0", wantErr: "greater than zero"},
+		{amount: "0.000", wantErr: "greater than zero"},
+		{amount: "0%", wantErr: "greater than zero"},
+		{amount: "", wantErr: "invalid amount"},
+		{amount: "%", wantErr: "invalid amount"},
+		{amount: "-1", wantErr: "invalid amount"},
+		{amount: "1e6", wantErr: "invalid amount"},
+		{amount: "ten", wantErr: "invalid amount"},
+	}
+	for _, tt := range tests {
+		value, percent, err := parseAmount(tt.amount)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseAmount(%q) error = %v, want %q", tt.amount, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || value != tt.value || percent != tt.percent {
+			t.Errorf("parseAmount(%q) = %q, %v, %v; want %q, %v", tt.amount, value, percent, err, tt.value, tt.percent)
+		}
+	}
+}
+
+func TestResolveFixedAmounts(t *testing.T) {
+	const usdc = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	tests := map[string]string{
+		"100":        "100",
+		"500":        "500",
+		"12.3456789": "12.345678",
+	}
+	for amount, want := range tests {
+		// Fixed amounts are resolved without looking up any balance
+		if got, err := resolveDepositAmount(context.Background(), nil, usdc, amount, false, ""); err != nil || got != want {
+			t.Errorf("resolveDepositAmount(%q) = %q, %v; want %q", amount, got, err, want)
+		}
+		if got, err := resolveWithdrawAmount(context.Background(), nil, usdc, amount, false); err != nil || got != want {
+			t.Errorf("resolveWithdrawAmount(%q) = %q, %v; want %q", amount, got, err, want)
+		}
+	}
+}
+
+func TestDepositKeepValidation(t *testing.T) {
+	t.Cleanup(func() { depositMax, keepAmount = false, "" })
+	depositMax = true
+	for keep, valid := range map[string]bool{"100": true, "2.5": true, "1000000": true, "lots": false} {
+		keepAmount = keep
+		depositCmd.Flags().Set("keep", keep)
+		err := depositCmd.PreRunE(depositCmd, nil)
+		if valid != (err == nil) {
+			t.Errorf("--keep %s: error = %v", keep, err)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	autopilotOnce   bool
+	autopilotDryRun bool
+)
+
+var autopilotCmd = &cobra.Command{
+	Use:   "autopilot",
+	Short: "Automatically deposit idle funds, keep a liquid buffer and follow the best pool",
+	Long: `Periodically applies the strategy from the autopilot section of the config file.
+
+Every tick, for each configured token, autopilot deposits the wallet balance
+above deposit-above, withdraws to keep min-liquid in the wallet, and moves
+funds to the pool with the best rate once it leads by min-spread. Amounts are
+limited by daily-cap per UTC day.
+
+Create the kill switch file to pause autopilot without stopping it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadAutopilotConfig()
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("dry-run") {
+			cfg.DryRun = autopilotDryRun
+		}
+
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		state, err := internal.LoadAutopilotState(cfg.StateFile, client.WalletPubKey())
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		commandLogger(cmd).WithFields(logrus.Fields{
+			"tokens":     len(cfg.Tokens),
+			"interval":   cfg.Interval,
+			"dryRun":     cfg.DryRun,
+			"killSwitch": cfg.KillSwitch,
+		}).Info("Starting autopilot")
+
+		for {
+			if err := runAutopilotOnce(ctx, cfg, client, luloClient, state); err != nil {
+				if autopilotOnce {
+					return err
+				}
+				commandLogger(cmd).WithError(err).Warn("Autopilot tick failed")
+			}
+			if autopilotOnce {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(cfg.Interval):
+			}
+		}
+	},
+}
+
+// loadAutopilotConfig reads and validates the autopilot section of the config
+func loadAutopilotConfig() (*internal.AutopilotConfig, error) {
+	var cfg internal.AutopilotConfig
+	if err := viper.UnmarshalKey("autopilot", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse autopilot config: %w", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Minute
+	}
+	if cfg.KillSwitch == "" {
+		path, err := internal.DefaultKillSwitch()
+		if err != nil {
+			return nil, err
+		}
+		cfg.KillSwitch = path
+	}
+	if len(cfg.Tokens) == 0 {
+		return nil, fmt.Errorf("no tokens configured under autopilot.tokens")
+	}
+
+	for _, token := range cfg.Tokens {
+		if token.Token == "" {
+			return nil, fmt.Errorf("autopilot token without a token")
+		}
+		if token.DepositAbove < 0 || token.MinLiquid < 0 || token.DailyCap < 0 || token.MinSpread < 0 || token.Hysteresis < 0 {
+			return nil, fmt.Errorf("autopilot token %s: thresholds must not be negative", token.Token)
+		}
+	}
+	return &cfg, nil
+}
+
+// runAutopilotOnce plans and executes one tick. Decisions only change state
+// once executed, and state is saved after every executed action so a crash
+// never loses track of the daily cap. Dry runs leave the state untouched.
+func runAutopilotOnce(ctx context.Context, cfg *internal.AutopilotConfig, client *internal.SolanaClient, luloClient *internal.LuloClient, state *internal.AutopilotState) error {
+	if _, err := os.Stat(cfg.KillSwitch); err == nil {
+		internal.LoggerFrom(ctx).WithField("killSwitch", cfg.KillSwitch).Warn("Kill switch present, skipping tick")
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check kill switch: %w", err)
+	}
+
+	account, err := luloClient.GetAccount(ctx, client.WalletPubKey())
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	rates, err := luloClient.GetRates(ctx)
+	if err != nil {
+		internal.LoggerFrom(ctx).WithError(err).Warn("Failed to get rates, keeping current pools")
+		rates = nil
+	}
+
+	for _, token := range cfg.Tokens {
+		mint := internal.ResolveMint(token.Token)
+		balance, err := client.GetSpendableBalance(ctx, mint)
+		if err != nil {
+			return fmt.Errorf("failed to get %s balance: %w", token.Token, err)
+		}
+
+		decisions := internal.PlanAutopilot(token, balance.UIAmount(), account, rates, state, time.Now())
+		for _, decision := range decisions {
+			if err := executeDecision(ctx, cfg, client, luloClient, state, decision); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.DryRun {
+		return nil
+	}
+	return state.Save()
+}
+
+// executeDecision logs a decision and, unless in dry-run mode, sends its transactions
+func executeDecision(ctx context.Context, cfg *internal.AutopilotConfig, client *internal.SolanaClient, luloClient *internal.LuloClient, state *internal.AutopilotState, decision internal.AutopilotDecision) error {
+	log := internal.LoggerFrom(ctx).WithFields(logrus.Fields{
+		"token":  decision.Token,
+		"action": decision.Action,
+		"amount": decision.Amount,
+		"pool":   decision.Pool,
+		"reason": decision.Reason,
+		"dryRun": cfg.DryRun,
+	})
+
+	if decision.Action == internal.AutopilotSwitchPool {
+		if cfg.DryRun {
+			log.Info("Autopilot decision (dry run)")
+			return nil
+		}
+		state.SwitchPool(decision.Mint, decision.Pool)
+		log.Info("Autopilot decision")
+		return nil
+	}
+	if decision.Action != internal.AutopilotDeposit && decision.Action != internal.AutopilotWithdraw {
+		log.Info("Autopilot decision")
+		return nil
+	}
+
+	amount, err := internal.FloorAmount(internal.FloatAmount(decision.Amount), internal.TokenDecimals(decision.Mint))
+	if err != nil {
+		return err
+	}
+	if amount == "0" {
+		log.Info("Autopilot decision below token precision, skipping")
+		return nil
+	}
+	if cfg.DryRun {
+		log.Info("Autopilot decision (dry run)")
+		return nil
+	}
+
+	var sigs []solana.Signature
+	if decision.Action == internal.AutopilotDeposit {
+		sigs, err = internal.Deposit(ctx, client, luloClient, decision.Mint, amount, decision.Pool)
+	} else {
+		sigs, err = internal.Withdraw(ctx, client, luloClient, decision.Mint, amount, false, decision.Pool)
+	}
+	if len(sigs) > 0 {
+		// Count anything that was sent against the cap, even if a later transaction failed
+		state.RecordMove(decision.Mint, decision.Amount, time.Now())
+		if saveErr := state.Save(); saveErr != nil {
+			log.WithError(saveErr).Error("Failed to save autopilot state")
+		}
+	}
+	if err != nil {
+		log.WithError(err).WithField("signatures", sigs).Error("Autopilot action failed")
+		return fmt.Errorf("failed to %s %s: %w", decision.Action, decision.Token, err)
+	}
+
+	log.WithField("signatures", sigs).Info("Autopilot decision executed")
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(autopilotCmd)
+	autopilotCmd.Flags().BoolVar(&autopilotOnce, "once", false, "Run a single tick and exit")
+	autopilotCmd.Flags().BoolVar(&autopilotDryRun, "dry-run", false, "Log decisions without sending transactions (overrides autopilot.dry-run)")
+}
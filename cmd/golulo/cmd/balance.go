@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	balanceToken string
+	showDeposits bool
+)
+
+var balanceCmd = &cobra.Command{
+	Use:   "balance",
+	Short: "Show wallet token balances",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create Solana client
+		client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		commandLogger(cmd).WithField("wallet", client.WalletPubKey().String()).
+			Info("Fetching wallet balances")
+
+		balances, err := client.GetBalances(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		// Filter by token if requested
+		if balanceToken != "" {
+			mint := internal.ResolveMint(balanceToken)
+			filtered := []internal.TokenBalance{}
+			for _, balance := range balances {
+				if balance.Mint == mint {
+					filtered = append(filtered, balance)
+				}
+			}
+			balances = filtered
+		}
+
+		// Look up deposited amounts if requested
+		deposited := map[string]float64{}
+		positionsKnown := true
+		if showDeposits {
+			luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+			if err != nil {
+				return err
+			}
+			account, err := luloClient.GetAccount(cmd.Context(), client.WalletPubKey())
+			if err != nil {
+				return fmt.Errorf("failed to get account: %w", err)
+			}
+			if !account.HasPositions() {
+				positionsKnown = false
+				commandLogger(cmd).Warn("The Lulo API did not return per-token positions, deposited amounts are unknown")
+			}
+			for _, position := range account.Positions {
+				deposited[position.MintAddress] += position.Amount
+			}
+		}
+		depositedAmount := func(mint string) string {
+			if !positionsKnown {
+				return "-"
+			}
+			return strconv.FormatFloat(deposited[mint], 'f', -1, 64)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if showDeposits {
+			fmt.Fprintln(w, "TOKEN\tWALLET\tDEPOSITED\tMINT")
+		} else {
+			fmt.Fprintln(w, "TOKEN\tWALLET\tMINT")
+		}
+		for _, balance := range balances {
+			amount := internal.FormatAmount(balance.Amount, balance.Decimals)
+			if showDeposits {
+				// Native SOL and wSOL share a mint, only show the deposit once
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", balance.Symbol, amount, depositedAmount(balance.Mint), balance.Mint)
+				delete(deposited, balance.Mint)
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", balance.Symbol, amount, balance.Mint)
+			}
+		}
+
+		// Tokens that are fully deposited have no wallet balance
+		leftover := make([]string, 0, len(deposited))
+		for mint := range deposited {
+			if balanceToken != "" && mint != internal.ResolveMint(balanceToken) {
+				continue
+			}
+			leftover = append(leftover, mint)
+		}
+		sort.Slice(leftover, func(i, j int) bool {
+			a, b := internal.TokenSymbol(leftover[i]), internal.TokenSymbol(leftover[j])
+			if a != b {
+				return a < b
+			}
+			return leftover[i] < leftover[j]
+		})
+		for _, mint := range leftover {
+			fmt.Fprintf(w, "%s\t0\t%s\t%s\n", internal.TokenSymbol(mint), depositedAmount(mint), mint)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(balanceCmd)
+	balanceCmd.Flags().StringVarP(&balanceToken, "token", "t", "", "Only show this token (symbol or mint address)")
+	balanceCmd.Flags().BoolVar(&showDeposits, "lulo", false, "Show amounts deposited in Lulo next to wallet balances")
+}
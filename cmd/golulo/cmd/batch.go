@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	batchStateFile    string
+	batchRetryPartial bool
+	batchStopOnError  bool
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Plan and apply deposits and withdrawals from a manifest file",
+}
+
+var batchPlanCmd = &cobra.Command{
+	Use:   "plan <plan.yaml>",
+	Short: "Show what applying a plan would do",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, state, err := loadBatch(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tWALLET\tACTION\tTOKEN\tAMOUNT\tPOOL\tSTATUS")
+		for _, op := range plan.Operations {
+			opState := state.Operations[op.ID]
+			wallet, amount := op.Wallet, op.Amount
+
+			// Resolve what would be sent for operations that still run
+			if state.Runnable(op.ID, batchRetryPartial) {
+				client, err := internal.NewReadOnlyClientFor(op.Wallet, commandLogger(cmd))
+				if err != nil {
+					return fmt.Errorf("operation %s: %w", op.ID, err)
+				}
+				wallet = client.WalletPubKey().String()
+				if resolved, err := resolveBatchAmount(ctx, client, op); err != nil {
+					amount = fmt.Sprintf("%s (%s)", op.Amount, err)
+				} else if resolved != op.Amount {
+					amount = fmt.Sprintf("%s (%s)", resolved, op.Amount)
+				}
+			} else if opState.Wallet != "" {
+				wallet, amount = opState.Wallet, opState.Amount
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				op.ID, wallet, op.Action, internal.TokenSymbol(internal.ResolveMint(op.Token)), amount, op.Pool, batchStatus(state, op.ID))
+		}
+		return w.Flush()
+	},
+}
+
+var batchApplyCmd = &cobra.Command{
+	Use:   "apply <plan.yaml>",
+	Short: "Apply a plan, resuming from its state file",
+	Long: `Executes the operations of a plan in order. The status of every operation
+is saved to the state file (default <plan>.state.json) as it runs, so applying
+the same plan again skips completed operations and retries failed ones.
+Operations that sent some transactions before failing are only retried with
+--retry-partial.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		plan, state, err := loadBatch(args[0])
+		if err != nil {
+			return err
+		}
+		if err := state.Save(); err != nil {
+			return err
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		clients := map[string]*internal.SolanaClient{}
+		for _, op := range plan.Operations {
+			log := commandLogger(cmd).WithFields(logrus.Fields{"operation": op.ID, "action": op.Action, "token": op.Token})
+			if !state.Runnable(op.ID, batchRetryPartial) {
+				log.WithField("status", state.Operations[op.ID].Status).Info("Skipping operation")
+				continue
+			}
+
+			if err := applyBatchOperation(ctx, luloClient, clients, state, op); err != nil {
+				log.WithError(err).Error("Operation failed")
+				if batchStopOnError {
+					break
+				}
+				continue
+			}
+			log.Info("Operation done")
+		}
+
+		return printBatchReport(plan, state)
+	},
+}
+
+// applyBatchOperation resolves and executes one operation, persisting its status
+func applyBatchOperation(ctx context.Context, luloClient *internal.LuloClient, clients map[string]*internal.SolanaClient, state *internal.BatchState, op internal.BatchOperation) error {
+	client, ok := clients[op.Wallet]
+	if !ok {
+		var err error
+		if client, err = internal.NewSolanaClientFor(op.Wallet, internal.LoggerFrom(ctx)); err != nil {
+			return failBatchOperation(state, op, err)
+		}
+		clients[op.Wallet] = client
+	}
+
+	amount, err := resolveBatchAmount(ctx, client, op)
+	if err != nil {
+		return failBatchOperation(state, op, err)
+	}
+
+	// Record that transactions may be in flight before anything is signed
+	err = state.Update(op.ID, internal.BatchSending, func(s *internal.BatchOperationState) {
+		s.Wallet = client.WalletPubKey().String()
+		s.Amount = amount
+		s.Signatures = nil
+		s.Error = ""
+	})
+	if err != nil {
+		return err
+	}
+
+	mint := internal.ResolveMint(op.Token)
+	var sigs []solana.Signature
+	if op.Action == internal.BatchDeposit {
+		sigs, err = internal.Deposit(ctx, client, luloClient, mint, amount, op.Pool)
+	} else {
+		all := strings.EqualFold(op.Amount, "all")
+		sigs, err = internal.Withdraw(ctx, client, luloClient, mint, amount, all, op.Pool)
+	}
+
+	status := internal.BatchDone
+	switch {
+	case err != nil && len(sigs) > 0:
+		status = internal.BatchPartial
+	case err != nil:
+		status = internal.BatchFailed
+	}
+	saveErr := state.Update(op.ID, status, func(s *internal.BatchOperationState) {
+		for _, sig := range sigs {
+			s.Signatures = append(s.Signatures, sig.String())
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return saveErr
+}
+
+// failBatchOperation records an error that happened before anything was sent
+func failBatchOperation(state *internal.BatchState, op internal.BatchOperation, err error) error {
+	if saveErr := state.Update(op.ID, internal.BatchFailed, func(s *internal.BatchOperationState) {
+		s.Error = err.Error()
+	}); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// resolveBatchAmount turns an operation amount into the amount sent to the API
+func resolveBatchAmount(ctx context.Context, client *internal.SolanaClient, op internal.BatchOperation) (string, error) {
+	mint := internal.ResolveMint(op.Token)
+	if op.Action == internal.BatchDeposit {
+		useMax := strings.EqualFold(op.Amount, "max")
+		return resolveDepositAmount(ctx, client, mint, op.Amount, useMax, "")
+	}
+	return resolveWithdrawAmount(ctx, client, mint, op.Amount, strings.EqualFold(op.Amount, "all"))
+}
+
+// printBatchReport prints the final status of every operation and fails if any did not complete
+func printBatchReport(plan *internal.BatchPlan, state *internal.BatchState) error {
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tACTION\tTOKEN\tAMOUNT\tSTATUS\tDETAILS")
+	for _, op := range plan.Operations {
+		opState := state.Operations[op.ID]
+		counts[opState.Status]++
+
+		details := strings.Join(opState.Signatures, ",")
+		if opState.Error != "" {
+			details = opState.Error
+		}
+		amount := opState.Amount
+		if amount == "" {
+			amount = op.Amount
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			op.ID, op.Action, internal.TokenSymbol(internal.ResolveMint(op.Token)), amount, opState.Status, details)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d done, %d failed, %d partial, %d pending\n",
+		counts[internal.BatchDone],
+		counts[internal.BatchFailed],
+		counts[internal.BatchPartial]+counts[internal.BatchSending],
+		counts[internal.BatchPending])
+	if incomplete := len(plan.Operations) - counts[internal.BatchDone]; incomplete > 0 {
+		return fmt.Errorf("%d of %d operations did not complete, see %s", incomplete, len(plan.Operations), state.Path())
+	}
+	return nil
+}
+
+// batchStatus describes the state of an operation for the plan output
+func batchStatus(state *internal.BatchState, id string) string {
+	opState := state.Operations[id]
+	if opState.Status == internal.BatchSending || opState.Status == internal.BatchPartial {
+		if batchRetryPartial {
+			return opState.Status + ", will retry"
+		}
+		return opState.Status + ", check signatures before --retry-partial"
+	}
+	return opState.Status
+}
+
+// loadBatch reads a plan and its state file
+func loadBatch(path string) (*internal.BatchPlan, *internal.BatchState, error) {
+	plan, err := internal.LoadBatchPlan(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	statePath := batchStateFile
+	if statePath == "" {
+		statePath = internal.DefaultBatchStatePath(path)
+	}
+	state, err := internal.LoadBatchState(statePath, plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, state, nil
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.AddCommand(batchPlanCmd)
+	batchCmd.AddCommand(batchApplyCmd)
+
+	batchCmd.PersistentFlags().StringVar(&batchStateFile, "state", "", "State file tracking applied operations (default <plan>.state.json)")
+	batchCmd.PersistentFlags().BoolVar(&batchRetryPartial, "retry-partial", false, "Retry operations that were interrupted or sent only some transactions")
+	batchApplyCmd.Flags().BoolVar(&batchStopOnError, "stop-on-error", false, "Stop at the first failed operation")
+}
@@ -1,24 +1,115 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	showSecrets bool
+	passphrase  string
 )
 
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage CLI configuration",
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `Shows the current configuration. Secrets are masked unless --show-secrets
+is given, which resolves env:, file:, cmd: and keyring: sources and prints the
+secret values.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rpcURL := viper.GetString("rpc-url")
+		if !showSecrets {
+			rpcURL = internal.RedactURL(rpcURL)
+		}
+
 		fmt.Printf("Current configuration:\n")
-		fmt.Printf("RPC URL: %s\n", viper.GetString("rpc-url"))
+		fmt.Printf("RPC URL: %s\n", rpcURL)
+		luloURL := viper.GetString("lulo-api-url")
+		if luloURL == "" {
+			luloURL = internal.DefaultLuloAPIURL
+		}
+		if !showSecrets {
+			luloURL = internal.RedactURL(luloURL)
+		}
+		fmt.Printf("Lulo API URL: %s\n", luloURL)
+		if version := viper.GetString("lulo-api-version"); version != "" {
+			fmt.Printf("Lulo API Version: %s\n", version)
+		}
 		if keypair := viper.GetString("keypair"); keypair != "" {
 			fmt.Printf("Keypair: %s\n", keypair)
 		}
-		fmt.Printf("RPC API Key: %s\n", viper.GetString("rpc-api-key"))
-		fmt.Printf("Lulo API Key: %s\n", viper.GetString("lulo-api-key"))
+		for _, secret := range []struct {
+			label, key string
+			optional   bool // only shown when set
+		}{
+			{"RPC API Key", "rpc-api-key", false},
+			{"Lulo API Key", "lulo-api-key", false},
+			{"Keypair Passphrase", "keypair-passphrase", true},
+			{"Serve Token", "serve-token", true},
+		} {
+			value, err := configSecretValue(secret.key)
+			if err != nil {
+				return err
+			}
+			if value != "" || !secret.optional {
+				fmt.Printf("%s: %s\n", secret.label, value)
+			}
+		}
 		fmt.Printf("Priority Fee: %s\n", viper.GetString("priority-fee"))
+		return nil
+	},
+}
+
+// configSecretValue returns a secret for display: masked, or resolved with --show-secrets
+func configSecretValue(key string) (string, error) {
+	if !showSecrets {
+		return internal.MaskSecret(viper.GetString(key)), nil
+	}
+	return internal.ConfigSecret(key)
+}
+
+var configEncryptKeypairCmd = &cobra.Command{
+	Use:   "encrypt-keypair <keypair.json> <encrypted.json>",
+	Short: "Encrypt a keypair file with a passphrase",
+	Long: `Writes an encrypted copy of a Solana CLI keypair file. The passphrase is
+taken from --passphrase, which accepts env:, file:, cmd: and keyring: sources,
+or from keypair-passphrase. Point keypair (or a profile's keypair) at the
+encrypted file and set keypair-passphrase (or the profile's passphrase) to use it.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		secret, err := internal.ConfigSecret("keypair-passphrase")
+		if passphrase != "" {
+			secret, err = internal.ResolveSecret(passphrase)
+		}
+		if err != nil {
+			return err
+		}
+		if secret == "" {
+			return fmt.Errorf("no passphrase: pass --passphrase or set keypair-passphrase")
+		}
+
+		privateKey, err := internal.LoadKeypair(args[0])
+		if err != nil {
+			return err
+		}
+		encrypted, err := internal.EncryptKeypair(privateKey, secret)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(encrypted, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode encrypted keypair: %w", err)
+		}
+		if err := os.WriteFile(args[1], data, 0o600); err != nil {
+			return fmt.Errorf("failed to write encrypted keypair: %w", err)
+		}
+		fmt.Printf("Encrypted keypair for %s written to %s\n", encrypted.PublicKey, args[1])
+		return nil
 	},
 }
 
@@ -43,4 +134,7 @@ var configSetCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configEncryptKeypairCmd)
+	configCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print secrets instead of masking them")
+	configEncryptKeypairCmd.Flags().StringVar(&passphrase, "passphrase", "", "Passphrase, or where to read it from (e.g. env:GOLULO_PASSPHRASE)")
 }
@@ -1,127 +1,124 @@
 package cmd
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/tasiov/golulo/cmd/golulo/internal"
 )
 
 var (
-	amount      float64
+	amountArg   string
 	mintAddress string
+	pool        string
+	depositMax  bool
+	keepAmount  string
 )
 
-// DepositRequest represents the request body for the deposit API
-type DepositRequest struct {
-	Owner         string `json:"owner"`
-	MintAddress   string `json:"mintAddress"`
-	DepositAmount string `json:"depositAmount"`
-}
-
-// TransactionMeta represents a single transaction in the response
-type TransactionMeta struct {
-	Transaction  string  `json:"transaction"`
-	Protocol     string  `json:"protocol"`
-	TotalDeposit float64 `json:"totalDeposit"`
-}
-
-// DepositResponse represents the response from the deposit API
-type DepositResponse struct {
-	Data struct {
-		TransactionMeta []TransactionMeta `json:"transactionMeta"`
-	} `json:"data"`
-}
-
 var depositCmd = &cobra.Command{
 	Use:   "deposit",
 	Short: "Deposit tokens into a Lulo reserve",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create Solana client
-		client, err := internal.NewSolanaClient()
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
 
-		// Create deposit request
-		request := DepositRequest{
-			Owner:         client.WalletPubKey().String(),
-			MintAddress:   mintAddress,
-			DepositAmount: fmt.Sprintf("%.0f", amount),
+		ctx := cmd.Context()
+		mint := internal.ResolveMint(mintAddress)
+		depositAmount, err := resolveDepositAmount(ctx, client, mint, amountArg, depositMax, keepAmount)
+		if err != nil {
+			return err
 		}
 
-		logrus.WithFields(logrus.Fields{
-			"owner":         request.Owner,
-			"mintAddress":   request.MintAddress,
-			"depositAmount": request.DepositAmount,
-		}).Info("Creating deposit request")
-
-		// Convert request to JSON
-		jsonData, err := json.Marshal(request)
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
 		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
+			return err
 		}
 
-		// Create HTTP request with priority fee
-		url := fmt.Sprintf("https://api.flexlend.fi/generate/account/deposit?priorityFee=%s", viper.GetString("priority-fee"))
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+		_, err = internal.Deposit(ctx, client, luloClient, mint, depositAmount, pool)
 		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
+			return err
 		}
 
-		logrus.WithField("url", url).Debug("Making API request")
-
-		// Set headers
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("x-wallet-pubkey", client.WalletPubKey().String())
-		req.Header.Set("x-api-key", viper.GetString("lulo-api-key"))
+		return nil
+	},
+}
 
-		// Make the request
-		httpClient := &http.Client{}
-		resp, err := httpClient.Do(req)
+// resolveDepositAmount turns an amount, or max minus keep, into the amount sent to the API
+func resolveDepositAmount(ctx context.Context, client *internal.SolanaClient, mint, amount string, useMax bool, keep string) (string, error) {
+	var value string
+	percent := false
+	if !useMax {
+		var err error
+		value, percent, err = parseAmount(amount)
 		if err != nil {
-			return fmt.Errorf("failed to make request: %w", err)
-		}
-		defer resp.Body.Close()
-
-		// Check status code
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			return "", err
 		}
-
-		// Parse response
-		var response DepositResponse
-		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-			return fmt.Errorf("failed to decode response: %w", err)
+		if !percent {
+			return internal.FloorAmount(value, internal.TokenDecimals(mint))
 		}
-
-		logrus.WithField("transactionCount", len(response.Data.TransactionMeta)).
-			Info("Received transactions from API")
-
-		b64_txs := []string{}
-		for _, tx := range response.Data.TransactionMeta {
-			b64_txs = append(b64_txs, tx.Transaction)
+	}
+
+	// --max and percentages are relative to the wallet balance
+	balance, err := client.GetSpendableBalance(ctx, mint)
+	if err != nil {
+		return "", err
+	}
+
+	var deposit uint64
+	if useMax {
+		kept := uint64(0)
+		if keep != "" {
+			if kept, err = internal.ToBaseUnits(keep, balance.Decimals); err != nil {
+				return "", fmt.Errorf("invalid --keep: %w", err)
+			}
 		}
-
-		err = client.HandleB64Transactions(b64_txs)
-		if err != nil {
-			return fmt.Errorf("failed to handle transactions: %w", err)
+		if balance.Amount > kept {
+			deposit = balance.Amount - kept
 		}
-
-		return nil
-	},
+	} else if deposit, err = internal.PercentOf(balance.Amount, value); err != nil {
+		return "", err
+	}
+
+	formatted := internal.FormatAmount(deposit, balance.Decimals)
+	internal.LoggerFrom(ctx).WithFields(logrus.Fields{
+		"available": internal.FormatAmount(balance.Amount, balance.Decimals),
+		"keep":      keep,
+		"deposit":   formatted,
+	}).Debug("Computed deposit amount from wallet balance")
+
+	if deposit == 0 {
+		return "", fmt.Errorf("nothing to deposit: wallet holds %s %s",
+			internal.FormatAmount(balance.Amount, balance.Decimals), balance.Symbol)
+	}
+	return formatted, nil
 }
 
 func init() {
 	rootCmd.AddCommand(depositCmd)
-	depositCmd.Flags().Float64VarP(&amount, "amount", "a", 0, "Amount to deposit")
-	depositCmd.Flags().StringVarP(&mintAddress, "mint", "m", "", "Mint address")
-	depositCmd.MarkFlagRequired("amount")
+	depositCmd.Flags().StringVarP(&amountArg, "amount", "a", "", "Amount to deposit, or a percentage of the wallet balance (e.g. 50%)")
+	depositCmd.Flags().StringVarP(&mintAddress, "mint", "m", "", "Mint address or token symbol")
+	depositCmd.Flags().StringVar(&pool, "pool", "", "Lulo pool to deposit into (e.g. regular, protected, boosted)")
+	depositCmd.Flags().BoolVar(&depositMax, "max", false, "Deposit the entire wallet balance")
+	depositCmd.Flags().StringVar(&keepAmount, "keep", "", "Amount to keep in the wallet when using --max")
 	depositCmd.MarkFlagRequired("mint")
+	depositCmd.MarkFlagsOneRequired("amount", "max")
+	depositCmd.MarkFlagsMutuallyExclusive("amount", "max")
+
+	// Custom validation
+	depositCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("keep") && !depositMax {
+			return fmt.Errorf("--keep can only be used with --max")
+		}
+		if keepAmount != "" {
+			if _, err := internal.ParseDecimal(keepAmount); err != nil {
+				return fmt.Errorf("invalid --keep: %w", err)
+			}
+		}
+		return nil
+	}
 }
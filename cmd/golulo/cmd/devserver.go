@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	devserverListen     string
+	devserverAPIKey     string
+	devserverAPIVersion string
+	devserverAirdrop    []string
+)
+
+var devserverCmd = &cobra.Command{
+	Use:   "devserver",
+	Short: "Run a mock Lulo API and Solana RPC for offline development",
+	Long: `Runs a local stand-in for the Lulo API under /lulo and for a Solana RPC
+node under /rpc. Deposits and withdrawals generate real transactions that must
+be signed by the wallet; once sent to /rpc they land at once and the account
+returned by /lulo reflects them. Point another golulo at it with:
+
+  golulo --lulo-api-url http://127.0.0.1:8899/lulo --lulo-api-key dev \
+         --rpc-url http://127.0.0.1:8899/rpc deposit --mint USDC --amount 100
+
+State is kept in memory and lost when the server stops.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		version := ""
+		if devserverAPIVersion != internal.LuloAPIAuto {
+			var err error
+			if version, err = internal.ParseLuloAPIVersion(devserverAPIVersion); err != nil {
+				return err
+			}
+		}
+
+		dev := internal.NewDevServer(devserverAPIKey)
+		dev.Version = version
+		dev.Log = commandLogger(cmd)
+		for _, wallet := range devserverAirdrop {
+			key, err := solana.PublicKeyFromBase58(wallet)
+			if err != nil {
+				return fmt.Errorf("invalid --airdrop wallet %q: %w", wallet, err)
+			}
+			dev.Bank.Airdrop(key, 10*solana.LAMPORTS_PER_SOL)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/lulo/", http.StripPrefix("/lulo", dev.Handler()))
+		mux.Handle("/rpc", dev.Bank)
+
+		listener, err := net.Listen("tcp", devserverListen)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		errc := make(chan error, 1)
+		go func() {
+			errc <- httpServer.Serve(listener)
+		}()
+
+		base := "http://" + listener.Addr().String()
+		fmt.Printf("Lulo API: %s/lulo (API key %q)\n", base, devserverAPIKey)
+		fmt.Printf("RPC:      %s/rpc\n", base)
+
+		ctx := cmd.Context()
+		select {
+		case err := <-errc:
+			return fmt.Errorf("failed to serve: %w", err)
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to shut down: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(devserverCmd)
+	devserverCmd.Flags().StringVar(&devserverListen, "listen", "127.0.0.1:8899", "Address to listen on")
+	devserverCmd.Flags().StringVar(&devserverAPIKey, "api-key", "dev", "API key clients must send")
+	devserverCmd.Flags().StringVar(&devserverAPIVersion, "api-version", internal.LuloAPIAuto, "Routes to serve: legacy, v1, or auto for both")
+	devserverCmd.Flags().StringSliceVar(&devserverAirdrop, "airdrop", nil, "Wallets to start with 10 SOL")
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	exportFormat    string
+	exportFrom      string
+	exportTo        string
+	exportCostBasis string
+	exportOutput    string
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a ledger of deposits, withdrawals and interest for accounting",
+	Long: `Export a ledger of Lulo deposits, withdrawals and interest accrual snapshots.
+
+Deposits and withdrawals come from the wallet's on-chain history and are valued
+in USD at the time of the event. Each deposit opens a lot; withdrawals consume
+principal from those lots (FIFO or average cost) and anything withdrawn beyond
+principal is reported as realized yield.
+
+Every export records a snapshot of the current account value and interest
+earned, so regular exports build up an interest accrual history.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportFormat != "csv" && exportFormat != "json" {
+			return fmt.Errorf("unknown format %q, expected csv or json", exportFormat)
+		}
+		from, err := parseDate(exportFrom)
+		if err != nil {
+			return err
+		}
+		to, err := parseDate(exportTo)
+		if err != nil {
+			return err
+		}
+		if len(exportTo) == len("2006-01-02") {
+			// Include the whole --to day
+			to = to.Add(24 * time.Hour)
+		}
+
+		// Create Solana client
+		client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+		wallet := client.WalletPubKey()
+
+		// Cost basis needs the full history, not just the exported range
+		cache, err := internal.LoadHistoryCache(wallet)
+		if err != nil {
+			return err
+		}
+		if err := client.SyncHistory(cmd.Context(), cache, time.Time{}); err != nil {
+			return err
+		}
+		if err := cache.Save(); err != nil {
+			return err
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+		account, err := luloClient.GetAccount(cmd.Context(), wallet)
+		if err != nil {
+			return fmt.Errorf("failed to get account: %w", err)
+		}
+		snapshots, err := internal.RecordSnapshot(wallet, account, time.Now())
+		if err != nil {
+			return err
+		}
+
+		commandLogger(cmd).WithFields(logrus.Fields{
+			"entries":   len(cache.Entries),
+			"snapshots": len(snapshots),
+		}).Info("Building ledger")
+
+		rows, err := internal.BuildLedger(cmd.Context(), cache.Entries, snapshots, internal.NewCoingeckoPrices(), exportCostBasis, from, to)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = os.Stdout
+		if exportOutput != "" {
+			file, err := os.Create(exportOutput)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		if exportFormat == "json" {
+			return internal.WriteLedgerJSON(out, rows)
+		}
+		return internal.WriteLedgerCSV(out, rows)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&exportFormat, "format", "csv", "Output format (csv or json)")
+	exportCmd.Flags().StringVar(&exportFrom, "from", "", "Start date (YYYY-MM-DD), inclusive")
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "End date (YYYY-MM-DD), inclusive")
+	exportCmd.Flags().StringVar(&exportCostBasis, "cost-basis", internal.CostBasisFIFO, "Cost basis method (fifo or average)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to file instead of stdout")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	exporterListen   string
+	exporterInterval time.Duration
+)
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Serve Prometheus metrics of Lulo accounts and rates",
+	Long: `Periodically refreshes the Lulo accounts of the wallets listed under
+exporter.wallets, or the --wallet or configured keypair's wallet, and serves them on
+/metrics in the Prometheus text format.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var cfg internal.ExporterConfig
+		if err := viper.UnmarshalKey("exporter", &cfg); err != nil {
+			return fmt.Errorf("failed to parse exporter config: %w", err)
+		}
+		if cmd.Flags().Changed("listen") || cfg.Listen == "" {
+			cfg.Listen = exporterListen
+		}
+		if cmd.Flags().Changed("interval") || cfg.Interval <= 0 {
+			cfg.Interval = exporterInterval
+		}
+
+		// Default to the --wallet or configured keypair's wallet
+		if len(cfg.Wallets) == 0 {
+			client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+			if err != nil {
+				return fmt.Errorf("no exporter.wallets configured and failed to create client: %w", err)
+			}
+			cfg.Wallets = []internal.ExporterWallet{{Name: "default", Address: client.WalletPubKey().String()}}
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		exporter, err := internal.NewExporter(luloClient, cfg.Wallets, cfg.Balances)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		httpServer := &http.Server{
+			Addr:              cfg.Listen,
+			Handler:           exporter.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		errc := make(chan error, 1)
+		go func() {
+			errc <- httpServer.ListenAndServe()
+		}()
+
+		commandLogger(cmd).WithFields(logrus.Fields{
+			"listen":   cfg.Listen,
+			"wallets":  len(cfg.Wallets),
+			"interval": cfg.Interval,
+		}).Info("Serving metrics")
+
+		for {
+			exporter.Refresh(ctx)
+
+			select {
+			case err := <-errc:
+				return fmt.Errorf("failed to serve: %w", err)
+			case <-ctx.Done():
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					return fmt.Errorf("failed to shut down: %w", err)
+				}
+				return nil
+			case <-time.After(cfg.Interval):
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exporterCmd)
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", "127.0.0.1:9464", "Address to serve /metrics on")
+	exporterCmd.Flags().DurationVarP(&exporterInterval, "interval", "i", time.Minute, "Refresh interval")
+}
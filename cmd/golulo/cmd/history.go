@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	historySince string
+	historyToken string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show Lulo deposits, withdrawals and settings changes of the wallet",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseDate(historySince)
+		if err != nil {
+			return err
+		}
+
+		// Create Solana client
+		client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		cache, err := internal.LoadHistoryCache(client.WalletPubKey())
+		if err != nil {
+			return err
+		}
+
+		commandLogger(cmd).WithFields(logrus.Fields{
+			"wallet":        client.WalletPubKey().String(),
+			"cachedEntries": len(cache.Entries),
+		}).Info("Fetching transaction history")
+
+		if err := client.SyncHistory(cmd.Context(), cache, since); err != nil {
+			return err
+		}
+		if err := cache.Save(); err != nil {
+			return err
+		}
+
+		mint := ""
+		if historyToken != "" {
+			mint = internal.ResolveMint(historyToken)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DATE\tTYPE\tTOKEN\tAMOUNT\tPROTOCOL\tFEE (SOL)\tSIGNATURE")
+		for _, entry := range cache.Entries {
+			if !since.IsZero() && entry.Time.Before(since) {
+				continue
+			}
+			if mint != "" && entry.Mint != mint {
+				continue
+			}
+
+			entryType := entry.Type
+			if entry.Failed {
+				entryType += " (failed)"
+			}
+			token := ""
+			if entry.Mint != "" {
+				token = internal.TokenSymbol(entry.Mint)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Time.Format("2006-01-02 15:04"),
+				entryType,
+				token,
+				entry.Amount,
+				entry.Protocol,
+				internal.FormatAmount(entry.Fee, internal.NativeSOL.Decimals),
+				entry.Signature,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+// parseDate parses a YYYY-MM-DD or RFC 3339 date, returning the zero time for an empty string
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVar(&historySince, "since", "", "Only show activity since this date (YYYY-MM-DD)")
+	historyCmd.Flags().StringVarP(&historyToken, "token", "t", "", "Only show activity for this token (symbol or mint address)")
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	portfolioConcurrency int
+	portfolioRate        float64
+	portfolioJSON        bool
+)
+
+var portfolioCmd = &cobra.Command{
+	Use:   "portfolio [wallet|profile ...]",
+	Short: "Show the combined Lulo accounts of several wallets",
+	Long: `Fetches the Lulo account of every given wallet address or profile name,
+or of all configured profiles when none are given, and shows per-wallet and
+aggregate value, interest, value-weighted APY and token exposure. Wallets are
+watch-only: no private key is needed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		wallets, err := portfolioWallets(args)
+		if err != nil {
+			return err
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		portfolio := internal.FetchPortfolio(cmd.Context(), luloClient, wallets, portfolioConcurrency, portfolioRate)
+
+		if portfolioJSON {
+			prettyJSON, err := json.MarshalIndent(portfolio, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to format response: %w", err)
+			}
+			fmt.Println(string(prettyJSON))
+		} else if err := printPortfolio(portfolio); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, wallet := range portfolio.Wallets {
+			if wallet.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to fetch %d of %d wallets", failed, len(portfolio.Wallets))
+		}
+		return nil
+	},
+}
+
+// portfolioWallets resolves the wallet arguments, defaulting to every configured profile
+func portfolioWallets(args []string) ([]internal.PortfolioWallet, error) {
+	var wallets []internal.PortfolioWallet
+	if len(args) == 0 {
+		profiles, err := internal.LoadProfiles()
+		if err != nil {
+			return nil, err
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("no wallets given and no profiles configured")
+		}
+		for _, profile := range profiles {
+			wallet, err := profile.PublicKey()
+			if err != nil {
+				return nil, err
+			}
+			wallets = append(wallets, internal.PortfolioWallet{Name: profile.Name, Wallet: wallet})
+		}
+		return wallets, nil
+	}
+
+	for _, arg := range args {
+		name, wallet, err := internal.ResolveWallet(arg)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, internal.PortfolioWallet{Name: name, Wallet: wallet})
+	}
+	return wallets, nil
+}
+
+// printPortfolio prints the per-wallet and exposure tables
+func printPortfolio(portfolio *internal.Portfolio) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tWALLET\tVALUE\tINTEREST\tAPY")
+	for _, wallet := range portfolio.Wallets {
+		if wallet.Account == nil {
+			fmt.Fprintf(w, "%s\t%s\terror\t\t\n", wallet.Name, wallet.Wallet)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t$%.2f\t$%.4f\t%.2f%%\n",
+			wallet.Name,
+			wallet.Wallet,
+			wallet.Account.TotalValue,
+			wallet.Account.InterestEarned,
+			wallet.Account.RealtimeAPY,
+		)
+	}
+	fmt.Fprintf(w, "TOTAL\t\t$%.2f\t$%.4f\t%.2f%%\n", portfolio.TotalValue, portfolio.InterestEarned, portfolio.WeightedAPY)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, wallet := range portfolio.Wallets {
+		if wallet.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", wallet.Wallet, wallet.Error)
+		}
+	}
+
+	if portfolio.NoPositions > 0 {
+		fmt.Fprintf(os.Stderr, "The Lulo API returned no positions for %d wallet(s), which are left out of the token exposure\n", portfolio.NoPositions)
+	}
+	if len(portfolio.Exposure) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN\tAMOUNT\tVALUE\tSHARE")
+	for _, token := range portfolio.Exposure {
+		fmt.Fprintf(w, "%s\t%g\t$%.2f\t%.1f%%\n", token.Symbol, token.Amount, token.Value, token.Share)
+	}
+	return w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(portfolioCmd)
+	portfolioCmd.Flags().IntVar(&portfolioConcurrency, "concurrency", 4, "Maximum number of accounts fetched at once")
+	portfolioCmd.Flags().Float64Var(&portfolioRate, "rate", 5, "Maximum account requests per second, 0 for no limit")
+	portfolioCmd.Flags().BoolVar(&portfolioJSON, "json", false, "Print the portfolio as JSON")
+}
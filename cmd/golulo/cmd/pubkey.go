@@ -11,7 +11,7 @@ var pubkeyCmd = &cobra.Command{
 	Use:   "pubkey",
 	Short: "Display public key from keypair file",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		solanaClient, err := internal.NewSolanaClient()
+		solanaClient, err := internal.NewSolanaClient(commandLogger(cmd))
 		if err != nil {
 			return fmt.Errorf("failed to create client: %w", err)
 		}
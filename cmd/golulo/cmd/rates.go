@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var ratesToken string
+
+var ratesCmd = &cobra.Command{
+	Use:   "rates",
+	Short: "Show current Lulo pool and protocol rates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		rates, err := luloClient.GetRates(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get rates: %w", err)
+		}
+
+		mint := ""
+		if ratesToken != "" {
+			mint = internal.ResolveMint(ratesToken)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tNAME\tTOKEN\tAPY")
+		for _, pool := range rates.Pools {
+			if mint == "" || pool.MintAddress == mint {
+				fmt.Fprintf(w, "pool\t%s\t%s\t%.2f%%\n", pool.Pool, internal.TokenSymbol(pool.MintAddress), pool.APY)
+			}
+		}
+		for _, protocol := range rates.Protocols {
+			if mint == "" || protocol.MintAddress == mint {
+				fmt.Fprintf(w, "protocol\t%s\t%s\t%.2f%%\n", protocol.Protocol, internal.TokenSymbol(protocol.MintAddress), protocol.APY)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ratesCmd)
+	ratesCmd.Flags().StringVarP(&ratesToken, "token", "t", "", "Only show rates for this token (symbol or mint address)")
+}
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
 )
 
 var (
@@ -15,20 +23,117 @@ var (
 	rpcURL           string
 	rpcAPIKey        string
 	luloAPIKey       string
+	luloAPIURL       string
 	priorityFee      string
 	allowedProtocols []string
+	walletArg        string
+	useJito          bool
+	logLevel         string
+	logFormat        string
+	logFile          string
+	commandTimeout   time.Duration
 )
 
+// cancelTimeout releases the --timeout context once the command returns
+var cancelTimeout context.CancelFunc = func() {}
+
+// closeLog closes the --log-file once the command returns
+var closeLog = func() error { return nil }
+
 var rootCmd = &cobra.Command{
 	Use:   "golulo",
 	Short: "A CLI for interacting with Lulo Protocol",
 	Long: `golulo is a command line interface for interacting with the Lulo Protocol
 on the Solana blockchain. It provides commands for managing lending positions,
 viewing market data, and more.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+		log, closeLogFile, err := internal.SetupLogging(internal.LogConfig{
+			Level:      viper.GetString("log-level"),
+			Format:     viper.GetString("log-format"),
+			File:       viper.GetString("log-file"),
+			MaxSize:    viper.GetInt64("log-max-size") << 20,
+			MaxBackups: viper.GetInt("log-max-backups"),
+		}, command)
+		if err != nil {
+			return err
+		}
+		closeLog = closeLogFile
+		cmd.SetContext(internal.WithLogger(cmd.Context(), log))
+
+		if timeout := viper.GetDuration("timeout"); timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cmd.SetContext(ctx)
+			cancelTimeout = cancel
+		}
+		return nil
+	},
 }
 
+// Execute runs the command with a context that is cancelled on SIGINT or
+// SIGTERM. A second signal exits immediately. When the command is cut short,
+// the transactions it already sent are reported so nothing is left to guesswork.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	sent := internal.NewSentLog(maxReportedTransactions)
+
+	err := rootCmd.ExecuteContext(internal.WithSentLog(ctx, sent))
+	cancelTimeout()
+	if closeErr := closeLog(); closeErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to close log file: %v\n", closeErr)
+	}
+
+	interrupted := ctx.Err() != nil
+	if interrupted || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		reportSentTransactions(sent, interrupted, err != nil)
+	}
+	return err
+}
+
+// maxReportedTransactions is how many sent transactions the interruption report lists
+const maxReportedTransactions = 20
+
+// reportSentTransactions prints the transactions sent before the command was
+// interrupted or timed out
+func reportSentTransactions(log *internal.SentLog, interrupted, failed bool) {
+	reason := "Timed out"
+	if interrupted {
+		reason = "Interrupted"
+	}
+
+	sent, total := log.Transactions()
+	if total == 0 {
+		if failed {
+			fmt.Fprintf(os.Stderr, "%s: no transactions were sent\n", reason)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s after sending %d transaction(s):\n", reason, total)
+	// Long-running commands may have sent many, the latest are the ones in doubt
+	if total > len(sent) {
+		fmt.Fprintf(os.Stderr, "  ... %d earlier transaction(s) omitted\n", total-len(sent))
+	}
+	for _, tx := range sent {
+		status := tx.Status
+		switch tx.Status {
+		case internal.SentUnknown:
+			status = "send interrupted, may have landed: check before retrying"
+		case internal.SentBundle:
+			status = "sent in bundle " + tx.Bundle
+		}
+		fmt.Fprintf(os.Stderr, "  %s  %s  %s  (%s)\n", tx.Time.Format(time.TimeOnly), tx.Wallet, tx.Signature, status)
+	}
+}
+
+// commandLogger returns the logger of the running command, carrying its name
+func commandLogger(cmd *cobra.Command) *logrus.Entry {
+	return internal.LoggerFrom(cmd.Context())
 }
 
 func init() {
@@ -40,14 +145,30 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&rpcURL, "rpc-url", "", "RPC server URL")
 	rootCmd.PersistentFlags().StringVar(&rpcAPIKey, "rpc-api-key", "", "API key for RPC")
 	rootCmd.PersistentFlags().StringVar(&luloAPIKey, "lulo-api-key", "", "API key for Lulo")
+	rootCmd.PersistentFlags().StringVar(&luloAPIURL, "lulo-api-url", "", "Lulo API base URL (default "+internal.DefaultLuloAPIURL+")")
 	rootCmd.PersistentFlags().StringVar(&priorityFee, "priority-fee", "", "Priority fee for transactions")
-	rootCmd.PersistentFlags().StringSliceVar(&allowedProtocols, "allowed-protocols", []string{}, "Allowed protocols for transactions")
+	rootCmd.PersistentFlags().StringVar(&walletArg, "wallet", "", "wallet address or profile name (read commands need no keypair)")
+	rootCmd.PersistentFlags().BoolVar(&useJito, "jito", false, "send multi-transaction operations as Jito bundles")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level (trace, debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format (text or json)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "write logs to a rotated file instead of stderr")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "timeout", 0, "cancel the command after this long, e.g. 2m (0 for no limit)")
+	rootCmd.PersistentFlags().StringSliceVar(&allowedProtocols, "allowed-protocols", []string{}, "only deposit into these protocols (default any)")
 	// Bind flags to viper
 	viper.BindPFlag("keypair", rootCmd.PersistentFlags().Lookup("keypair"))
 	viper.BindPFlag("rpc-url", rootCmd.PersistentFlags().Lookup("rpc-url"))
 	viper.BindPFlag("rpc-api-key", rootCmd.PersistentFlags().Lookup("rpc-api-key"))
 	viper.BindPFlag("lulo-api-key", rootCmd.PersistentFlags().Lookup("lulo-api-key"))
+	viper.BindPFlag("lulo-api-url", rootCmd.PersistentFlags().Lookup("lulo-api-url"))
 	viper.BindPFlag("priority-fee", rootCmd.PersistentFlags().Lookup("priority-fee"))
+	viper.BindPFlag("wallet", rootCmd.PersistentFlags().Lookup("wallet"))
+	viper.BindPFlag("jito.enabled", rootCmd.PersistentFlags().Lookup("jito"))
+	viper.BindPFlag("log-level", rootCmd.PersistentFlags().Lookup("log-level"))
+	viper.BindPFlag("log-format", rootCmd.PersistentFlags().Lookup("log-format"))
+	viper.BindPFlag("log-file", rootCmd.PersistentFlags().Lookup("log-file"))
+	viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
+	viper.SetDefault("log-max-size", 10)
+	viper.SetDefault("log-max-backups", 3)
 	viper.BindPFlag("allowed-protocols", rootCmd.PersistentFlags().Lookup("allowed-protocols"))
 }
 
@@ -67,6 +188,7 @@ func initConfig() {
 	// Read environment variables
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("GOLULO")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
 
 	// If a config file is found, read it in
 	if err := viper.ReadInConfig(); err != nil {
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	rpcStatusSamples int
+	rpcStatusJSON    bool
+)
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc",
+	Short: "Inspect the configured RPC endpoints",
+}
+
+var rpcStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check the health, slot lag and latency of every RPC endpoint",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pool, err := internal.NewRPCPool(nil, commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		for i := 0; i < rpcStatusSamples; i++ {
+			pool.CheckHealth(ctx)
+		}
+		stats := pool.Stats()
+
+		if rpcStatusJSON {
+			prettyJSON, err := json.MarshalIndent(stats, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to format response: %w", err)
+			}
+			fmt.Println(string(prettyJSON))
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tURL\tHEALTHY\tSLOT\tLAG\tLATENCY\tERRORS\tLAST ERROR")
+			for _, endpoint := range stats {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%d\t%d\t%s\t%d/%d\t%s\n",
+					endpoint.Name,
+					endpoint.URL,
+					endpoint.Healthy,
+					endpoint.Slot,
+					endpoint.Lag,
+					endpoint.AvgLatency.Round(time.Millisecond),
+					endpoint.Errors,
+					endpoint.Requests,
+					truncate(endpoint.LastError, 60),
+				)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+
+		for _, endpoint := range stats {
+			if endpoint.Healthy {
+				return nil
+			}
+		}
+		return fmt.Errorf("no healthy RPC endpoint")
+	},
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func init() {
+	rootCmd.AddCommand(rpcCmd)
+	rpcCmd.AddCommand(rpcStatusCmd)
+	rpcStatusCmd.Flags().IntVarP(&rpcStatusSamples, "samples", "n", 3, "Number of health checks per endpoint")
+	rpcStatusCmd.Flags().BoolVar(&rpcStatusJSON, "json", false, "Print the status as JSON")
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	scheduleCron   string
+	scheduleMint   string
+	scheduleAmount string
+	schedulePool   string
+	scheduleLimit  int
+)
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage recurring deposits",
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a recurring deposit",
+	Example: `  # Every Monday at 09:00
+  golulo schedule add --cron "0 9 * * 1" --mint USDC --amount 500`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sched, err := internal.ParseCron(scheduleCron)
+		if err != nil {
+			return err
+		}
+
+		mint := internal.ResolveMint(scheduleMint)
+		value, percent, err := parseAmount(scheduleAmount)
+		if err != nil {
+			return err
+		}
+		if percent {
+			return fmt.Errorf("scheduled deposits take a fixed amount, not a percentage")
+		}
+		amount, err := internal.FloorAmount(value, internal.TokenDecimals(mint))
+		if err != nil {
+			return err
+		}
+		if amount == "0" {
+			return fmt.Errorf("amount is below the token's precision")
+		}
+
+		store, err := loadScheduleStore(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+		schedule, err := store.Add(internal.ScheduledDeposit{
+			Cron:    scheduleCron,
+			Mint:    mint,
+			Amount:  amount,
+			Pool:    schedulePool,
+			Created: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := store.Save(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added schedule %s: deposit %s %s at %q, next run %s\n",
+			schedule.ID, amount, internal.TokenSymbol(mint), scheduleCron,
+			sched.Next(time.Now()).Format("2006-01-02 15:04 MST"))
+		return nil
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recurring deposits",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := loadScheduleStore(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+		entries, err := store.JobLog()
+		if err != nil {
+			return err
+		}
+		last := map[string]internal.JobLogEntry{}
+		for _, entry := range entries {
+			last[entry.Schedule] = entry
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCRON\tTOKEN\tAMOUNT\tPOOL\tNEXT RUN\tLAST RUN")
+		for _, schedule := range store.Schedules {
+			next := "invalid"
+			if sched, err := internal.ParseCron(schedule.Cron); err == nil {
+				next = sched.Next(time.Now()).Format("2006-01-02 15:04")
+			}
+			lastRun := ""
+			if entry, ok := last[schedule.ID]; ok {
+				lastRun = fmt.Sprintf("%s (%s)", entry.Time.Local().Format("2006-01-02 15:04"), entry.Status)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				schedule.ID,
+				schedule.Cron,
+				internal.TokenSymbol(schedule.Mint),
+				schedule.Amount,
+				schedule.Pool,
+				next,
+				lastRun,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a recurring deposit",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := loadScheduleStore(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+		if !store.Remove(args[0]) {
+			return fmt.Errorf("no schedule with ID %s", args[0])
+		}
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed schedule %s\n", args[0])
+		return nil
+	},
+}
+
+var scheduleLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the job log of scheduled deposits",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := loadScheduleStore(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+		entries, err := store.JobLog()
+		if err != nil {
+			return err
+		}
+		if scheduleLimit > 0 && len(entries) > scheduleLimit {
+			entries = entries[len(entries)-scheduleLimit:]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tSCHEDULE\tSTATUS\tTOKEN\tAMOUNT\tDETAILS")
+		for _, entry := range entries {
+			details := strings.Join(entry.Signatures, ",")
+			if entry.Error != "" {
+				details = entry.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				entry.Time.Local().Format("2006-01-02 15:04:05"),
+				entry.Schedule,
+				entry.Status,
+				internal.TokenSymbol(entry.Mint),
+				entry.Amount,
+				details,
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the scheduler in the foreground",
+	Long: `Runs due schedules until interrupted, suitable for a systemd service.
+
+Schedules are re-read every minute, so add and remove take effect without a
+restart. Every run is recorded in the job log under an idempotency key made of
+the schedule ID and fire time; a key that was already started is never run
+again, so a crash during a deposit is not repeated.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create Solana client
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		commandLogger(cmd).WithField("wallet", client.WalletPubKey().String()).Info("Starting scheduler")
+
+		// Start with the current minute; the job log keeps a minute from running twice
+		from := time.Now().Truncate(time.Minute)
+		for {
+			now := time.Now().Truncate(time.Minute)
+			store, err := internal.LoadScheduleStore(client.WalletPubKey())
+			if err != nil {
+				commandLogger(cmd).WithError(err).Error("Failed to load schedules")
+			} else {
+				// Walk every minute since the last check so slow deposits never skip a firing
+				for minute := from; !minute.After(now); minute = minute.Add(time.Minute) {
+					for _, schedule := range store.Schedules {
+						runSchedule(ctx, client, luloClient, store, schedule, minute)
+					}
+				}
+				from = now.Add(time.Minute)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(now.Add(time.Minute))):
+			}
+		}
+	},
+}
+
+// runSchedule executes a schedule if it fires at the given minute and has not run for it yet
+func runSchedule(ctx context.Context, client *internal.SolanaClient, luloClient *internal.LuloClient, store *internal.ScheduleStore, schedule internal.ScheduledDeposit, minute time.Time) {
+	sched, err := internal.ParseCron(schedule.Cron)
+	if err != nil {
+		internal.LoggerFrom(ctx).WithError(err).WithField("schedule", schedule.ID).Error("Invalid schedule")
+		return
+	}
+	if !sched.Matches(minute) {
+		return
+	}
+
+	key := internal.JobKey(schedule.ID, minute)
+	log := internal.LoggerFrom(ctx).WithFields(logrus.Fields{
+		"schedule": schedule.ID,
+		"key":      key,
+		"token":    internal.TokenSymbol(schedule.Mint),
+		"amount":   schedule.Amount,
+	})
+
+	status, err := store.JobStatus(key)
+	if err != nil {
+		log.WithError(err).Error("Failed to read job log, skipping run")
+		return
+	}
+	switch status {
+	case "":
+	case internal.JobStarted:
+		log.Warn("Run was interrupted before completing, not repeating it; check the wallet before re-running manually")
+		return
+	default:
+		log.WithField("status", status).Info("Run already recorded, skipping")
+		return
+	}
+
+	entry := internal.JobLogEntry{
+		Key:      key,
+		Schedule: schedule.ID,
+		Time:     time.Now().UTC(),
+		Status:   internal.JobStarted,
+		Mint:     schedule.Mint,
+		Amount:   schedule.Amount,
+		Pool:     schedule.Pool,
+	}
+	// The started entry must hit the disk before anything is signed
+	if err := store.AppendJobLog(entry); err != nil {
+		log.WithError(err).Error("Failed to write job log, skipping run")
+		return
+	}
+
+	log.Info("Running scheduled deposit")
+	sigs, err := internal.Deposit(ctx, client, luloClient, schedule.Mint, schedule.Amount, schedule.Pool)
+
+	entry.Time = time.Now().UTC()
+	entry.Status = internal.JobSent
+	for _, sig := range sigs {
+		entry.Signatures = append(entry.Signatures, sig.String())
+	}
+	if err != nil {
+		entry.Status = internal.JobFailed
+		entry.Error = err.Error()
+		log.WithError(err).Error("Scheduled deposit failed")
+	} else {
+		log.WithField("signatures", entry.Signatures).Info("Scheduled deposit sent")
+	}
+	if err := store.AppendJobLog(entry); err != nil {
+		log.WithError(err).Error("Failed to write job log")
+	}
+}
+
+// loadScheduleStore loads the schedules of the configured wallet
+func loadScheduleStore(log *logrus.Entry) (*internal.ScheduleStore, error) {
+	client, err := internal.NewReadOnlyClient(log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return internal.LoadScheduleStore(client.WalletPubKey())
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(scheduleLogCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+
+	scheduleAddCmd.Flags().StringVar(&scheduleCron, "cron", "", "Cron expression in local time (minute hour day-of-month month day-of-week)")
+	scheduleAddCmd.Flags().StringVarP(&scheduleMint, "mint", "m", "", "Mint address or token symbol")
+	scheduleAddCmd.Flags().StringVarP(&scheduleAmount, "amount", "a", "", "Amount to deposit on every run")
+	scheduleAddCmd.Flags().StringVar(&schedulePool, "pool", "", "Lulo pool to deposit into (e.g. regular, protected, boosted)")
+	scheduleAddCmd.MarkFlagRequired("cron")
+	scheduleAddCmd.MarkFlagRequired("mint")
+	scheduleAddCmd.MarkFlagRequired("amount")
+
+	scheduleLogCmd.Flags().IntVarP(&scheduleLimit, "limit", "n", 20, "Number of most recent entries to show, 0 for all")
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var serveListen string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve account, rates, balances, deposits and withdrawals as a local HTTP/JSON API",
+	Long: `Runs a local REST API backed by the configured wallet. Requests must carry
+"Authorization: Bearer <token>", where the token is set with serve-token in the
+config file or the GOLULO_SERVE_TOKEN environment variable. The OpenAPI document
+is served at /openapi.json.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token, err := internal.ConfigSecret("serve-token")
+		if err != nil {
+			return err
+		}
+		if token == "" {
+			token = os.Getenv("GOLULO_SERVE_TOKEN")
+		}
+		if token == "" {
+			return fmt.Errorf("no API token: set serve-token in the config file or GOLULO_SERVE_TOKEN")
+		}
+
+		host, _, err := net.SplitHostPort(serveListen)
+		if err != nil {
+			return fmt.Errorf("invalid --listen address: %w", err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			commandLogger(cmd).WithField("listen", serveListen).Warn("Listening on a non-loopback address, anyone with the token can move funds")
+		}
+
+		// Create Solana client
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		server := &internal.Server{Client: client, Lulo: luloClient, Token: token, Log: commandLogger(cmd)}
+		ctx := cmd.Context()
+		httpServer := &http.Server{
+			Addr:              serveListen,
+			Handler:           server.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			// Requests record their sends in the command's sent log, but are
+			// not cancelled with it so in-flight ones finish on shutdown
+			BaseContext: func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			commandLogger(cmd).WithFields(logrus.Fields{
+				"listen": serveListen,
+				"wallet": client.WalletPubKey().String(),
+			}).Info("Serving API")
+			errc <- httpServer.ListenAndServe()
+		}()
+
+		select {
+		case err := <-errc:
+			return fmt.Errorf("failed to serve: %w", err)
+		case <-ctx.Done():
+		}
+
+		// Let in-flight deposits and withdrawals finish before exiting
+		commandLogger(cmd).Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), internal.DefaultConfirmTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to shut down: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Address to listen on")
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	txInspectSimulate bool
+	txInspectLogs     bool
+	txInspectJSON     bool
+)
+
+var txCmd = &cobra.Command{
+	Use:   "tx",
+	Short: "Inspect Solana transactions",
+}
+
+var txInspectCmd = &cobra.Command{
+	Use:   "inspect <base64|signature|file>",
+	Short: "Decode a transaction into its accounts and instructions",
+	Long: `Decodes a transaction and prints its accounts, with their signer and writable
+flags, and its instructions. Address lookup tables are resolved over RPC, and
+System, SPL Token, Associated Token, Compute Budget and Memo instructions are
+decoded. Lulo instructions are named from their Anchor discriminator, with the
+mints and programs among their accounts marked; their arguments are shown as
+raw data. Lulo instructions not known by their discriminator, and those of the
+lending protocols it routes into, are named from the program logs when the
+transaction was fetched by signature or simulated with --simulate.
+
+The argument is a base64 encoded transaction, as returned by the Lulo API, the
+signature of a confirmed transaction, or a file holding base64 transactions
+separated by whitespace or as a JSON array. Use - to read the file from stdin.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rpcClient, wallet, err := inspectClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		var decoded []*internal.DecodedTransaction
+		if sig, ok := parseSignature(args[0]); ok {
+			tx, err := internal.InspectSignature(ctx, rpcClient, sig, wallet)
+			if err != nil {
+				return err
+			}
+			decoded = append(decoded, tx)
+		} else {
+			b64_txs, err := readInspectInput(args[0])
+			if err != nil {
+				return err
+			}
+			for i, b64_tx := range b64_txs {
+				tx, err := internal.ParseB64Transaction(b64_tx)
+				if err != nil {
+					return fmt.Errorf("transaction %d: %w", i, err)
+				}
+				inspected, err := internal.InspectTransaction(ctx, rpcClient, tx, wallet, txInspectSimulate)
+				if err != nil {
+					return fmt.Errorf("transaction %d: %w", i, err)
+				}
+				decoded = append(decoded, inspected)
+			}
+		}
+
+		if txInspectJSON {
+			var out interface{} = decoded
+			if len(decoded) == 1 {
+				out = decoded[0]
+			}
+			prettyJSON, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to format response: %w", err)
+			}
+			fmt.Println(string(prettyJSON))
+			return nil
+		}
+
+		for i, tx := range decoded {
+			if i > 0 {
+				fmt.Println()
+			}
+			tx.WriteTree(os.Stdout)
+			if txInspectLogs && len(tx.Logs) > 0 {
+				fmt.Println("Logs:")
+				for _, line := range tx.Logs {
+					fmt.Printf("  %s\n", line)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// inspectClient returns an RPC client and the wallet whose accounts are
+// labelled. Inspecting needs no wallet, so none is used when none is configured.
+func inspectClient(log *logrus.Entry) (internal.RPC, solana.PublicKey, error) {
+	if client, err := internal.NewReadOnlyClient(log); err == nil {
+		return client.RpcClient, client.WalletPubKey(), nil
+	}
+	rpcClient, err := internal.NewRPCClient(nil, log)
+	if err != nil {
+		return nil, solana.PublicKey{}, err
+	}
+	return rpcClient, solana.PublicKey{}, nil
+}
+
+// parseSignature reports whether arg is a transaction signature rather than a
+// file or a base64 transaction
+func parseSignature(arg string) (solana.Signature, bool) {
+	if _, err := os.Stat(arg); err == nil {
+		return solana.Signature{}, false
+	}
+	sig, err := solana.SignatureFromBase58(arg)
+	return sig, err == nil
+}
+
+// readInspectInput returns the base64 transactions an argument holds: the
+// contents of a file or stdin, or the argument itself
+func readInspectInput(arg string) ([]string, error) {
+	var data []byte
+	var err error
+	if arg == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else if _, statErr := os.Stat(arg); statErr == nil {
+		data, err = os.ReadFile(arg)
+	} else {
+		return []string{arg}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "[") {
+		var b64_txs []string
+		if err := json.Unmarshal([]byte(content), &b64_txs); err != nil {
+			return nil, fmt.Errorf("failed to parse transactions: %w", err)
+		}
+		return b64_txs, nil
+	}
+	b64_txs := strings.Fields(content)
+	if len(b64_txs) == 0 {
+		return nil, fmt.Errorf("no transactions in %s", arg)
+	}
+	return b64_txs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(txCmd)
+	txCmd.AddCommand(txInspectCmd)
+	txInspectCmd.Flags().BoolVar(&txInspectSimulate, "simulate", false, "Simulate base64 transactions to show their outcome and name Lulo instructions")
+	txInspectCmd.Flags().BoolVar(&txInspectLogs, "logs", false, "Print the program logs of fetched or simulated transactions")
+	txInspectCmd.Flags().BoolVar(&txInspectJSON, "json", false, "Print the decoded transactions as JSON")
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+// sparklineLength is the number of APY samples shown in the sparkline
+const sparklineLength = 60
+
+var (
+	watchInterval   time.Duration
+	watchMaxBackoff time.Duration
+	watchPlain      bool
+)
+
+// watchState is what the watch dashboard renders on every tick
+type watchState struct {
+	wallet  string
+	started time.Time
+	updated time.Time
+	first   *internal.Account
+	account *internal.Account
+	rates   *internal.Rates
+	apys    []float64
+	err     error
+	retryIn time.Duration
+}
+
+// validateWatchDelays checks the refresh interval and that retries back off
+// from it rather than retrying sooner
+func validateWatchDelays(interval, maxBackoff time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	if maxBackoff < interval {
+		return fmt.Errorf("--max-backoff (%s) must not be less than --interval (%s)", maxBackoff, interval)
+	}
+	return nil
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Live dashboard of account value, interest and APY",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateWatchDelays(watchInterval, watchMaxBackoff); err != nil {
+			return err
+		}
+
+		// Create Solana client to get wallet pubkey
+		client, err := internal.NewReadOnlyClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		luloClient, err := internal.NewLuloClient(commandLogger(cmd))
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		plain := watchPlain || !isTerminal(os.Stdout)
+		if !plain {
+			// Switch to the alternate screen and hide the cursor
+			fmt.Print("\x1b[?1049h\x1b[?25l")
+			defer fmt.Print("\x1b[?25h\x1b[?1049l")
+		}
+
+		state := &watchState{wallet: client.WalletPubKey().String(), started: time.Now()}
+		delay := watchInterval
+		for {
+			account, err := luloClient.GetAccount(ctx, client.WalletPubKey())
+			var rates *internal.Rates
+			if err == nil {
+				rates, err = luloClient.GetRates(ctx)
+			}
+
+			if err != nil {
+				// Back off exponentially while the API is failing
+				delay = time.Duration(math.Min(float64(delay*2), float64(watchMaxBackoff)))
+				state.err = err
+				state.retryIn = delay
+				commandLogger(cmd).WithError(err).WithField("retryIn", delay).Debug("Failed to refresh")
+			} else {
+				delay = watchInterval
+				state.err = nil
+				state.updated = time.Now()
+				if state.first == nil {
+					state.first = account
+				}
+				state.account = account
+				state.rates = rates
+				state.apys = append(state.apys, account.RealtimeAPY)
+				if len(state.apys) > sparklineLength {
+					state.apys = state.apys[len(state.apys)-sparklineLength:]
+				}
+			}
+
+			if plain {
+				renderWatchLine(os.Stdout, state)
+			} else {
+				// Move home and clear the screen before redrawing
+				fmt.Print("\x1b[H\x1b[2J")
+				renderWatchDashboard(os.Stdout, state)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay):
+			}
+		}
+	},
+}
+
+// renderWatchLine prints a single line per tick, for logs and pipes
+func renderWatchLine(w io.Writer, state *watchState) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if state.err != nil {
+		fmt.Fprintf(w, "%s error=%q retry_in=%s\n", now, state.err, state.retryIn)
+		return
+	}
+	account := state.account
+	fmt.Fprintf(w, "%s total_value=%.2f interest_earned=%.4f realtime_apy=%.2f value_delta=%+.2f interest_delta=%+.4f\n",
+		now,
+		account.TotalValue,
+		account.InterestEarned,
+		account.RealtimeAPY,
+		account.TotalValue-state.first.TotalValue,
+		account.InterestEarned-state.first.InterestEarned,
+	)
+}
+
+// renderWatchDashboard draws the full-screen dashboard
+func renderWatchDashboard(w io.Writer, state *watchState) {
+	fmt.Fprintf(w, "golulo watch — %s\n", state.wallet)
+	fmt.Fprintf(w, "Watching since %s, refresh every %s (Ctrl-C to quit)\n\n",
+		state.started.Format("15:04:05"), watchInterval)
+
+	if state.account == nil {
+		if state.err != nil {
+			fmt.Fprintf(w, "Error: %s (retrying in %s)\n", state.err, state.retryIn)
+		} else {
+			fmt.Fprintln(w, "Loading…")
+		}
+		return
+	}
+
+	account := state.account
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tCURRENT\tSINCE START")
+	fmt.Fprintf(tw, "Total value\t$%.2f\t%+.2f\n", account.TotalValue, account.TotalValue-state.first.TotalValue)
+	fmt.Fprintf(tw, "Interest earned\t$%.4f\t%+.4f\n", account.InterestEarned, account.InterestEarned-state.first.InterestEarned)
+	fmt.Fprintf(tw, "Realtime APY\t%.2f%%\t%+.2f\n", account.RealtimeAPY, account.RealtimeAPY-state.first.RealtimeAPY)
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nAPY %s\n", sparkline(state.apys))
+
+	if state.rates != nil && len(state.rates.Protocols) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROTOCOL\tTOKEN\tAPY")
+		for _, rate := range state.rates.Protocols {
+			fmt.Fprintf(tw, "%s\t%s\t%.2f%%\n", rate.Protocol, internal.TokenSymbol(rate.MintAddress), rate.APY)
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintf(w, "\nLast update %s", state.updated.Format("15:04:05"))
+	if state.err != nil {
+		fmt.Fprintf(w, " — error: %s (retrying in %s)", state.err, state.retryIn)
+	}
+	fmt.Fprintln(w)
+}
+
+// sparkline renders values as a row of block characters scaled between their min and max
+func sparkline(values []float64) string {
+	const blocks = "▁▂▃▄▅▆▇█"
+	ticks := []rune(blocks)
+	if len(values) == 0 {
+		return ""
+	}
+
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low = math.Min(low, v)
+		high = math.Max(high, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if high > low {
+			i = int((v - low) / (high - low) * float64(len(ticks)-1))
+		}
+		b.WriteRune(ticks[i])
+	}
+	return b.String()
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().DurationVarP(&watchInterval, "interval", "i", 30*time.Second, "Refresh interval")
+	watchCmd.Flags().DurationVar(&watchMaxBackoff, "max-backoff", 5*time.Minute, "Maximum delay between retries while the API is failing")
+	watchCmd.Flags().BoolVar(&watchPlain, "plain", false, "Print one line per refresh instead of a full-screen dashboard")
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWatchDelays(t *testing.T) {
+	tests := []struct {
+		interval   time.Duration
+		maxBackoff time.Duration
+		wantErr    string
+	}{
+		{interval: 30 * time.Second, maxBackoff: 5 * time.Minute},
+		{interval: time.Minute, maxBackoff: time.Minute},
+		{interval: 0, maxBackoff: time.Minute, wantErr: "--interval must be positive"},
+		{interval: -time.Second, maxBackoff: time.Minute, wantErr: "--interval must be positive"},
+		{interval: 30 * time.Second, maxBackoff: 0, wantErr: "--max-backoff"},
+		{interval: time.Minute, maxBackoff: 10 * time.Second, wantErr: "must not be less than --interval"},
+	}
+	for _, tt := range tests {
+		err := validateWatchDelays(tt.interval, tt.maxBackoff)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateWatchDelays(%s, %s) = %v", tt.interval, tt.maxBackoff, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateWatchDelays(%s, %s) = %v, want %q", tt.interval, tt.maxBackoff, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/cobra"
+	"github.com/tasiov/golulo/cmd/golulo/internal"
+)
+
+var (
+	wrapAmount   string
+	unwrapAmount string
+	unwrapAll    bool
+)
+
+var wrapCmd = &cobra.Command{
+	Use:   "wrap",
+	Short: "Wrap native SOL into wSOL",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lamports, err := internal.ToBaseUnits(wrapAmount, internal.NativeSOL.Decimals)
+		if err != nil {
+			return err
+		}
+		if lamports == 0 {
+			return fmt.Errorf("amount must be greater than zero")
+		}
+
+		// Create Solana client
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		sig, err := client.WrapSOL(cmd.Context(), lamports)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrapped %s SOL: %s\n", internal.FormatAmount(lamports, internal.NativeSOL.Decimals), sig)
+		return nil
+	},
+}
+
+var unwrapCmd = &cobra.Command{
+	Use:   "unwrap",
+	Short: "Unwrap wSOL back into native SOL",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create Solana client
+		client, err := internal.NewSolanaClient(commandLogger(cmd))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		ctx := cmd.Context()
+		wrapped, exists, err := client.GetWrappedSOLBalance(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("no wSOL account to unwrap")
+		}
+
+		var sig solana.Signature
+		if unwrapAll {
+			sig, err = client.UnwrapAllSOL(ctx)
+		} else {
+			if wrapped, err = internal.ToBaseUnits(unwrapAmount, internal.NativeSOL.Decimals); err != nil {
+				return err
+			}
+			if wrapped == 0 {
+				return fmt.Errorf("amount must be greater than zero")
+			}
+			sig, err = client.UnwrapSOL(ctx, wrapped)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Unwrapped %s SOL: %s\n", internal.FormatAmount(wrapped, internal.NativeSOL.Decimals), sig)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(wrapCmd)
+	rootCmd.AddCommand(unwrapCmd)
+	wrapCmd.Flags().StringVarP(&wrapAmount, "amount", "a", "", "Amount of SOL to wrap")
+	wrapCmd.MarkFlagRequired("amount")
+	unwrapCmd.Flags().StringVarP(&unwrapAmount, "amount", "a", "", "Amount of wSOL to unwrap, leaving the rest wrapped")
+	unwrapCmd.Flags().BoolVar(&unwrapAll, "all", false, "Unwrap all wSOL and close the wSOL account")
+	unwrapCmd.MarkFlagsOneRequired("amount", "all")
+	unwrapCmd.MarkFlagsMutuallyExclusive("amount", "all")
+}
@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Alert rule metrics
+const (
+	MetricRealtimeAPY        = "realtime-apy"
+	MetricTotalValue         = "total-value"
+	MetricInterestEarned     = "interest-earned"
+	MetricProtocolAllocation = "protocol-allocation" // percent of total value
+	MetricProtocolAPY        = "protocol-apy"
+	MetricWithdrawalUnlocked = "withdrawal-unlocked"
+)
+
+// AlertRule is a single alert condition from the config file.
+//
+// Threshold rules compare the current metric value against Value using Op.
+// When Window is set, the percentage change of the metric over the window is
+// compared instead, so "total value drops more than 1% in 1h" is
+// metric: total-value, window: 1h, op: "<", value: -1.
+type AlertRule struct {
+	Name     string        `mapstructure:"name"`
+	Metric   string        `mapstructure:"metric"`
+	Op       string        `mapstructure:"op"`
+	Value    float64       `mapstructure:"value"`
+	Window   time.Duration `mapstructure:"window"`
+	Protocol string        `mapstructure:"protocol"`
+	Token    string        `mapstructure:"token"`
+}
+
+// AlertConfig is the `alerts` section of the config file
+type AlertConfig struct {
+	Interval       time.Duration    `mapstructure:"interval"`
+	StateFile      string           `mapstructure:"state-file"`
+	NotifyResolved bool             `mapstructure:"notify-resolved"`
+	Rules          []AlertRule      `mapstructure:"rules"`
+	Notifiers      []NotifierConfig `mapstructure:"notifiers"`
+}
+
+// Alert is a notification produced by a rule
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Message  string    `json:"message"`
+	Value    float64   `json:"value"`
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+
+	key string // state entry MarkDelivered updates
+}
+
+// AlertState is persisted between evaluations so alerts fire once per incident
+type AlertState struct {
+	Firing   map[string]bool   `json:"firing"`
+	Notified map[string]bool   `json:"notified"`
+	Samples  []AccountSnapshot `json:"samples"`
+
+	path string
+}
+
+// Validate checks that a rule is complete and consistent
+func (r AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rule without a name")
+	}
+	switch r.Metric {
+	case MetricRealtimeAPY, MetricTotalValue, MetricInterestEarned:
+	case MetricProtocolAllocation, MetricProtocolAPY:
+		if r.Protocol == "" {
+			return fmt.Errorf("alert rule %q: metric %s requires a protocol", r.Name, r.Metric)
+		}
+		if r.Window > 0 {
+			return fmt.Errorf("alert rule %q: window is not supported for %s", r.Name, r.Metric)
+		}
+	case MetricWithdrawalUnlocked:
+		return nil
+	default:
+		return fmt.Errorf("alert rule %q: unknown metric %q", r.Name, r.Metric)
+	}
+	switch r.Op {
+	case "<", "<=", ">", ">=":
+	default:
+		return fmt.Errorf("alert rule %q: unknown operator %q", r.Name, r.Op)
+	}
+	return nil
+}
+
+// LoadAlertState reads alert state from path, or the wallet's default state file when path is empty
+func LoadAlertState(path string, wallet solana.PublicKey) (*AlertState, error) {
+	if path == "" {
+		var err error
+		if path, err = cacheFile("alerts", wallet); err != nil {
+			return nil, err
+		}
+	}
+
+	state := &AlertState{Firing: map[string]bool{}, Notified: map[string]bool{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse alert state %s: %w", path, err)
+	}
+	if state.Firing == nil {
+		state.Firing = map[string]bool{}
+	}
+	if state.Notified == nil {
+		state.Notified = map[string]bool{}
+	}
+	return state, nil
+}
+
+// Save writes the alert state to disk
+func (s *AlertState) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode alert state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	return nil
+}
+
+// EvaluateAlerts records the current account sample and returns the alerts that
+// started firing, and if notifyResolved is set those that stopped firing.
+// Alerts only count as sent once passed to MarkDelivered, so an alert that
+// could not be delivered is returned again by the next evaluation.
+func EvaluateAlerts(rules []AlertRule, account *Account, rates *Rates, state *AlertState, now time.Time, notifyResolved bool) []Alert {
+	state.Samples = append(state.Samples, AccountSnapshot{
+		Time:           now.UTC(),
+		TotalValue:     account.TotalValue,
+		InterestEarned: account.InterestEarned,
+		RealtimeAPY:    account.RealtimeAPY,
+	})
+	pruneSamples(state, rules, now)
+
+	var alerts []Alert
+	for _, rule := range rules {
+		if rule.Metric == MetricWithdrawalUnlocked {
+			alerts = append(alerts, unlockedWithdrawals(rule, account, state, now)...)
+			continue
+		}
+
+		value, label, ok := ruleValue(rule, account, rates, state, now)
+		if !ok {
+			continue
+		}
+
+		firing := compare(value, rule.Op, rule.Value)
+		wasFiring := state.Firing[rule.Name]
+
+		switch {
+		case firing && !wasFiring:
+			alerts = append(alerts, Alert{
+				Rule:    rule.Name,
+				Message: fmt.Sprintf("%s: %s is %.4g (%s %g)", rule.Name, label, value, rule.Op, rule.Value),
+				Value:   value,
+				Time:    now,
+				key:     rule.Name,
+			})
+		case !firing && wasFiring && notifyResolved:
+			alerts = append(alerts, Alert{
+				Rule:     rule.Name,
+				Message:  fmt.Sprintf("%s resolved: %s is %.4g", rule.Name, label, value),
+				Value:    value,
+				Resolved: true,
+				Time:     now,
+				key:      rule.Name,
+			})
+		case !firing && wasFiring:
+			delete(state.Firing, rule.Name)
+		}
+	}
+	return alerts
+}
+
+// MarkDelivered records that an alert was sent, so it is not sent again
+// until its rule resolves and fires anew
+func (s *AlertState) MarkDelivered(alert Alert) {
+	switch {
+	case alert.key == alert.Rule && alert.Resolved:
+		delete(s.Firing, alert.Rule)
+	case alert.key == alert.Rule:
+		s.Firing[alert.Rule] = true
+	case alert.key != "":
+		s.Notified[alert.key] = true
+	}
+}
+
+// ruleValue returns the value a rule compares and a human readable label
+func ruleValue(rule AlertRule, account *Account, rates *Rates, state *AlertState, now time.Time) (float64, string, bool) {
+	if rule.Window > 0 {
+		baseline, ok := windowBaseline(state.Samples, now.Add(-rule.Window))
+		if !ok {
+			return 0, "", false
+		}
+		before, current := accountMetric(rule.Metric, baseline), accountMetric(rule.Metric, state.Samples[len(state.Samples)-1])
+		if before == 0 {
+			return 0, "", false
+		}
+		return (current - before) / before * 100, fmt.Sprintf("%s change over %s (%%)", rule.Metric, rule.Window), true
+	}
+
+	switch rule.Metric {
+	case MetricProtocolAllocation:
+		if account.TotalValue == 0 {
+			return 0, "", false
+		}
+		return account.ProtocolValue(rule.Protocol) / account.TotalValue * 100,
+			fmt.Sprintf("%s allocation (%%)", rule.Protocol), true
+	case MetricProtocolAPY:
+		if rates == nil {
+			return 0, "", false
+		}
+		mint := ""
+		if rule.Token != "" {
+			mint = ResolveMint(rule.Token)
+		}
+		for _, rate := range rates.Protocols {
+			if strings.EqualFold(rate.Protocol, rule.Protocol) && (mint == "" || rate.MintAddress == mint) {
+				return rate.APY, fmt.Sprintf("%s %s APY", rule.Protocol, TokenSymbol(rate.MintAddress)), true
+			}
+		}
+		return 0, "", false
+	default:
+		return accountMetric(rule.Metric, state.Samples[len(state.Samples)-1]), rule.Metric, true
+	}
+}
+
+// accountMetric reads an account level metric from a sample
+func accountMetric(metric string, sample AccountSnapshot) float64 {
+	switch metric {
+	case MetricRealtimeAPY:
+		return sample.RealtimeAPY
+	case MetricTotalValue:
+		return sample.TotalValue
+	case MetricInterestEarned:
+		return sample.InterestEarned
+	}
+	return 0
+}
+
+// windowBaseline returns the oldest sample taken at or after since, excluding the latest sample
+func windowBaseline(samples []AccountSnapshot, since time.Time) (AccountSnapshot, bool) {
+	for _, sample := range samples[:len(samples)-1] {
+		if !sample.Time.Before(since) {
+			return sample, true
+		}
+	}
+	return AccountSnapshot{}, false
+}
+
+// pruneSamples drops samples older than the longest rule window
+func pruneSamples(state *AlertState, rules []AlertRule, now time.Time) {
+	var longest time.Duration
+	for _, rule := range rules {
+		if rule.Window > longest {
+			longest = rule.Window
+		}
+	}
+	cutoff := now.Add(-longest)
+	kept := state.Samples[:0]
+	for _, sample := range state.Samples {
+		if !sample.Time.Before(cutoff) {
+			kept = append(kept, sample)
+		}
+	}
+	state.Samples = kept
+}
+
+// unlockedWithdrawals alerts once for every pending withdrawal past its unlock time
+func unlockedWithdrawals(rule AlertRule, account *Account, state *AlertState, now time.Time) []Alert {
+	var alerts []Alert
+	for _, withdrawal := range account.PendingWithdrawals {
+		key := rule.Name + ":" + withdrawal.WithdrawalID
+		if state.Notified[key] || now.Unix() < withdrawal.UnlockTime {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Rule: rule.Name,
+			Message: fmt.Sprintf("%s: pending withdrawal of %g %s is unlocked",
+				rule.Name, withdrawal.Amount, TokenSymbol(withdrawal.MintAddress)),
+			Value: withdrawal.Amount,
+			Time:  now,
+			key:   key,
+		})
+	}
+	return alerts
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	}
+	return false
+}
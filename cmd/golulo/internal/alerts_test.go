@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func newAlertState(t *testing.T) *AlertState {
+	t.Helper()
+	state, err := LoadAlertState(filepath.Join(t.TempDir(), "alerts.json"), solana.PublicKey{})
+	if err != nil {
+		t.Fatalf("LoadAlertState: %v", err)
+	}
+	return state
+}
+
+func TestEvaluateAlertsThreshold(t *testing.T) {
+	rules := []AlertRule{{Name: "low-apy", Metric: MetricRealtimeAPY, Op: "<", Value: 5}}
+	state := newAlertState(t)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	evaluate := func(apy float64) []Alert {
+		now = now.Add(time.Minute)
+		return EvaluateAlerts(rules, &Account{RealtimeAPY: apy}, nil, state, now, true)
+	}
+
+	if alerts := evaluate(6); len(alerts) != 0 {
+		t.Fatalf("alerts above threshold: %+v", alerts)
+	}
+
+	alerts := evaluate(4)
+	if len(alerts) != 1 || alerts[0].Rule != "low-apy" || alerts[0].Resolved || alerts[0].Value != 4 {
+		t.Fatalf("alerts = %+v, want low-apy firing", alerts)
+	}
+	// Not delivered, so the next evaluation returns it again
+	if again := evaluate(4); len(again) != 1 {
+		t.Fatalf("undelivered alert not retried: %+v", again)
+	}
+	state.MarkDelivered(alerts[0])
+	if again := evaluate(3); len(again) != 0 {
+		t.Fatalf("delivered alert fired again: %+v", again)
+	}
+
+	resolved := evaluate(7)
+	if len(resolved) != 1 || !resolved[0].Resolved {
+		t.Fatalf("alerts = %+v, want low-apy resolved", resolved)
+	}
+	state.MarkDelivered(resolved[0])
+	if state.Firing["low-apy"] {
+		t.Error("rule still firing after its resolution was delivered")
+	}
+	if again := evaluate(7); len(again) != 0 {
+		t.Fatalf("resolved alert sent again: %+v", again)
+	}
+}
+
+func TestEvaluateAlertsResolvedWithoutNotification(t *testing.T) {
+	rules := []AlertRule{{Name: "low-apy", Metric: MetricRealtimeAPY, Op: "<", Value: 5}}
+	state := newAlertState(t)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	alerts := EvaluateAlerts(rules, &Account{RealtimeAPY: 4}, nil, state, now, false)
+	state.MarkDelivered(alerts[0])
+	if resolved := EvaluateAlerts(rules, &Account{RealtimeAPY: 6}, nil, state, now.Add(time.Minute), false); len(resolved) != 0 {
+		t.Fatalf("alerts = %+v, want no resolved notification", resolved)
+	}
+	// The rule re-arms, so the next incident alerts again
+	if again := EvaluateAlerts(rules, &Account{RealtimeAPY: 4}, nil, state, now.Add(2*time.Minute), false); len(again) != 1 {
+		t.Fatalf("alerts = %+v, want the new incident", again)
+	}
+}
+
+func TestEvaluateAlertsWindow(t *testing.T) {
+	rules := []AlertRule{{Name: "value-drop", Metric: MetricTotalValue, Op: "<", Value: -1, Window: time.Hour}}
+	state := newAlertState(t)
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		offset time.Duration
+		value  float64
+		fires  bool
+	}{
+		{offset: 0, value: 1000},                               // no baseline yet
+		{offset: 30 * time.Minute, value: 995},                 // -0.5% since 12:00
+		{offset: time.Hour, value: 985, fires: true},           // -1.5% since 12:00, still in the window
+		{offset: 90 * time.Minute, value: 990, fires: false},   // baseline is now 12:30 (995), -0.5%
+		{offset: 150 * time.Minute, value: 1000, fires: false}, // baseline 13:30 (990), up
+	}
+	for _, step := range steps {
+		alerts := EvaluateAlerts(rules, &Account{TotalValue: step.value}, nil, state, start.Add(step.offset), false)
+		for _, alert := range alerts {
+			state.MarkDelivered(alert)
+		}
+		if fired := len(alerts) > 0; fired != step.fires {
+			t.Errorf("at +%s value %g: alerts = %+v, want firing %v", step.offset, step.value, alerts, step.fires)
+		}
+	}
+	if state.Firing["value-drop"] {
+		t.Error("value-drop still firing after the value recovered")
+	}
+}
+
+func TestEvaluateAlertsWithdrawalUnlocked(t *testing.T) {
+	rules := []AlertRule{{Name: "unlocked", Metric: MetricWithdrawalUnlocked}}
+	state := newAlertState(t)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	account := &Account{PendingWithdrawals: []PendingWithdrawal{
+		{WithdrawalID: "1", MintAddress: ResolveMint("USDC"), Amount: 10, UnlockTime: now.Add(-time.Minute).Unix()},
+		{WithdrawalID: "2", MintAddress: ResolveMint("USDC"), Amount: 20, UnlockTime: now.Add(time.Hour).Unix()},
+	}}
+
+	alerts := EvaluateAlerts(rules, account, nil, state, now, false)
+	if len(alerts) != 1 || alerts[0].Value != 10 {
+		t.Fatalf("alerts = %+v, want the unlocked withdrawal only", alerts)
+	}
+	state.MarkDelivered(alerts[0])
+	if !state.Notified["unlocked:1"] || state.Firing["unlocked"] {
+		t.Errorf("state after delivery = %+v", state)
+	}
+	alerts = EvaluateAlerts(rules, account, nil, state, now.Add(2*time.Hour), false)
+	if len(alerts) != 1 || alerts[0].Value != 20 {
+		t.Fatalf("alerts = %+v, want the second withdrawal once it unlocks", alerts)
+	}
+}
+
+func TestWindowBaseline(t *testing.T) {
+	at := func(minutes int) AccountSnapshot {
+		return AccountSnapshot{Time: time.Date(2024, time.March, 1, 12, minutes, 0, 0, time.UTC), TotalValue: float64(minutes)}
+	}
+	samples := []AccountSnapshot{at(0), at(10), at(20), at(30)}
+
+	tests := []struct {
+		since  int
+		want   float64
+		wantOK bool
+	}{
+		{since: 0, want: 0, wantOK: true},
+		{since: 5, want: 10, wantOK: true},
+		{since: 10, want: 10, wantOK: true},
+		{since: 25, wantOK: false}, // only the latest sample is newer
+	}
+	for _, tt := range tests {
+		got, ok := windowBaseline(samples, at(tt.since).Time)
+		if ok != tt.wantOK || (ok && got.TotalValue != tt.want) {
+			t.Errorf("windowBaseline(since 12:%02d) = %v, %v; want %v, %v", tt.since, got.TotalValue, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestPruneSamples(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	newState := func() *AlertState {
+		return &AlertState{Samples: []AccountSnapshot{
+			{Time: now.Add(-3 * time.Hour)},
+			{Time: now.Add(-time.Hour)},
+			{Time: now.Add(-time.Minute)},
+			{Time: now},
+		}}
+	}
+
+	state := newState()
+	pruneSamples(state, []AlertRule{{Window: 30 * time.Minute}, {Window: time.Hour}}, now)
+	if len(state.Samples) != 3 || !state.Samples[0].Time.Equal(now.Add(-time.Hour)) {
+		t.Errorf("kept %v, want the samples of the last hour", state.Samples)
+	}
+
+	state = newState()
+	pruneSamples(state, []AlertRule{{Metric: MetricRealtimeAPY}}, now)
+	if len(state.Samples) != 1 {
+		t.Errorf("kept %d samples without windowed rules, want the latest only", len(state.Samples))
+	}
+}
@@ -0,0 +1,303 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Autopilot actions
+const (
+	AutopilotDeposit    = "deposit"
+	AutopilotWithdraw   = "withdraw"
+	AutopilotSwitchPool = "switch-pool"
+	AutopilotHold       = "hold"
+)
+
+// AutopilotToken configures how autopilot manages a single token
+type AutopilotToken struct {
+	Token        string   `mapstructure:"token"`
+	DepositAbove float64  `mapstructure:"deposit-above"` // deposit wallet balance above this
+	MinLiquid    float64  `mapstructure:"min-liquid"`    // keep at least this in the wallet
+	DailyCap     float64  `mapstructure:"daily-cap"`     // max amount moved per UTC day, 0 for no cap
+	Pools        []string `mapstructure:"pools"`         // candidate pools, empty for all
+	MinSpread    float64  `mapstructure:"min-spread"`    // APY points a pool must lead by to switch
+	Hysteresis   float64  `mapstructure:"hysteresis"`    // extra APY points to switch back to the previous pool
+}
+
+// AutopilotConfig is the `autopilot` section of the config file
+type AutopilotConfig struct {
+	Interval   time.Duration    `mapstructure:"interval"`
+	DryRun     bool             `mapstructure:"dry-run"`
+	KillSwitch string           `mapstructure:"kill-switch"`
+	StateFile  string           `mapstructure:"state-file"`
+	Tokens     []AutopilotToken `mapstructure:"tokens"`
+}
+
+// AutopilotDecision is a single action autopilot decided to take, or not to take
+type AutopilotDecision struct {
+	Token  string  `json:"token"`
+	Mint   string  `json:"mint"`
+	Action string  `json:"action"`
+	Amount float64 `json:"amount,omitempty"`
+	Pool   string  `json:"pool,omitempty"`
+	Reason string  `json:"reason"`
+}
+
+// AutopilotState is persisted between ticks
+type AutopilotState struct {
+	Day          string             `json:"day"`          // UTC day Moved refers to
+	Moved        map[string]float64 `json:"moved"`        // mint -> amount moved today
+	Pools        map[string]string  `json:"pools"`        // mint -> preferred pool
+	PreviousPool map[string]string  `json:"previousPool"` // mint -> pool switched away from
+
+	path string
+}
+
+// DefaultKillSwitch returns the kill switch file used when none is configured
+func DefaultKillSwitch() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(dir, "golulo", "autopilot.stop"), nil
+}
+
+// LoadAutopilotState reads autopilot state from path, or the wallet's default state file when path is empty
+func LoadAutopilotState(path string, wallet solana.PublicKey) (*AutopilotState, error) {
+	if path == "" {
+		var err error
+		if path, err = cacheFile("autopilot", wallet); err != nil {
+			return nil, err
+		}
+	}
+
+	state := &AutopilotState{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read autopilot state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse autopilot state %s: %w", path, err)
+		}
+	}
+	if state.Moved == nil {
+		state.Moved = map[string]float64{}
+	}
+	if state.Pools == nil {
+		state.Pools = map[string]string{}
+	}
+	if state.PreviousPool == nil {
+		state.PreviousPool = map[string]string{}
+	}
+	return state, nil
+}
+
+// Save writes the autopilot state to disk
+func (s *AutopilotState) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode autopilot state: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write autopilot state: %w", err)
+	}
+	return nil
+}
+
+// RecordMove adds an executed amount to today's total for a mint
+func (s *AutopilotState) RecordMove(mint string, amount float64, now time.Time) {
+	s.rollDay(now)
+	s.Moved[mint] += amount
+}
+
+// SwitchPool makes pool the preferred pool of a mint, remembering the pool it
+// replaces for hysteresis
+func (s *AutopilotState) SwitchPool(mint, pool string) {
+	if current := s.Pools[mint]; current != "" && current != pool {
+		s.PreviousPool[mint] = current
+	}
+	s.Pools[mint] = pool
+}
+
+// movedToday returns the amount of a mint moved on the UTC day of now
+func (s *AutopilotState) movedToday(mint string, now time.Time) float64 {
+	if s.Day != now.UTC().Format("2006-01-02") {
+		return 0
+	}
+	return s.Moved[mint]
+}
+
+// rollDay resets the daily totals when a new UTC day starts
+func (s *AutopilotState) rollDay(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if s.Day != day {
+		s.Day = day
+		s.Moved = map[string]float64{}
+	}
+}
+
+// PlanAutopilot decides what to do for one token given its spendable wallet
+// balance, the Lulo account and current rates. At most one transaction is
+// planned per token per tick. Planning does not change state: the caller
+// applies a switch-pool decision with SwitchPool and records moves with
+// RecordMove once they were executed.
+func PlanAutopilot(cfg AutopilotToken, wallet float64, account *Account, rates *Rates, state *AutopilotState, now time.Time) []AutopilotDecision {
+	mint := ResolveMint(cfg.Token)
+	symbol := TokenSymbol(mint)
+
+	var decisions []AutopilotDecision
+	decide := func(action string, amount float64, pool, reason string) {
+		decisions = append(decisions, AutopilotDecision{
+			Token:  symbol,
+			Mint:   mint,
+			Action: action,
+			Amount: amount,
+			Pool:   pool,
+			Reason: reason,
+		})
+	}
+
+	// Pick the preferred pool for new deposits
+	preferred := state.Pools[mint]
+	if pool, reason := choosePool(cfg, mint, rates, state); pool != "" {
+		decide(AutopilotSwitchPool, 0, pool, reason)
+		preferred = pool
+	}
+
+	// Remaining daily allowance
+	remaining := math.Inf(1)
+	if cfg.DailyCap > 0 {
+		remaining = math.Max(0, cfg.DailyCap-state.movedToday(mint, now))
+	}
+	capped := func(action string, amount float64, pool, reason string) {
+		if amount > remaining {
+			if remaining <= 0 {
+				decide(AutopilotHold, amount, pool, fmt.Sprintf("daily cap of %g reached, skipping %s: %s", cfg.DailyCap, action, reason))
+				return
+			}
+			reason = fmt.Sprintf("%s (capped from %g by daily cap)", reason, amount)
+			amount = remaining
+		}
+		decide(action, amount, pool, reason)
+	}
+
+	// Without positions a missing deposit cannot be told from an unreported one
+	if !account.HasPositions() {
+		decide(AutopilotHold, 0, preferred, "the Lulo API returned no positions, deposited amounts are unknown")
+		return decisions
+	}
+
+	deposited := account.DepositedAmount(mint)
+	switch {
+	case wallet < cfg.MinLiquid && deposited > 0:
+		amount := math.Min(cfg.MinLiquid-wallet, deposited)
+		capped(AutopilotWithdraw, amount, cheapestPool(account, mint, rates),
+			fmt.Sprintf("wallet balance %g below liquid buffer %g", wallet, cfg.MinLiquid))
+	case wallet > math.Max(cfg.DepositAbove, cfg.MinLiquid):
+		amount := wallet - math.Max(cfg.DepositAbove, cfg.MinLiquid)
+		capped(AutopilotDeposit, amount, preferred,
+			fmt.Sprintf("wallet balance %g above threshold %g", wallet, math.Max(cfg.DepositAbove, cfg.MinLiquid)))
+	default:
+		// Move positions out of pools we no longer prefer; the funds are
+		// deposited into the preferred pool on a later tick
+		for _, position := range account.Positions {
+			if position.MintAddress != mint || position.Pool == "" || preferred == "" || position.Pool == preferred || position.Amount <= 0 {
+				continue
+			}
+			capped(AutopilotWithdraw, position.Amount, position.Pool,
+				fmt.Sprintf("rebalancing from %s to preferred pool %s", position.Pool, preferred))
+			return decisions
+		}
+		decide(AutopilotHold, 0, preferred, fmt.Sprintf("wallet balance %g within bounds", wallet))
+	}
+	return decisions
+}
+
+// choosePool returns the pool a mint should switch to, or "" to keep the
+// current one. Switching requires the new pool to lead by MinSpread, and
+// switching back to the pool just left additionally requires Hysteresis.
+func choosePool(cfg AutopilotToken, mint string, rates *Rates, state *AutopilotState) (string, string) {
+	if rates == nil {
+		return "", ""
+	}
+
+	apys := map[string]float64{}
+	var best string
+	for _, rate := range rates.Pools {
+		if rate.MintAddress != mint || !poolAllowed(cfg.Pools, rate.Pool) {
+			continue
+		}
+		apys[rate.Pool] = rate.APY
+		if best == "" || rate.APY > apys[best] {
+			best = rate.Pool
+		}
+	}
+	if best == "" {
+		return "", ""
+	}
+
+	current := state.Pools[mint]
+	if _, known := apys[current]; !known {
+		return best, fmt.Sprintf("starting with best pool %s at %.2f%%", best, apys[best])
+	}
+	if best == current {
+		return "", ""
+	}
+
+	spread := apys[best] - apys[current]
+	required := cfg.MinSpread
+	if best == state.PreviousPool[mint] {
+		required += cfg.Hysteresis
+	}
+	if spread < required {
+		return "", ""
+	}
+	return best, fmt.Sprintf("%s leads %s by %.2f APY points (required %.2f)", best, current, spread, required)
+}
+
+// cheapestPool returns the pool of the lowest yielding position of a mint
+func cheapestPool(account *Account, mint string, rates *Rates) string {
+	pool := ""
+	lowest := math.Inf(1)
+	for _, position := range account.Positions {
+		if position.MintAddress != mint || position.Pool == "" {
+			continue
+		}
+		apy := math.Inf(1)
+		if rates != nil {
+			for _, rate := range rates.Pools {
+				if rate.MintAddress == mint && rate.Pool == position.Pool {
+					apy = rate.APY
+				}
+			}
+		}
+		if pool == "" || apy < lowest {
+			pool, lowest = position.Pool, apy
+		}
+	}
+	return pool
+}
+
+func poolAllowed(pools []string, pool string) bool {
+	if len(pools) == 0 {
+		return true
+	}
+	for _, p := range pools {
+		if strings.EqualFold(p, pool) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestPlanAutopilot(t *testing.T) {
+	usdc := ResolveMint("USDC")
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	today := now.Format("2006-01-02")
+	rates := func(protected, boosted float64) *Rates {
+		return &Rates{Pools: []PoolRate{
+			{Pool: "protected", MintAddress: usdc, APY: protected},
+			{Pool: "boosted", MintAddress: usdc, APY: boosted},
+		}}
+	}
+	position := func(pool string, amount float64) AccountPosition {
+		return AccountPosition{MintAddress: usdc, Pool: pool, Amount: amount}
+	}
+
+	tests := []struct {
+		name      string
+		cfg       AutopilotToken
+		wallet    float64
+		positions []AccountPosition
+		rates     *Rates
+		state     AutopilotState
+		want      []AutopilotDecision // Token, Mint and Reason are not compared
+	}{
+		{
+			name:      "deposit above threshold into the best pool",
+			cfg:       AutopilotToken{Token: "USDC", DepositAbove: 100, MinLiquid: 50},
+			wallet:    250,
+			positions: []AccountPosition{},
+			rates:     rates(5, 6),
+			want: []AutopilotDecision{
+				{Action: AutopilotSwitchPool, Pool: "boosted"},
+				{Action: AutopilotDeposit, Amount: 150, Pool: "boosted"},
+			},
+		},
+		{
+			name:      "hold within bounds",
+			cfg:       AutopilotToken{Token: "USDC", DepositAbove: 100, MinLiquid: 50, MinSpread: 0.5},
+			wallet:    80,
+			positions: []AccountPosition{position("protected", 500)},
+			rates:     rates(5, 5.2),
+			state:     AutopilotState{Pools: map[string]string{usdc: "protected"}},
+			want:      []AutopilotDecision{{Action: AutopilotHold, Pool: "protected"}},
+		},
+		{
+			name:      "no switch below min spread",
+			cfg:       AutopilotToken{Token: "USDC", MinSpread: 0.5},
+			positions: []AccountPosition{position("protected", 500)},
+			rates:     rates(5, 5.4),
+			state:     AutopilotState{Pools: map[string]string{usdc: "protected"}},
+			want:      []AutopilotDecision{{Action: AutopilotHold, Pool: "protected"}},
+		},
+		{
+			name:      "switch past min spread and rebalance",
+			cfg:       AutopilotToken{Token: "USDC", MinSpread: 0.5},
+			positions: []AccountPosition{position("protected", 500)},
+			rates:     rates(5, 5.6),
+			state:     AutopilotState{Pools: map[string]string{usdc: "protected"}},
+			want: []AutopilotDecision{
+				{Action: AutopilotSwitchPool, Pool: "boosted"},
+				{Action: AutopilotWithdraw, Amount: 500, Pool: "protected"},
+			},
+		},
+		{
+			name:      "hysteresis holds back switching to the previous pool",
+			cfg:       AutopilotToken{Token: "USDC", MinSpread: 0.5, Hysteresis: 0.5},
+			positions: []AccountPosition{position("boosted", 500)},
+			rates:     rates(5.8, 5),
+			state: AutopilotState{
+				Pools:        map[string]string{usdc: "boosted"},
+				PreviousPool: map[string]string{usdc: "protected"},
+			},
+			want: []AutopilotDecision{{Action: AutopilotHold, Pool: "boosted"}},
+		},
+		{
+			name:      "switch back to the previous pool past min spread and hysteresis",
+			cfg:       AutopilotToken{Token: "USDC", MinSpread: 0.5, Hysteresis: 0.5},
+			positions: []AccountPosition{position("boosted", 500)},
+			rates:     rates(6.1, 5),
+			state: AutopilotState{
+				Pools:        map[string]string{usdc: "boosted"},
+				PreviousPool: map[string]string{usdc: "protected"},
+			},
+			want: []AutopilotDecision{
+				{Action: AutopilotSwitchPool, Pool: "protected"},
+				{Action: AutopilotWithdraw, Amount: 500, Pool: "boosted"},
+			},
+		},
+		{
+			name:      "candidate pools limit the choice",
+			cfg:       AutopilotToken{Token: "USDC", Pools: []string{"protected"}},
+			positions: []AccountPosition{},
+			rates:     rates(5, 9),
+			want: []AutopilotDecision{
+				{Action: AutopilotSwitchPool, Pool: "protected"},
+				{Action: AutopilotHold, Pool: "protected"},
+			},
+		},
+		{
+			name:      "withdraw from the cheapest pool to refill the buffer",
+			cfg:       AutopilotToken{Token: "USDC", MinLiquid: 100},
+			wallet:    30,
+			positions: []AccountPosition{position("boosted", 500), position("protected", 500)},
+			rates:     rates(5, 6),
+			state:     AutopilotState{Pools: map[string]string{usdc: "boosted"}},
+			want:      []AutopilotDecision{{Action: AutopilotWithdraw, Amount: 70, Pool: "protected"}},
+		},
+		{
+			name:      "daily cap limits the amount",
+			cfg:       AutopilotToken{Token: "USDC", DailyCap: 100},
+			wallet:    250,
+			positions: []AccountPosition{},
+			state:     AutopilotState{Day: today, Moved: map[string]float64{usdc: 40}},
+			want:      []AutopilotDecision{{Action: AutopilotDeposit, Amount: 60}},
+		},
+		{
+			name:      "daily cap reached",
+			cfg:       AutopilotToken{Token: "USDC", DailyCap: 100},
+			wallet:    250,
+			positions: []AccountPosition{},
+			state:     AutopilotState{Day: today, Moved: map[string]float64{usdc: 100}},
+			want:      []AutopilotDecision{{Action: AutopilotHold, Amount: 250}},
+		},
+		{
+			name:      "daily cap resets on a new day",
+			cfg:       AutopilotToken{Token: "USDC", DailyCap: 100},
+			wallet:    50,
+			positions: []AccountPosition{},
+			state:     AutopilotState{Day: "2024-02-29", Moved: map[string]float64{usdc: 100}},
+			want:      []AutopilotDecision{{Action: AutopilotDeposit, Amount: 50}},
+		},
+		{
+			name:   "hold without positions",
+			cfg:    AutopilotToken{Token: "USDC", MinLiquid: 100},
+			wallet: 30,
+			want:   []AutopilotDecision{{Action: AutopilotHold}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.state
+			if state.Moved == nil {
+				state.Moved = map[string]float64{}
+			}
+			if state.Pools == nil {
+				state.Pools = map[string]string{}
+			}
+			if state.PreviousPool == nil {
+				state.PreviousPool = map[string]string{}
+			}
+			before := state.Pools[usdc]
+
+			account := &Account{Positions: tt.positions}
+			got := PlanAutopilot(tt.cfg, tt.wallet, account, tt.rates, &state, now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("decisions = %+v, want %+v", got, tt.want)
+			}
+			for i, decision := range got {
+				want := tt.want[i]
+				if decision.Action != want.Action || decision.Amount != want.Amount || decision.Pool != want.Pool {
+					t.Errorf("decision %d = %s %g %q (%s), want %s %g %q",
+						i, decision.Action, decision.Amount, decision.Pool, decision.Reason, want.Action, want.Amount, want.Pool)
+				}
+				if decision.Mint != usdc || decision.Reason == "" {
+					t.Errorf("decision %d = %+v, want the USDC mint and a reason", i, decision)
+				}
+			}
+			if state.Pools[usdc] != before {
+				t.Errorf("planning changed the preferred pool from %q to %q", before, state.Pools[usdc])
+			}
+		})
+	}
+}
+
+func TestAutopilotStateApply(t *testing.T) {
+	usdc := ResolveMint("USDC")
+	state, err := LoadAutopilotState(filepath.Join(t.TempDir(), "autopilot.json"), solana.PublicKey{})
+	if err != nil {
+		t.Fatalf("LoadAutopilotState: %v", err)
+	}
+	now := time.Date(2024, time.March, 1, 23, 0, 0, 0, time.UTC)
+
+	state.SwitchPool(usdc, "protected")
+	state.SwitchPool(usdc, "boosted")
+	if state.Pools[usdc] != "boosted" || state.PreviousPool[usdc] != "protected" {
+		t.Errorf("pools = %v, previous = %v", state.Pools, state.PreviousPool)
+	}
+
+	state.RecordMove(usdc, 40, now)
+	state.RecordMove(usdc, 20, now)
+	if got := state.movedToday(usdc, now); got != 60 {
+		t.Errorf("moved today = %g, want 60", got)
+	}
+	if got := state.movedToday(usdc, now.Add(2*time.Hour)); got != 0 {
+		t.Errorf("moved the next day = %g, want 0", got)
+	}
+
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadAutopilotState(state.path, solana.PublicKey{})
+	if err != nil {
+		t.Fatalf("LoadAutopilotState: %v", err)
+	}
+	if loaded.Pools[usdc] != "boosted" || loaded.movedToday(usdc, now) != 60 {
+		t.Errorf("loaded state = %+v", loaded)
+	}
+}
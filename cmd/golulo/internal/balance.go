@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// TokenBalance represents the wallet balance of a single mint
+type TokenBalance struct {
+	Mint      string `json:"mint"`
+	Symbol    string `json:"symbol"`
+	Decimals  uint8  `json:"decimals"`
+	Amount    uint64 `json:"amount"`
+	ProgramID string `json:"programId,omitempty"`
+	Native    bool   `json:"native,omitempty"`
+}
+
+// UIAmount returns the balance in whole token units
+func (b TokenBalance) UIAmount() float64 {
+	return UIAmount(b.Amount, b.Decimals)
+}
+
+// parsedTokenAccount mirrors the jsonParsed layout of an SPL token account
+type parsedTokenAccount struct {
+	Parsed struct {
+		Info struct {
+			Mint        string `json:"mint"`
+			TokenAmount struct {
+				Amount   string `json:"amount"`
+				Decimals uint8  `json:"decimals"`
+			} `json:"tokenAmount"`
+		} `json:"info"`
+	} `json:"parsed"`
+}
+
+// GetSOLBalance returns the native SOL balance of the wallet in lamports
+func (c *SolanaClient) GetSOLBalance(ctx context.Context) (uint64, error) {
+	out, err := c.RpcClient.GetBalance(ctx, c.PublicKey, rpc.CommitmentConfirmed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get SOL balance: %w", err)
+	}
+	return out.Value, nil
+}
+
+// GetTokenBalances returns the SPL Token and Token-2022 balances of the wallet, one entry per mint
+func (c *SolanaClient) GetTokenBalances(ctx context.Context) ([]TokenBalance, error) {
+	byMint := map[string]*TokenBalance{}
+	for _, programID := range []solana.PublicKey{solana.TokenProgramID, solana.Token2022ProgramID} {
+		out, err := c.RpcClient.GetTokenAccountsByOwner(ctx, c.PublicKey,
+			&rpc.GetTokenAccountsConfig{ProgramId: programID.ToPointer()},
+			&rpc.GetTokenAccountsOpts{Commitment: rpc.CommitmentConfirmed, Encoding: solana.EncodingJSONParsed},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token accounts: %w", err)
+		}
+
+		for _, account := range out.Value {
+			var parsed parsedTokenAccount
+			if err := json.Unmarshal(account.Account.Data.GetRawJSON(), &parsed); err != nil {
+				return nil, fmt.Errorf("failed to parse token account %s: %w", account.Pubkey, err)
+			}
+			info := parsed.Parsed.Info
+			raw, err := strconv.ParseUint(info.TokenAmount.Amount, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount for token account %s: %w", account.Pubkey, err)
+			}
+
+			// A wallet may hold several accounts for the same mint
+			if existing, ok := byMint[info.Mint]; ok {
+				existing.Amount += raw
+				continue
+			}
+			symbol := TokenSymbol(info.Mint)
+			if info.Mint == NativeSOL.Mint {
+				symbol = "wSOL"
+			}
+			byMint[info.Mint] = &TokenBalance{
+				Mint:      info.Mint,
+				Symbol:    symbol,
+				Decimals:  info.TokenAmount.Decimals,
+				Amount:    raw,
+				ProgramID: programID.String(),
+			}
+		}
+	}
+
+	balances := make([]TokenBalance, 0, len(byMint))
+	for _, balance := range byMint {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Symbol < balances[j].Symbol
+	})
+	return balances, nil
+}
+
+// GetBalances returns native SOL followed by all token balances of the wallet
+func (c *SolanaClient) GetBalances(ctx context.Context) ([]TokenBalance, error) {
+	lamports, err := c.GetSOLBalance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := c.GetTokenBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []TokenBalance{{
+		Mint:     NativeSOL.Mint,
+		Symbol:   NativeSOL.Symbol,
+		Decimals: NativeSOL.Decimals,
+		Amount:   lamports,
+		Native:   true,
+	}}
+	return append(balances, tokens...), nil
+}
+
+// solFeeReserve is kept back from native SOL deposits to pay transaction and priority fees
+const solFeeReserve = 10_000_000 // 0.01 SOL
+
+// tokenAccountSize is the size of an SPL token account, used for rent calculation
+const tokenAccountSize = 165
+
+// GetSpendableBalance returns the wallet balance of a mint that can be deposited.
+// For native SOL it includes wrapped SOL and keeps back enough lamports for the
+// wSOL account rent and transaction fees.
+func (c *SolanaClient) GetSpendableBalance(ctx context.Context, mint string) (TokenBalance, error) {
+	tokens, err := c.GetTokenBalances(ctx)
+	if err != nil {
+		return TokenBalance{}, err
+	}
+
+	balance := TokenBalance{Mint: mint, Symbol: TokenSymbol(mint)}
+	if info, ok := LookupToken(mint); ok {
+		balance.Decimals = info.Decimals
+	}
+	for _, token := range tokens {
+		if token.Mint == mint {
+			balance = token
+			break
+		}
+	}
+
+	if mint != NativeSOL.Mint {
+		return balance, nil
+	}
+
+	lamports, err := c.GetSOLBalance(ctx)
+	if err != nil {
+		return TokenBalance{}, err
+	}
+	rent, err := c.RpcClient.GetMinimumBalanceForRentExemption(ctx, tokenAccountSize, rpc.CommitmentConfirmed)
+	if err != nil {
+		return TokenBalance{}, fmt.Errorf("failed to get rent exemption: %w", err)
+	}
+
+	reserve := rent + solFeeReserve
+	if lamports > reserve {
+		balance.Amount += lamports - reserve
+	}
+	balance.Symbol = NativeSOL.Symbol
+	balance.Decimals = NativeSOL.Decimals
+	balance.Native = true
+	return balance, nil
+}
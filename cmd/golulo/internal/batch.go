@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Batch actions
+const (
+	BatchDeposit  = "deposit"
+	BatchWithdraw = "withdraw"
+)
+
+// Batch operation statuses
+const (
+	BatchPending = "pending"
+	BatchSending = "sending" // transactions may be in flight, never retried automatically
+	BatchPartial = "partial" // some transactions were sent before a failure
+	BatchFailed  = "failed"  // nothing was sent, safe to retry
+	BatchDone    = "done"
+)
+
+// BatchOperation is a single deposit or withdrawal in a batch plan. Amount is
+// a token amount, a percentage, "max" for a deposit of the whole wallet
+// balance or "all" for a withdrawal of everything deposited.
+type BatchOperation struct {
+	ID     string `mapstructure:"id" json:"id"`
+	Wallet string `mapstructure:"wallet" json:"wallet,omitempty"` // address or profile, default wallet when empty
+	Action string `mapstructure:"action" json:"action"`
+	Token  string `mapstructure:"token" json:"token"`
+	Amount string `mapstructure:"amount" json:"amount"`
+	Pool   string `mapstructure:"pool" json:"pool,omitempty"`
+}
+
+// BatchPlan is a list of operations read from a YAML or JSON manifest
+type BatchPlan struct {
+	Path       string
+	Operations []BatchOperation
+}
+
+// BatchOperationState is the persisted outcome of one operation
+type BatchOperationState struct {
+	Operation  BatchOperation `json:"operation"`
+	Status     string         `json:"status"`
+	Wallet     string         `json:"wallet,omitempty"` // resolved address
+	Amount     string         `json:"amount,omitempty"` // resolved amount sent to the API
+	Signatures []string       `json:"signatures,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	UpdatedAt  time.Time      `json:"updatedAt"`
+}
+
+// BatchState tracks the progress of applying a plan so it can be resumed
+type BatchState struct {
+	Plan       string                          `json:"plan"`
+	Operations map[string]*BatchOperationState `json:"operations"`
+
+	path string
+}
+
+// LoadBatchPlan reads and validates a plan. Operations without an ID are
+// numbered by position.
+func LoadBatchPlan(path string) (*BatchPlan, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+
+	plan := &BatchPlan{Path: path}
+	if err := v.UnmarshalKey("operations", &plan.Operations); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if len(plan.Operations) == 0 {
+		return nil, fmt.Errorf("plan %s has no operations", path)
+	}
+
+	seen := map[string]bool{}
+	for i := range plan.Operations {
+		op := &plan.Operations[i]
+		if op.ID == "" {
+			op.ID = fmt.Sprintf("op-%d", i+1)
+		}
+		if seen[op.ID] {
+			return nil, fmt.Errorf("duplicate operation id %q", op.ID)
+		}
+		seen[op.ID] = true
+
+		op.Action = strings.ToLower(op.Action)
+		if err := op.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// Validate checks that an operation is complete
+func (op BatchOperation) Validate() error {
+	switch op.Action {
+	case BatchDeposit:
+		if strings.EqualFold(op.Amount, "all") {
+			return fmt.Errorf("operation %s: use max to deposit the whole wallet balance", op.ID)
+		}
+	case BatchWithdraw:
+		if strings.EqualFold(op.Amount, "max") {
+			return fmt.Errorf("operation %s: use all to withdraw everything", op.ID)
+		}
+	default:
+		return fmt.Errorf("operation %s: unknown action %q", op.ID, op.Action)
+	}
+	if op.Token == "" {
+		return fmt.Errorf("operation %s: token is required", op.ID)
+	}
+	if op.Amount == "" {
+		return fmt.Errorf("operation %s: amount is required", op.ID)
+	}
+	return nil
+}
+
+// DefaultBatchStatePath is the state file used for a plan unless one is given
+func DefaultBatchStatePath(planPath string) string {
+	return strings.TrimSuffix(planPath, filepath.Ext(planPath)) + ".state.json"
+}
+
+// LoadBatchState reads the state of a plan, creating pending entries for new
+// operations. It fails if an operation that already ran has since changed.
+func LoadBatchState(path string, plan *BatchPlan) (*BatchState, error) {
+	state := &BatchState{Operations: map[string]*BatchOperationState{}, path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read batch state: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse batch state %s: %w", path, err)
+		}
+		if state.Operations == nil {
+			state.Operations = map[string]*BatchOperationState{}
+		}
+	}
+
+	if abs, err := filepath.Abs(plan.Path); err == nil {
+		state.Plan = abs
+	}
+	for _, op := range plan.Operations {
+		opState, ok := state.Operations[op.ID]
+		if !ok || (opState.Status == BatchPending && opState.Operation != op) {
+			state.Operations[op.ID] = &BatchOperationState{Operation: op, Status: BatchPending}
+			continue
+		}
+		if opState.Operation != op {
+			return nil, fmt.Errorf("operation %s changed after it was applied (%s); use a new state file", op.ID, opState.Status)
+		}
+	}
+	return state, nil
+}
+
+// Save writes the state to disk, replacing the file atomically
+func (s *BatchState) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write batch state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write batch state: %w", err)
+	}
+	return nil
+}
+
+// Path returns the state file location
+func (s *BatchState) Path() string {
+	return s.path
+}
+
+// Update sets the status of an operation and saves the state
+func (s *BatchState) Update(id, status string, update func(*BatchOperationState)) error {
+	opState := s.Operations[id]
+	opState.Status = status
+	opState.UpdatedAt = time.Now().UTC()
+	if update != nil {
+		update(opState)
+	}
+	return s.Save()
+}
+
+// Runnable reports whether an operation should be executed on this run.
+// Operations that may have sent transactions are only retried when forced.
+func (s *BatchState) Runnable(id string, retryPartial bool) bool {
+	switch s.Operations[id].Status {
+	case BatchPending, BatchFailed:
+		return true
+	case BatchSending, BatchPartial:
+		return retryPartial
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePlan writes a YAML plan into dir and loads it
+func writePlan(t *testing.T, dir, yaml string) *BatchPlan {
+	t.Helper()
+	path := filepath.Join(dir, "plan.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := LoadBatchPlan(path)
+	if err != nil {
+		t.Fatalf("LoadBatchPlan: %v", err)
+	}
+	return plan
+}
+
+const testPlan = `operations:
+  - id: fund
+    action: Deposit
+    token: USDC
+    amount: "100"
+  - action: withdraw
+    token: SOL
+    amount: all
+  - action: deposit
+    token: USDC
+    amount: 50%
+    pool: protected
+`
+
+func TestLoadBatchPlan(t *testing.T) {
+	plan := writePlan(t, t.TempDir(), testPlan)
+	want := []BatchOperation{
+		{ID: "fund", Action: BatchDeposit, Token: "USDC", Amount: "100"},
+		{ID: "op-2", Action: BatchWithdraw, Token: "SOL", Amount: "all"},
+		{ID: "op-3", Action: BatchDeposit, Token: "USDC", Amount: "50%", Pool: "protected"},
+	}
+	if len(plan.Operations) != len(want) {
+		t.Fatalf("operations = %+v", plan.Operations)
+	}
+	for i, op := range plan.Operations {
+		if op != want[i] {
+			t.Errorf("operation %d = %+v, want %+v", i, op, want[i])
+		}
+	}
+
+	invalid := []struct {
+		yaml string
+		want string
+	}{
+		{yaml: "operations: []\n", want: "no operations"},
+		{yaml: "operations:\n  - {id: a, action: deposit, token: USDC, amount: '1'}\n  - {id: a, action: deposit, token: USDC, amount: '2'}\n", want: "duplicate"},
+		{yaml: "operations:\n  - {action: swap, token: USDC, amount: '1'}\n", want: "unknown action"},
+		{yaml: "operations:\n  - {action: deposit, amount: '1'}\n", want: "token is required"},
+		{yaml: "operations:\n  - {action: deposit, token: USDC}\n", want: "amount is required"},
+		{yaml: "operations:\n  - {action: deposit, token: USDC, amount: all}\n", want: "use max"},
+		{yaml: "operations:\n  - {action: withdraw, token: USDC, amount: max}\n", want: "use all"},
+	}
+	for _, tt := range invalid {
+		path := filepath.Join(t.TempDir(), "plan.yaml")
+		if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadBatchPlan(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadBatchPlan(%q) error = %v, want %q", tt.yaml, err, tt.want)
+		}
+	}
+}
+
+func TestBatchStateResume(t *testing.T) {
+	dir := t.TempDir()
+	plan := writePlan(t, dir, testPlan)
+	statePath := DefaultBatchStatePath(plan.Path)
+	if statePath != filepath.Join(dir, "plan.state.json") {
+		t.Errorf("DefaultBatchStatePath = %s", statePath)
+	}
+
+	state, err := LoadBatchState(statePath, plan)
+	if err != nil {
+		t.Fatalf("LoadBatchState: %v", err)
+	}
+	for _, op := range plan.Operations {
+		if status := state.Operations[op.ID].Status; status != BatchPending {
+			t.Errorf("new operation %s is %s, want pending", op.ID, status)
+		}
+	}
+
+	// First run: done, partial, failed
+	if err := state.Update("fund", BatchDone, func(s *BatchOperationState) { s.Signatures = []string{"sig1"} }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := state.Update("op-2", BatchPartial, func(s *BatchOperationState) { s.Signatures = []string{"sig2"}; s.Error = "second transaction failed" }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := state.Update("op-3", BatchFailed, func(s *BatchOperationState) { s.Error = "rpc unreachable" }); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := os.Stat(statePath + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary state file left behind: %v", err)
+	}
+
+	// Resume from disk
+	resumed, err := LoadBatchState(statePath, writePlan(t, dir, testPlan))
+	if err != nil {
+		t.Fatalf("LoadBatchState on resume: %v", err)
+	}
+	if got := resumed.Operations["op-2"]; got.Status != BatchPartial || len(got.Signatures) != 1 || got.Error == "" {
+		t.Errorf("resumed partial operation = %+v", got)
+	}
+
+	tests := []struct {
+		id           string
+		retryPartial bool
+		want         bool
+	}{
+		{id: "fund", want: false},
+		{id: "fund", retryPartial: true, want: false},
+		{id: "op-2", want: false},
+		{id: "op-2", retryPartial: true, want: true},
+		{id: "op-3", want: true},
+	}
+	for _, tt := range tests {
+		if got := resumed.Runnable(tt.id, tt.retryPartial); got != tt.want {
+			t.Errorf("Runnable(%s, retryPartial %v) = %v, want %v", tt.id, tt.retryPartial, got, tt.want)
+		}
+	}
+
+	// An interrupted run leaves an operation sending, which is never retried on its own
+	if err := resumed.Update("op-3", BatchSending, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	resumed, err = LoadBatchState(statePath, plan)
+	if err != nil {
+		t.Fatalf("LoadBatchState: %v", err)
+	}
+	if resumed.Runnable("op-3", false) || !resumed.Runnable("op-3", true) {
+		t.Error("an operation left sending must only run with retryPartial")
+	}
+}
+
+func TestBatchStateEditedPlan(t *testing.T) {
+	dir := t.TempDir()
+	plan := writePlan(t, dir, testPlan)
+	statePath := filepath.Join(dir, "custom.state.json")
+	state, err := LoadBatchState(statePath, plan)
+	if err != nil {
+		t.Fatalf("LoadBatchState: %v", err)
+	}
+	if err := state.Update("fund", BatchDone, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Editing and adding operations that have not run yet is fine
+	edited := writePlan(t, dir, strings.Replace(testPlan, "amount: 50%", "amount: 25%", 1)+`  - id: extra
+    action: deposit
+    token: SOL
+    amount: "1"
+`)
+	state, err = LoadBatchState(statePath, edited)
+	if err != nil {
+		t.Fatalf("LoadBatchState with edited pending operations: %v", err)
+	}
+	if got := state.Operations["op-3"]; got.Status != BatchPending || got.Operation.Amount != "25%" {
+		t.Errorf("edited pending operation = %+v", got)
+	}
+	if got := state.Operations["extra"]; got == nil || got.Status != BatchPending {
+		t.Errorf("added operation = %+v", got)
+	}
+
+	// Editing one that already ran is refused
+	changed := writePlan(t, dir, strings.Replace(testPlan, `amount: "100"`, `amount: "200"`, 1))
+	if _, err := LoadBatchState(statePath, changed); err == nil || !strings.Contains(err.Error(), "fund changed after it was applied") {
+		t.Errorf("LoadBatchState with an edited done operation = %v", err)
+	}
+
+	// As is one whose run failed part way
+	state, err = LoadBatchState(statePath, plan)
+	if err != nil {
+		t.Fatalf("LoadBatchState: %v", err)
+	}
+	if err := state.Update("op-2", BatchPartial, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	changed = writePlan(t, dir, strings.Replace(testPlan, "token: SOL", "token: USDC", 1))
+	if _, err := LoadBatchState(statePath, changed); err == nil || !strings.Contains(err.Error(), "op-2 changed") {
+		t.Errorf("LoadBatchState with an edited partial operation = %v", err)
+	}
+
+	if _, err := LoadBatchState(filepath.Join(dir, "missing", "state.json"), plan); err != nil {
+		t.Errorf("LoadBatchState without a state file: %v", err)
+	}
+	if err := os.WriteFile(statePath, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBatchState(statePath, plan); err == nil {
+		t.Error("LoadBatchState accepted a corrupt state file")
+	}
+}
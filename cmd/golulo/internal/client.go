@@ -2,39 +2,204 @@ package internal
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"time"
 
-	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
 	"github.com/gagliardetto/solana-go/rpc"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// defaultConfirmPollInterval is how often signature statuses are polled while
+// confirming, unless the client sets its own interval
+const defaultConfirmPollInterval = 2 * time.Second
+
+// DefaultConfirmTimeout is how long to wait for a transaction to be confirmed
+const DefaultConfirmTimeout = 90 * time.Second
+
+// RPC is the part of the Solana RPC API that SolanaClient uses. *rpc.Client
+// implements it; tests use FakeRPC.
+type RPC interface {
+	GetLatestBlockhash(ctx context.Context, commitment rpc.CommitmentType) (*rpc.GetLatestBlockhashResult, error)
+	SendTransactionWithOpts(ctx context.Context, tx *solana.Transaction, opts rpc.TransactionOpts) (solana.Signature, error)
+	SimulateTransactionWithOpts(ctx context.Context, tx *solana.Transaction, opts *rpc.SimulateTransactionOpts) (*rpc.SimulateTransactionResponse, error)
+	GetSignatureStatuses(ctx context.Context, searchTransactionHistory bool, sigs ...solana.Signature) (*rpc.GetSignatureStatusesResult, error)
+	GetBalance(ctx context.Context, account solana.PublicKey, commitment rpc.CommitmentType) (*rpc.GetBalanceResult, error)
+	GetAccountInfoWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetAccountInfoOpts) (*rpc.GetAccountInfoResult, error)
+	GetTokenAccountsByOwner(ctx context.Context, owner solana.PublicKey, conf *rpc.GetTokenAccountsConfig, opts *rpc.GetTokenAccountsOpts) (*rpc.GetTokenAccountsResult, error)
+	GetMinimumBalanceForRentExemption(ctx context.Context, dataSize uint64, commitment rpc.CommitmentType) (uint64, error)
+	GetSignaturesForAddressWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetSignaturesForAddressOpts) ([]*rpc.TransactionSignature, error)
+	GetTransaction(ctx context.Context, sig solana.Signature, opts *rpc.GetTransactionOpts) (*rpc.GetTransactionResult, error)
+}
+
+var _ RPC = (*rpc.Client)(nil)
+
 // SolanaClient wraps RPC client and keypair info
 type SolanaClient struct {
-	RpcClient  *rpc.Client
+	RpcClient  RPC
 	PublicKey  solana.PublicKey
 	PrivateKey solana.PrivateKey
+	Jito       *JitoClient // sends multi-transaction operations as bundles when set
+	Log        *logrus.Entry
+
+	// ConfirmPollInterval is how often ConfirmTransaction polls, 2s when zero
+	ConfirmPollInterval time.Duration
+}
+
+// ErrReadOnly is returned when a read-only client is asked to sign
+var ErrReadOnly = errors.New("client is read-only: signing requires a keypair")
+
+// NewSolanaClient creates a signing client from config values. When --wallet
+// is set it must name a profile with a keypair, or the configured keypair's wallet.
+func NewSolanaClient(log *logrus.Entry) (*SolanaClient, error) {
+	return NewSolanaClientFor(viper.GetString("wallet"), log)
 }
 
-// NewSolanaClient creates a new client from config values
-func NewSolanaClient() (*SolanaClient, error) {
+// NewSolanaClientFor creates a signing client for a wallet address or profile,
+// or for the configured keypair when walletArg is empty. Its logs go to log
+// with the wallet attached.
+func NewSolanaClientFor(walletArg string, log *logrus.Entry) (*SolanaClient, error) {
 	// Get keypair path from config
 	keypairPath := viper.GetString("keypair")
+	if walletArg != "" {
+		var err error
+		if keypairPath, err = signerKeypair(walletArg, keypairPath); err != nil {
+			return nil, err
+		}
+	}
 	if keypairPath == "" {
 		return nil, fmt.Errorf("keypair path not set in config")
 	}
 
+	privateKey, err := LoadKeypair(keypairPath)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := privateKey.PublicKey()
+
+	// Create RPC client
+	log = log.WithField("wallet", publicKey.String())
+	rpcClient, err := NewRPCClient(nil, log)
+	if err != nil {
+		return nil, err
+	}
+
+	jito, err := LoadJitoClient()
+	if err != nil {
+		return nil, err
+	}
+	if jito != nil {
+		jito.Log = log
+	}
+
+	return &SolanaClient{
+		RpcClient:  rpcClient,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Jito:       jito,
+		Log:        log,
+	}, nil
+}
+
+// NewReadOnlyClient creates a client that can read wallet data but not sign.
+// It uses --wallet when set, which may be any address or profile, and
+// otherwise the configured keypair's wallet.
+func NewReadOnlyClient(log *logrus.Entry) (*SolanaClient, error) {
+	return NewReadOnlyClientFor(viper.GetString("wallet"), log)
+}
+
+// NewReadOnlyClientFor creates a read-only client for a wallet address or
+// profile, or for the configured keypair's wallet when walletArg is empty
+func NewReadOnlyClientFor(walletArg string, log *logrus.Entry) (*SolanaClient, error) {
+	var wallet solana.PublicKey
+	if walletArg != "" {
+		_, resolved, err := ResolveWallet(walletArg)
+		if err != nil {
+			return nil, err
+		}
+		wallet = resolved
+	} else {
+		keypairPath := viper.GetString("keypair")
+		if keypairPath == "" {
+			return nil, fmt.Errorf("no wallet: pass --wallet or set a keypair in config")
+		}
+		publicKey, err := KeypairPublicKey(keypairPath)
+		if err != nil {
+			return nil, err
+		}
+		wallet = publicKey
+	}
+
+	log = log.WithField("wallet", wallet.String())
+	rpcClient, err := NewRPCClient(nil, log)
+	if err != nil {
+		return nil, err
+	}
+	return &SolanaClient{
+		RpcClient: rpcClient,
+		PublicKey: wallet,
+		Log:       log,
+	}, nil
+}
+
+// signerKeypair returns the keypair that signs for walletArg: the keypair of
+// the profile it names, or the configured keypair when it is that wallet
+func signerKeypair(walletArg, keypairPath string) (string, error) {
+	name, wallet, err := ResolveWallet(walletArg)
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		profile, _, err := FindProfile(name)
+		if err != nil {
+			return "", err
+		}
+		if profile.Keypair != "" {
+			return profile.Keypair, nil
+		}
+	}
+	if keypairPath != "" {
+		publicKey, err := KeypairPublicKey(keypairPath)
+		if err != nil {
+			return "", err
+		}
+		if publicKey.Equals(wallet) {
+			return keypairPath, nil
+		}
+	}
+	return "", fmt.Errorf("wallet %s is watch-only: signing requires a keypair", wallet)
+}
+
+// ReadOnly reports whether the client has no key to sign with
+func (c *SolanaClient) ReadOnly() bool {
+	return len(c.PrivateKey) == 0
+}
+
+// LoadKeypair reads a keypair file in the Solana CLI JSON array format, or an
+// encrypted keypair file, decrypted with the profile or keypair-passphrase
+func LoadKeypair(path string) (solana.PrivateKey, error) {
 	// Read keypair file
-	keypairBytes, err := os.ReadFile(keypairPath)
+	keypairBytes, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read keypair file: %w", err)
 	}
 
+	if encrypted, ok, err := parseEncryptedKeypair(keypairBytes); ok {
+		if err != nil {
+			return nil, err
+		}
+		passphrase, err := keypairPassphrase(path)
+		if err != nil {
+			return nil, err
+		}
+		return encrypted.Decrypt(passphrase)
+	}
+
 	// Parse JSON array
 	var secretKey []uint8
 	if err := json.Unmarshal(keypairBytes, &secretKey); err != nil {
@@ -42,21 +207,47 @@ func NewSolanaClient() (*SolanaClient, error) {
 	}
 
 	// Convert to Solana private key
-	privateKey := solana.PrivateKey(secretKey)
-	publicKey := privateKey.PublicKey()
+	return solana.PrivateKey(secretKey), nil
+}
 
-	// Create RPC client
-	rpcURL := viper.GetString("rpc-url")
-	if rpcURL == "" {
-		return nil, fmt.Errorf("RPC URL not set in config")
+// KeypairPublicKey returns the public key of a keypair file. Encrypted
+// keypairs store it in the clear, so no passphrase is needed.
+func KeypairPublicKey(path string) (solana.PublicKey, error) {
+	keypairBytes, err := os.ReadFile(path)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("failed to read keypair file: %w", err)
+	}
+	if encrypted, ok, err := parseEncryptedKeypair(keypairBytes); ok && err == nil && encrypted.PublicKey != "" {
+		publicKey, err := solana.PublicKeyFromBase58(encrypted.PublicKey)
+		if err != nil {
+			return solana.PublicKey{}, fmt.Errorf("invalid public key in keypair file: %w", err)
+		}
+		return publicKey, nil
 	}
-	rpcURL += "?api-key=" + viper.GetString("rpc-api-key")
 
-	return &SolanaClient{
-		RpcClient:  rpc.New(rpcURL),
-		PublicKey:  publicKey,
-		PrivateKey: privateKey,
-	}, nil
+	privateKey, err := LoadKeypair(path)
+	if err != nil {
+		return solana.PublicKey{}, err
+	}
+	return privateKey.PublicKey(), nil
+}
+
+// NewRPCClient creates an RPC client over the configured endpoints. When
+// transport is set it carries the HTTP requests, e.g. to record metrics.
+func NewRPCClient(transport http.RoundTripper, log *logrus.Entry) (*rpc.Client, error) {
+	pool, err := NewRPCPool(transport, log)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewWithCustomRPCClient(pool), nil
+}
+
+// log returns the client's logger
+func (c *SolanaClient) log() *logrus.Entry {
+	if c.Log == nil {
+		return standardLogger()
+	}
+	return c.Log
 }
 
 // WalletPubKey returns the client's public key
@@ -84,30 +275,66 @@ func (c *SolanaClient) CreateTransaction(ctx context.Context, instructions []sol
 	return tx, nil
 }
 
-// SignTransaction signs a transaction with the client's private key
+// SignTransaction signs a transaction with the client's private key. Other
+// required signatures, such as those the Lulo API already added, are kept.
 func (c *SolanaClient) SignTransaction(tx *solana.Transaction) (*solana.Transaction, error) {
-	tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+	if c.ReadOnly() {
+		return nil, ErrReadOnly
+	}
+	_, err := tx.PartialSign(func(key solana.PublicKey) *solana.PrivateKey {
 		if key.Equals(c.PublicKey) {
 			return &c.PrivateKey
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 	return tx, nil
 }
 
-// SendTransaction sends a signed transaction
+// SendTransaction sends a signed transaction. Sends are recorded in the sent
+// log carried by ctx.
 func (c *SolanaClient) SendTransaction(ctx context.Context, tx *solana.Transaction) (solana.Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to send transaction: %w", err)
+	}
 	sig, err := c.RpcClient.SendTransactionWithOpts(ctx, tx, rpc.TransactionOpts{
 		SkipPreflight:       false,
 		PreflightCommitment: rpc.CommitmentFinalized,
 	})
 	if err != nil {
+		if ctx.Err() != nil && len(tx.Signatures) > 0 {
+			// The request may have reached the node before it was cancelled
+			recordSent(ctx, SentTransaction{Signature: tx.Signatures[0], Wallet: c.PublicKey, Status: SentUnknown})
+		}
 		return solana.Signature{}, fmt.Errorf("failed to send transaction: %w", err)
 	}
+	recordSent(ctx, SentTransaction{Signature: sig, Wallet: c.PublicKey, Status: SentOK})
 
 	return sig, nil
 }
 
+// SimulateTransaction runs a transaction against the current chain state
+// without sending it. A transaction the node rejects is returned as an error
+// along with the simulation result, whose logs explain why.
+func (c *SolanaClient) SimulateTransaction(ctx context.Context, tx *solana.Transaction) (*rpc.SimulateTransactionResult, error) {
+	out, err := c.RpcClient.SimulateTransactionWithOpts(ctx, tx, &rpc.SimulateTransactionOpts{
+		SigVerify:  len(tx.Signatures) > 0,
+		Commitment: rpc.CommitmentConfirmed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to simulate transaction: %w", err)
+	}
+	if out.Value == nil {
+		return nil, fmt.Errorf("failed to simulate transaction: empty result")
+	}
+	if out.Value.Err != nil {
+		return out.Value, fmt.Errorf("transaction simulation failed: %v", out.Value.Err)
+	}
+	return out.Value, nil
+}
+
 // CreateSignAndSendTransaction combines transaction creation, signing, and sending into one method
 func (c *SolanaClient) CreateSignAndSendTransaction(ctx context.Context, instructions []solana.Instruction) (solana.Signature, error) {
 	// Create transaction
@@ -126,44 +353,100 @@ func (c *SolanaClient) CreateSignAndSendTransaction(ctx context.Context, instruc
 	return c.SendTransaction(ctx, signedTx)
 }
 
-func (c *SolanaClient) HandleB64Transactions(b64_txs []string) error {
-	ctx := context.Background()
-
+// HandleB64Transactions signs and sends base64 encoded transactions from the Lulo API
+// in order. It returns the signatures of all transactions sent, including when a
+// later transaction fails. When Jito bundles are enabled, several transactions are
+// sent as one bundle so they land together or not at all, falling back to sending
+// them one by one when the block engine does not accept the bundle.
+func (c *SolanaClient) HandleB64Transactions(ctx context.Context, b64_txs []string) ([]solana.Signature, error) {
 	blockhash, err := c.RpcClient.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
 	if err != nil {
-		return fmt.Errorf("failed to get latest blockhash: %w", err)
+		return nil, fmt.Errorf("failed to get latest blockhash: %w", err)
 	}
 
+	txs := make([]*solana.Transaction, 0, len(b64_txs))
 	for i, b64_tx := range b64_txs {
-		logger := logrus.WithField("transactionIndex", i)
-
-		// Decode base64 transaction
-		txBytes, err := base64.StdEncoding.DecodeString(b64_tx)
+		tx, err := c.prepareB64Transaction(ctx, i, b64_tx, blockhash.Value.Blockhash)
 		if err != nil {
-			return fmt.Errorf("failed to decode transaction: %w", err)
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
 		}
+		txs = append(txs, tx)
+	}
 
-		// Deserialize the transaction
-		tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(txBytes))
-		if err != nil {
-			return fmt.Errorf("failed to deserialize transaction: %w", err)
+	if c.Jito != nil && len(txs) > 1 {
+		sigs := make([]solana.Signature, 0, len(txs))
+		for _, tx := range txs {
+			sigs = append(sigs, tx.Signatures[0])
+		}
+
+		err := c.sendAsBundle(ctx, txs, blockhash.Value.Blockhash)
+		switch {
+		case err == nil:
+			return sigs, nil
+		case errors.Is(err, ErrBundlesUnavailable):
+			// The same signed transactions are sent instead, so they cannot land twice
+			c.log().WithError(err).Warn("Bundle not accepted, sending transactions one by one")
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			// The bundle may still land, report the signatures so they can be checked
+			return sigs, err
+		default:
+			return nil, err
 		}
+	}
 
-		tx.Message.RecentBlockhash = blockhash.Value.Blockhash
+	return c.sendSequentially(ctx, txs)
+}
 
-		logger.WithFields(logrus.Fields{
-			"requiredSignatures":       tx.Message.Header.NumRequiredSignatures,
-			"readonlySigned":           tx.Message.Header.NumReadonlySignedAccounts,
-			"readonlyUnsigned":         tx.Message.Header.NumReadonlyUnsignedAccounts,
-			"addressTableLookupsCount": len(tx.Message.AddressTableLookups),
-		}).Debug("Transaction details")
-
-		// Create a partially signed transaction
-		// Only sign with our wallet key, ignore other required signatures
-		tx, err = c.SignTransaction(tx)
-		if err != nil {
-			return fmt.Errorf("failed to sign transaction: %w", err)
+// prepareB64Transaction decodes a transaction from the Lulo API, sets the
+// blockhash, logs what it does and signs it with the wallet key
+func (c *SolanaClient) prepareB64Transaction(ctx context.Context, index int, b64_tx string, blockhash solana.Hash) (*solana.Transaction, error) {
+	tx, err := ParseB64Transaction(b64_tx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.Message.RecentBlockhash = blockhash
+
+	c.logSummary(ctx, index, tx)
+
+	// Create a partially signed transaction
+	// Only sign with our wallet key, ignore other required signatures
+	tx, err = c.SignTransaction(tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// logSummary logs the instructions of a transaction about to be signed. A
+// lookup table that cannot be fetched leaves its accounts unresolved, as the
+// summary is informational.
+func (c *SolanaClient) logSummary(ctx context.Context, index int, tx *solana.Transaction) {
+	logger := c.log().WithField("transactionIndex", index)
+	var loaded *rpc.LoadedAddresses
+	if len(tx.Message.AddressTableLookups) > 0 {
+		var err error
+		if loaded, err = ResolveLookupTables(ctx, c.RpcClient, tx); err != nil {
+			logger.WithError(err).Warn("Failed to resolve address lookup tables")
 		}
+	}
+
+	decoded := DecodeTransaction(tx, loaded, c.PublicKey)
+	logger.WithFields(logrus.Fields{
+		"instructions":       decoded.Summary(),
+		"accounts":           len(decoded.Accounts),
+		"writableAccounts":   decoded.WritableAccounts(),
+		"lookupTables":       len(decoded.LookupTables),
+		"requiredSignatures": tx.Message.Header.NumRequiredSignatures,
+	}).Info("Signing transaction")
+}
+
+// sendSequentially sends signed transactions one by one, stopping at the first failure
+func (c *SolanaClient) sendSequentially(ctx context.Context, txs []*solana.Transaction) ([]solana.Signature, error) {
+	sigs := make([]solana.Signature, 0, len(txs))
+
+	for i, tx := range txs {
+		logger := c.log().WithField("transactionIndex", i)
 
 		// Send transaction with preflight checks disabled
 		sig, err := c.SendTransaction(ctx, tx)
@@ -172,13 +455,47 @@ func (c *SolanaClient) HandleB64Transactions(b64_txs []string) error {
 				"signaturesRequired": tx.Message.Header.NumRequiredSignatures,
 				"error":              err,
 			}).Error("Failed to send transaction")
-			return fmt.Errorf("failed to send transaction: %w", err)
+			return sigs, fmt.Errorf("failed to send transaction: %w", err)
 		}
 
 		logger.WithFields(logrus.Fields{
 			"signature": sig.String(),
 		}).Info("Transaction sent successfully")
+		sigs = append(sigs, sig)
+	}
+
+	return sigs, nil
+}
+
+// ConfirmTransaction waits until a transaction is confirmed or the timeout elapses
+func (c *SolanaClient) ConfirmTransaction(ctx context.Context, sig solana.Signature, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := c.ConfirmPollInterval
+	if interval <= 0 {
+		interval = defaultConfirmPollInterval
 	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return nil
+	for {
+		out, err := c.RpcClient.GetSignatureStatuses(ctx, false, sig)
+		if err == nil && len(out.Value) > 0 && out.Value[0] != nil {
+			status := out.Value[0]
+			if status.Err != nil {
+				return fmt.Errorf("transaction %s failed: %v", sig, status.Err)
+			}
+			if status.ConfirmationStatus == rpc.ConfirmationStatusConfirmed ||
+				status.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction %s not confirmed: %w", sig, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,416 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// newFakeClient returns a signing client backed by a fake RPC
+func newFakeClient(t *testing.T) (*SolanaClient, *FakeRPC) {
+	t.Helper()
+	wallet, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatalf("NewRandomPrivateKey: %v", err)
+	}
+	fake := NewFakeRPC()
+	return &SolanaClient{
+		RpcClient:           fake,
+		PublicKey:           wallet.PublicKey(),
+		PrivateKey:          wallet,
+		ConfirmPollInterval: time.Millisecond,
+	}, fake
+}
+
+// apiTransaction encodes an unsigned transaction the way the Lulo API returns
+// them, signed by the wallet and any other signers
+func apiTransaction(t *testing.T, memo string, signers ...solana.PublicKey) string {
+	t.Helper()
+	accounts := make(solana.AccountMetaSlice, 0, len(signers))
+	for _, signer := range signers {
+		accounts = append(accounts, solana.Meta(signer).SIGNER())
+	}
+	instruction := solana.NewInstruction(solana.MemoProgramID, accounts, []byte(memo))
+	tx, err := solana.NewTransaction([]solana.Instruction{instruction}, solana.Hash{}, solana.TransactionPayer(signers[0]))
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// preflightFailure returns the transaction error of a preflight failure
+func preflightFailure(t *testing.T, err error) interface{} {
+	t.Helper()
+	var rpcErr *jsonrpc.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != rpcCodePreflightFailure {
+		t.Fatalf("error = %v, want a preflight failure", err)
+	}
+	return rpcErr.Data.(map[string]interface{})["err"]
+}
+
+func TestHandleB64TransactionsSendsInOrder(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+	wallet := client.WalletPubKey()
+
+	sigs, err := client.HandleB64Transactions(ctx, []string{
+		apiTransaction(t, "first", wallet),
+		apiTransaction(t, "second", wallet),
+		apiTransaction(t, "third", wallet),
+	})
+	if err != nil {
+		t.Fatalf("HandleB64Transactions: %v", err)
+	}
+
+	sent := fake.Sent()
+	if len(sigs) != 3 || len(sent) != 3 {
+		t.Fatalf("got %d signatures and %d sent transactions, want 3", len(sigs), len(sent))
+	}
+	for i, tx := range sent {
+		if tx.Signatures[0] != sigs[i] {
+			t.Errorf("transaction %d sent out of order", i)
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("transaction %d: %v", i, err)
+		}
+		if tx.Message.RecentBlockhash != sent[0].Message.RecentBlockhash {
+			t.Errorf("transaction %d uses a different blockhash", i)
+		}
+		if err := client.ConfirmTransaction(ctx, sigs[i], time.Second); err != nil {
+			t.Errorf("ConfirmTransaction(%d): %v", i, err)
+		}
+	}
+	if got := fake.Calls("getLatestBlockhash"); got != 1 {
+		t.Errorf("fetched the blockhash %d times, want once", got)
+	}
+}
+
+func TestHandleB64TransactionsStopsAtFirstFailure(t *testing.T) {
+	client, fake := newFakeClient(t)
+	wallet := client.WalletPubKey()
+	cosigner, _ := solana.NewRandomPrivateKey()
+
+	// The second transaction needs a signature the wallet cannot provide
+	sigs, err := client.HandleB64Transactions(context.Background(), []string{
+		apiTransaction(t, "first", wallet),
+		apiTransaction(t, "second", wallet, cosigner.PublicKey()),
+		apiTransaction(t, "third", wallet),
+	})
+	if got := preflightFailure(t, err); got != "SignatureFailure" {
+		t.Errorf("preflight error = %v, want SignatureFailure", got)
+	}
+	if len(sigs) != 1 || len(fake.Sent()) != 1 {
+		t.Fatalf("got %d signatures and %d sent transactions, want only the first", len(sigs), len(fake.Sent()))
+	}
+	if sigs[0] != fake.Sent()[0].Signatures[0] {
+		t.Error("returned signature is not the sent transaction's")
+	}
+}
+
+func TestHandleB64TransactionsRPCUnavailable(t *testing.T) {
+	client, fake := newFakeClient(t)
+	unavailable := errors.New("connection refused")
+	fake.Fail("getLatestBlockhash", unavailable, 1)
+
+	_, err := client.HandleB64Transactions(context.Background(), []string{
+		apiTransaction(t, "memo", client.WalletPubKey()),
+	})
+	if !errors.Is(err, unavailable) {
+		t.Fatalf("error = %v, want the RPC error", err)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Error("sent a transaction without a blockhash")
+	}
+}
+
+func TestHandleB64TransactionsReadOnly(t *testing.T) {
+	client, fake := newFakeClient(t)
+	client.PrivateKey = nil
+
+	_, err := client.HandleB64Transactions(context.Background(), []string{
+		apiTransaction(t, "memo", client.WalletPubKey()),
+	})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("error = %v, want ErrReadOnly", err)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Error("a read-only client sent a transaction")
+	}
+}
+
+func TestSignTransactionKeepsOtherSignatures(t *testing.T) {
+	client, _ := newFakeClient(t)
+	cosigner, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := solana.NewTransaction(
+		[]solana.Instruction{solana.NewInstruction(
+			solana.MemoProgramID,
+			solana.AccountMetaSlice{solana.Meta(client.WalletPubKey()).SIGNER(), solana.Meta(cosigner.PublicKey()).SIGNER()},
+			[]byte("cosigned"),
+		)},
+		solana.Hash{1},
+		solana.TransactionPayer(client.WalletPubKey()),
+	)
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+
+	// Signed by the other party first, as transactions returned by an API may be
+	if _, err := tx.PartialSign(func(key solana.PublicKey) *solana.PrivateKey {
+		if key.Equals(cosigner.PublicKey()) {
+			return &cosigner
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cosignature := tx.Signatures[1]
+
+	if _, err := client.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		t.Errorf("VerifySignatures: %v", err)
+	}
+	if tx.Signatures[1] != cosignature {
+		t.Error("the other signer's signature was replaced")
+	}
+
+	// Signature slots that do not match the signers are refused
+	tx.Signatures = tx.Signatures[:1]
+	if _, err := client.SignTransaction(tx); err == nil {
+		t.Error("SignTransaction accepted a transaction with a missing signature slot")
+	}
+}
+
+func TestCreateSignAndSendTransaction(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+	fake.ConfirmAfter = 2
+
+	sig, err := client.CreateSignAndSendTransaction(ctx, []solana.Instruction{
+		devMemo("hello", client.WalletPubKey()),
+	})
+	if err != nil {
+		t.Fatalf("CreateSignAndSendTransaction: %v", err)
+	}
+	if err := client.ConfirmTransaction(ctx, sig, time.Second); err != nil {
+		t.Fatalf("ConfirmTransaction: %v", err)
+	}
+	// Processed twice before it is confirmed
+	if got := fake.Calls("getSignatureStatuses"); got != 3 {
+		t.Errorf("polled the status %d times, want 3", got)
+	}
+}
+
+func TestSendTransactionExpiredBlockhash(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+
+	tx, err := client.CreateTransaction(ctx, []solana.Instruction{devMemo("late", client.WalletPubKey())})
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if _, err := client.SignTransaction(tx); err != nil {
+		t.Fatalf("SignTransaction: %v", err)
+	}
+	fake.ExpireBlockhashes()
+
+	_, err = client.SendTransaction(ctx, tx)
+	if got := preflightFailure(t, err); got != "BlockhashNotFound" {
+		t.Errorf("preflight error = %v, want BlockhashNotFound", got)
+	}
+
+	// Building the transaction again picks up a live blockhash
+	if _, err := client.CreateSignAndSendTransaction(ctx, []solana.Instruction{devMemo("late", client.WalletPubKey())}); err != nil {
+		t.Fatalf("CreateSignAndSendTransaction after expiry: %v", err)
+	}
+}
+
+func TestSendTransactionPreflightFailure(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+	logs := []string{"Program log: Error: insufficient funds"}
+
+	tx, err := client.CreateTransaction(ctx, []solana.Instruction{devMemo("broke", client.WalletPubKey())})
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	client.SignTransaction(tx)
+
+	fake.FailPreflight("InsufficientFundsForFee", logs...)
+	result, err := client.SimulateTransaction(ctx, tx)
+	if err == nil || !strings.Contains(err.Error(), "InsufficientFundsForFee") {
+		t.Fatalf("SimulateTransaction error = %v, want the simulation failure", err)
+	}
+	if result == nil || len(result.Logs) != 1 || result.Logs[0] != logs[0] {
+		t.Errorf("simulation logs = %v, want %v", result, logs)
+	}
+
+	fake.FailPreflight("InsufficientFundsForFee", logs...)
+	_, err = client.SendTransaction(ctx, tx)
+	if got := preflightFailure(t, err); got != "InsufficientFundsForFee" {
+		t.Errorf("preflight error = %v, want InsufficientFundsForFee", got)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Error("a transaction failing preflight was sent")
+	}
+
+	// The failures were used up, so the same transaction now goes through
+	if _, err := client.SimulateTransaction(ctx, tx); err != nil {
+		t.Errorf("SimulateTransaction: %v", err)
+	}
+	if _, err := client.SendTransaction(ctx, tx); err != nil {
+		t.Errorf("SendTransaction: %v", err)
+	}
+}
+
+func TestConfirmTransactionDropped(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+	fake.DropNext(1)
+
+	sig, err := client.CreateSignAndSendTransaction(ctx, []solana.Instruction{devMemo("lost", client.WalletPubKey())})
+	if err != nil {
+		t.Fatalf("CreateSignAndSendTransaction: %v", err)
+	}
+	err = client.ConfirmTransaction(ctx, sig, 20*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ConfirmTransaction error = %v, want a timeout", err)
+	}
+}
+
+func TestConfirmTransactionFailedOnChain(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+	fake.FailOnChain(map[string]interface{}{"InstructionError": []interface{}{0, map[string]int{"Custom": 6001}}})
+
+	sig, err := client.CreateSignAndSendTransaction(ctx, []solana.Instruction{devMemo("fails", client.WalletPubKey())})
+	if err != nil {
+		t.Fatalf("CreateSignAndSendTransaction: %v", err)
+	}
+	err = client.ConfirmTransaction(ctx, sig, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "6001") {
+		t.Fatalf("ConfirmTransaction error = %v, want the instruction error", err)
+	}
+}
+
+// cancellingRPC cancels the send it is given, as an interrupt arriving while
+// the request is in flight would
+type cancellingRPC struct {
+	RPC
+	cancel context.CancelFunc
+}
+
+func (r *cancellingRPC) SendTransactionWithOpts(ctx context.Context, tx *solana.Transaction, opts rpc.TransactionOpts) (solana.Signature, error) {
+	r.cancel()
+	return solana.Signature{}, ctx.Err()
+}
+
+func TestSendTransactionRecorded(t *testing.T) {
+	client, fake := newFakeClient(t)
+	newTx := func(memo string) *solana.Transaction {
+		tx, err := client.CreateTransaction(context.Background(), []solana.Instruction{devMemo(memo, client.WalletPubKey())})
+		if err != nil {
+			t.Fatalf("CreateTransaction: %v", err)
+		}
+		if _, err := client.SignTransaction(tx); err != nil {
+			t.Fatalf("SignTransaction: %v", err)
+		}
+		return tx
+	}
+	sent := NewSentLog(10)
+	ctx := WithSentLog(context.Background(), sent)
+
+	sig, err := client.SendTransaction(ctx, newTx("sent"))
+	if err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+
+	// Cancelled before sending, so nothing reaches the node
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.SendTransaction(cancelled, newTx("cancelled")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendTransaction error = %v, want context.Canceled", err)
+	}
+	if len(fake.Sent()) != 1 {
+		t.Errorf("%d transactions reached the node, want the cancelled one held back", len(fake.Sent()))
+	}
+
+	// Cancelled in flight, so the send may have reached the node
+	inFlight, cancel := context.WithCancel(ctx)
+	defer cancel()
+	client.RpcClient = &cancellingRPC{RPC: fake, cancel: cancel}
+	interrupted := newTx("interrupted")
+	if _, err := client.SendTransaction(inFlight, interrupted); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendTransaction error = %v, want context.Canceled", err)
+	}
+
+	txs, total := sent.Transactions()
+	if total != 2 || len(txs) != 2 {
+		t.Fatalf("recorded %d of %d transactions, want 2: %+v", len(txs), total, txs)
+	}
+	if txs[0].Signature != sig || txs[0].Status != SentOK || !txs[0].Wallet.Equals(client.WalletPubKey()) {
+		t.Errorf("recorded %+v, want %s as %s", txs[0], sig, SentOK)
+	}
+	if txs[1].Signature != interrupted.Signatures[0] || txs[1].Status != SentUnknown {
+		t.Errorf("recorded %s as %s, want %s as %s", txs[1].Signature, txs[1].Status, interrupted.Signatures[0], SentUnknown)
+	}
+
+	// Sends without a sent log are not recorded anywhere
+	client.RpcClient = fake
+	if _, err := client.SendTransaction(context.Background(), newTx("unrecorded")); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	if _, total := sent.Transactions(); total != 2 {
+		t.Errorf("total = %d after a send under another context, want 2", total)
+	}
+}
+
+func TestWrappedSOLBalance(t *testing.T) {
+	client, fake := newFakeClient(t)
+	ctx := context.Background()
+
+	if _, exists, err := client.GetWrappedSOLBalance(ctx); err != nil || exists {
+		t.Fatalf("GetWrappedSOLBalance = exists %v, error %v; want a missing account", exists, err)
+	}
+
+	ata, err := client.WrappedSOLAccount()
+	if err != nil {
+		t.Fatalf("WrappedSOLAccount: %v", err)
+	}
+	var data bytes.Buffer
+	if err := bin.NewBinEncoder(&data).Encode(&token.Account{
+		Mint:   solana.SolMint,
+		Owner:  client.WalletPubKey(),
+		Amount: 5000,
+		State:  token.Initialized,
+	}); err != nil {
+		t.Fatalf("encode token account: %v", err)
+	}
+	fake.SetAccount(ata, &rpc.Account{
+		Owner: solana.TokenProgramID,
+		Data:  rpc.DataBytesOrJSONFromBytes(data.Bytes()),
+	})
+
+	lamports, exists, err := client.GetWrappedSOLBalance(ctx)
+	if err != nil || !exists || lamports != 5000 {
+		t.Fatalf("GetWrappedSOLBalance = %d, %v, %v; want 5000 in an existing account", lamports, exists, err)
+	}
+}
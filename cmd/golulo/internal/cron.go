@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the supported @ shorthands
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the set of allowed values of one field, indexed by value
+type cronField struct {
+	allowed []bool
+	any     bool // starts with *, relevant for the day of month/week rule
+}
+
+// CronSchedule is a parsed standard five field cron expression
+// (minute hour day-of-month month day-of-week), evaluated in local time
+type CronSchedule struct {
+	expr                          string
+	minute, hour, dom, month, dow cronField
+}
+
+// ParseCron parses a cron expression. Fields support *, lists (1,15), ranges
+// (1-5), steps (*/15, 0-30/10) and the @daily style macros.
+func ParseCron(expr string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+
+	sched := &CronSchedule{expr: expr}
+	bounds := []struct {
+		field    *cronField
+		name     string
+		min, max int
+	}{
+		{&sched.minute, "minute", 0, 59},
+		{&sched.hour, "hour", 0, 23},
+		{&sched.dom, "day of month", 1, 31},
+		{&sched.month, "month", 1, 12},
+		{&sched.dow, "day of week", 0, 7},
+	}
+	for i, b := range bounds {
+		field, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %s: %w", expr, b.name, err)
+		}
+		*b.field = field
+	}
+
+	// Sunday may be written as 7
+	if sched.dow.allowed[7] {
+		sched.dow.allowed[0] = true
+	}
+	return sched, nil
+}
+
+func parseCronField(s string, min, max int) (cronField, error) {
+	field := cronField{allowed: make([]bool, max+1), any: strings.HasPrefix(s, "*")}
+	for _, part := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return field, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return field, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return field, fmt.Errorf("invalid value %q", part)
+			}
+			low, high = n, n
+			if step > 1 {
+				// "5/15" means every 15 starting at 5
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return field, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			field.allowed[v] = true
+		}
+	}
+	return field, nil
+}
+
+// String returns the expression the schedule was parsed from
+func (s *CronSchedule) String() string {
+	return s.expr
+}
+
+// Matches reports whether the schedule fires in the minute containing t.
+// As in cron, when both day fields are restricted either one may match.
+func (s *CronSchedule) Matches(t time.Time) bool {
+	t = t.Local()
+	return s.minute.allowed[t.Minute()] && s.hour.allowed[t.Hour()] &&
+		s.month.allowed[int(t.Month())] && s.dayMatches(t)
+}
+
+// Next returns the first minute strictly after t at which the schedule fires,
+// or the zero time if it never fires within the next five years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Local().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month.allowed[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour.allowed[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute.allowed[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches checks the day of month and day of week fields
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom.allowed[t.Day()]
+	dowMatch := s.dow.allowed[int(t.Weekday())]
+	if s.dom.any || s.dow.any {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0,30 0 1,15 * *"},
+		{expr: "5/20 * * * *"},
+		{expr: "0 0 * * 7"},
+		{expr: "@daily"},
+		{expr: " @hourly "},
+		{expr: "* * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * 13 *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "a * * * *", wantErr: true},
+		{expr: "1-x * * * *", wantErr: true},
+		{expr: "@sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2024-03-01 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.March, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{expr: "* * * * *", at: at(1, 12, 34), want: true},
+		{expr: "*/15 * * * *", at: at(1, 12, 45), want: true},
+		{expr: "*/15 * * * *", at: at(1, 12, 46), want: false},
+		{expr: "0-30/10 * * * *", at: at(1, 12, 20), want: true},
+		{expr: "0-30/10 * * * *", at: at(1, 12, 40), want: false},
+		{expr: "5/20 * * * *", at: at(1, 12, 45), want: true},
+		{expr: "5/20 * * * *", at: at(1, 12, 0), want: false},
+		{expr: "0,30 * * * *", at: at(1, 12, 30), want: true},
+		{expr: "0,30 * * * *", at: at(1, 12, 15), want: false},
+		{expr: "0 9-17 * * *", at: at(1, 17, 0), want: true},
+		{expr: "0 9-17 * * *", at: at(1, 18, 0), want: false},
+		{expr: "0 0 * * 1-5", at: at(1, 0, 0), want: true},  // Friday
+		{expr: "0 0 * * 1-5", at: at(2, 0, 0), want: false}, // Saturday
+		{expr: "0 0 * * 7", at: at(3, 0, 0), want: true},    // Sunday as 7
+		{expr: "0 0 * * 0", at: at(3, 0, 0), want: true},
+		{expr: "0 0 1 * *", at: at(1, 0, 0), want: true},
+		{expr: "0 0 1 * *", at: at(2, 0, 0), want: false},
+		{expr: "0 0 * 3 *", at: at(2, 0, 0), want: true},
+		{expr: "0 0 * 4 *", at: at(2, 0, 0), want: false},
+		// With both day fields restricted either one matches
+		{expr: "0 0 15 * 5", at: at(1, 0, 0), want: true},  // Friday
+		{expr: "0 0 15 * 5", at: at(15, 0, 0), want: true}, // the 15th
+		{expr: "0 0 15 * 5", at: at(16, 0, 0), want: false},
+		// With one of them * both must match
+		{expr: "0 0 * * 5", at: at(15, 0, 0), want: true},
+		{expr: "0 0 */2 * 5", at: at(1, 0, 0), want: true},
+		{expr: "0 0 */2 * 5", at: at(8, 0, 0), want: false}, // Friday the 8th
+		{expr: "@hourly", at: at(1, 7, 0), want: true},
+		{expr: "@hourly", at: at(1, 7, 1), want: false},
+	}
+	for _, tt := range tests {
+		sched, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := sched.Matches(tt.at); got != tt.want {
+			t.Errorf("%q.Matches(%s) = %v, want %v", tt.expr, tt.at.Format("Mon Jan 2 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{expr: "* * * * *", from: at(3, 1, 12, 0).Add(30 * time.Second), want: at(3, 1, 12, 1)},
+		{expr: "*/15 * * * *", from: at(3, 1, 12, 0), want: at(3, 1, 12, 15)}, // strictly after
+		{expr: "0 9 * * *", from: at(3, 1, 9, 30), want: at(3, 2, 9, 0)},
+		{expr: "30 8 * * 1", from: at(3, 1, 12, 0), want: at(3, 4, 8, 30)},  // next Monday
+		{expr: "0 0 31 * *", from: at(3, 31, 12, 0), want: at(5, 31, 0, 0)}, // April has 30 days
+		{expr: "0 0 29 2 *", from: at(3, 1, 0, 0), want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.Local)},
+		{expr: "0 0 1 1 *", from: at(12, 31, 23, 59), want: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.Local)},
+		{expr: "0 12 15 * 1", from: at(3, 1, 0, 0), want: at(3, 4, 12, 0)}, // Monday before the 15th
+	}
+	for _, tt := range tests {
+		sched, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := sched.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+
+	// 30 February never comes
+	sched, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sched.Next(at(3, 1, 0, 0)); !got.IsZero() {
+		t.Errorf("Next of an impossible date = %s, want zero", got)
+	}
+}
@@ -0,0 +1,413 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+)
+
+// devBlockhashValidity is how many slots a blockhash can be used for, as on mainnet
+const devBlockhashValidity = 150
+
+// JSON-RPC error codes returned by the dev bank
+const (
+	rpcCodeMethodNotFound   = -32601
+	rpcCodeInvalidParams    = -32602
+	rpcCodePreflightFailure = -32002
+)
+
+// DevBank is an in-process stand-in for a Solana RPC node. It serves the
+// JSON-RPC methods golulo uses, checks that sent transactions are signed and
+// use a recent blockhash, and lands them at once by handing them to
+// OnTransaction. Only lamport balances are kept; programs are not executed.
+type DevBank struct {
+	// OnTransaction applies a landed transaction. An error fails it on chain,
+	// as an instruction error would.
+	OnTransaction func(tx *solana.Transaction) error
+
+	mu           sync.Mutex
+	slot         uint64
+	blockhashes  map[solana.Hash]uint64 // slot each blockhash was issued in
+	latest       solana.Hash
+	balances     map[solana.PublicKey]uint64
+	transactions map[solana.Signature]devTransaction
+}
+
+// devTransaction is a transaction the dev bank has processed
+type devTransaction struct {
+	Slot uint64
+	Err  string // instruction error, empty when it succeeded
+	Data []byte // wire encoding, nil for airdrops
+	Logs []string
+}
+
+// devFee is the fee the dev bank reports for every transaction
+const devFee = 5000
+
+// NewDevBank creates an empty dev bank
+func NewDevBank() *DevBank {
+	b := &DevBank{
+		blockhashes:  map[solana.Hash]uint64{},
+		balances:     map[solana.PublicKey]uint64{},
+		transactions: map[solana.Signature]devTransaction{},
+	}
+	b.advance()
+	return b
+}
+
+// Airdrop credits lamports to an account
+func (b *DevBank) Airdrop(account solana.PublicKey, lamports uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balances[account] += lamports
+}
+
+// Balance returns the lamports of an account
+func (b *DevBank) Balance(account solana.PublicKey) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.balances[account]
+}
+
+// LatestBlockhash returns the most recent blockhash
+func (b *DevBank) LatestBlockhash() solana.Hash {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.latest
+}
+
+// advance moves to the next slot and issues its blockhash. Callers hold mu
+// except while constructing the bank.
+func (b *DevBank) advance() {
+	b.slot++
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], b.slot)
+	b.latest = solana.Hash(sha256.Sum256(append([]byte("golulo-devbank"), seed[:]...)))
+	b.blockhashes[b.latest] = b.slot
+	for hash, issued := range b.blockhashes {
+		if b.slot-issued > devBlockhashValidity {
+			delete(b.blockhashes, hash)
+		}
+	}
+}
+
+// devRPCRequest is a JSON-RPC request
+type devRPCRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// devRPCError is a JSON-RPC error
+type devRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *devRPCError) Error() string { return e.Message }
+
+// ServeHTTP implements the JSON-RPC endpoint
+func (b *DevBank) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	var req devRPCRequest
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON-RPC request: %w", err))
+		return
+	}
+
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	result, err := b.call(req.Method, req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*devRPCError)
+		if !ok {
+			rpcErr = &devRPCError{Code: rpcCodeInvalidParams, Message: err.Error()}
+		}
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// call runs a JSON-RPC method
+func (b *DevBank) call(method string, params []json.RawMessage) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch method {
+	case "getHealth":
+		return "ok", nil
+	case "getSlot", "getBlockHeight":
+		return b.slot, nil
+	case "getLatestBlockhash":
+		b.advance()
+		return b.withContext(map[string]interface{}{
+			"blockhash":            b.latest.String(),
+			"lastValidBlockHeight": b.slot + devBlockhashValidity,
+		}), nil
+	case "getBalance":
+		account, err := devParamKey(params, 0)
+		if err != nil {
+			return nil, err
+		}
+		return b.withContext(b.balances[account]), nil
+	case "requestAirdrop":
+		account, err := devParamKey(params, 0)
+		if err != nil {
+			return nil, err
+		}
+		var lamports uint64
+		if len(params) < 2 || json.Unmarshal(params[1], &lamports) != nil {
+			return nil, &devRPCError{Code: rpcCodeInvalidParams, Message: "invalid lamports"}
+		}
+		b.balances[account] += lamports
+		b.advance()
+		// Airdrops are not transactions here, the signature is only a receipt
+		var sig solana.Signature
+		copy(sig[:], b.latest[:])
+		b.transactions[sig] = devTransaction{Slot: b.slot}
+		return sig.String(), nil
+	case "getAccountInfo":
+		return b.withContext(nil), nil
+	case "getTokenAccountsByOwner":
+		return b.withContext([]interface{}{}), nil
+	case "sendTransaction":
+		return b.sendTransaction(params)
+	case "simulateTransaction":
+		return b.simulateTransaction(params)
+	case "getTransaction":
+		return b.getTransaction(params)
+	case "getSignatureStatuses":
+		return b.signatureStatuses(params)
+	}
+	return nil, &devRPCError{Code: rpcCodeMethodNotFound, Message: "Method not found: " + method}
+}
+
+// withContext wraps a value the way RPC methods returning a context do
+func (b *DevBank) withContext(value interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]interface{}{"slot": b.slot},
+		"value":   value,
+	}
+}
+
+// devTransactionOpts are the options of sendTransaction and simulateTransaction
+type devTransactionOpts struct {
+	Encoding               string `json:"encoding"`
+	SigVerify              bool   `json:"sigVerify"`
+	ReplaceRecentBlockhash bool   `json:"replaceRecentBlockhash"`
+}
+
+// devParamTransaction reads a base64 encoded transaction parameter and its options
+func devParamTransaction(params []json.RawMessage) (*solana.Transaction, []byte, devTransactionOpts, error) {
+	var opts devTransactionOpts
+	var encoded string
+	if len(params) == 0 || json.Unmarshal(params[0], &encoded) != nil {
+		return nil, nil, opts, &devRPCError{Code: rpcCodeInvalidParams, Message: "missing transaction"}
+	}
+	if len(params) > 1 {
+		json.Unmarshal(params[1], &opts)
+	}
+
+	if opts.Encoding != "base64" {
+		return nil, nil, opts, &devRPCError{Code: rpcCodeInvalidParams, Message: "only base64 encoded transactions are supported"}
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, opts, &devRPCError{Code: rpcCodeInvalidParams, Message: "invalid transaction encoding: " + err.Error()}
+	}
+	tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(data))
+	if err != nil {
+		return nil, nil, opts, &devRPCError{Code: rpcCodeInvalidParams, Message: "failed to deserialize transaction: " + err.Error()}
+	}
+	return tx, data, opts, nil
+}
+
+// sendTransaction checks and lands a transaction
+func (b *DevBank) sendTransaction(params []json.RawMessage) (interface{}, error) {
+	tx, data, _, err := devParamTransaction(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tx.Signatures) == 0 || len(tx.Signatures) != int(tx.Message.Header.NumRequiredSignatures) {
+		return nil, preflightError("MissingSignatureForFee", "missing signatures")
+	}
+	if err := tx.VerifySignatures(); err != nil {
+		return nil, preflightError("SignatureFailure", "signature verification failed")
+	}
+	if _, ok := b.blockhashes[tx.Message.RecentBlockhash]; !ok {
+		return nil, preflightError("BlockhashNotFound", "Blockhash not found")
+	}
+	sig := tx.Signatures[0]
+	if _, ok := b.transactions[sig]; ok {
+		return nil, preflightError("AlreadyProcessed", "This transaction has already been processed")
+	}
+
+	b.advance()
+	landed := devTransaction{Slot: b.slot, Data: data}
+	if b.OnTransaction != nil {
+		// Runs with the bank locked, so it must not call back into the bank
+		if err := b.OnTransaction(tx); err != nil {
+			landed.Err = err.Error()
+		}
+	}
+	landed.Logs = devLogs(tx, landed.Err)
+	b.transactions[sig] = landed
+	return sig.String(), nil
+}
+
+// simulateTransaction checks a transaction as sendTransaction would, without
+// landing it. Programs are not run, so only their invocations are logged.
+func (b *DevBank) simulateTransaction(params []json.RawMessage) (interface{}, error) {
+	tx, _, opts, err := devParamTransaction(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var txErr interface{}
+	switch {
+	case opts.SigVerify && tx.VerifySignatures() != nil:
+		txErr = "SignatureFailure"
+	case !opts.ReplaceRecentBlockhash && b.blockhashes[tx.Message.RecentBlockhash] == 0:
+		txErr = "BlockhashNotFound"
+	}
+	var logs []string
+	if txErr == nil {
+		logs = devLogs(tx, "")
+	}
+	return b.withContext(map[string]interface{}{
+		"err":           txErr,
+		"logs":          logs,
+		"accounts":      nil,
+		"unitsConsumed": 150 * len(tx.Message.Instructions),
+	}), nil
+}
+
+// getTransaction returns a landed transaction with its status and logs
+func (b *DevBank) getTransaction(params []json.RawMessage) (interface{}, error) {
+	var s string
+	if len(params) == 0 || json.Unmarshal(params[0], &s) != nil {
+		return nil, &devRPCError{Code: rpcCodeInvalidParams, Message: "missing signature"}
+	}
+	sig, err := solana.SignatureFromBase58(s)
+	if err != nil {
+		return nil, &devRPCError{Code: rpcCodeInvalidParams, Message: "invalid signature " + s}
+	}
+	landed, ok := b.transactions[sig]
+	if !ok || landed.Data == nil {
+		return nil, nil
+	}
+
+	var txErr interface{}
+	if landed.Err != "" {
+		txErr = devInstructionError(landed.Err)
+	}
+	return map[string]interface{}{
+		"slot":        landed.Slot,
+		"blockTime":   nil,
+		"version":     "legacy",
+		"transaction": []string{base64.StdEncoding.EncodeToString(landed.Data), "base64"},
+		"meta": map[string]interface{}{
+			"err":               txErr,
+			"fee":               devFee,
+			"logMessages":       landed.Logs,
+			"preBalances":       []uint64{},
+			"postBalances":      []uint64{},
+			"preTokenBalances":  []interface{}{},
+			"postTokenBalances": []interface{}{},
+			"loadedAddresses":   map[string][]string{"writable": {}, "readonly": {}},
+		},
+	}, nil
+}
+
+// devLogs are the program logs of a transaction: the invocation of each
+// instruction's program, with the first failing when failure is set
+func devLogs(tx *solana.Transaction, failure string) []string {
+	var logs []string
+	for _, inst := range tx.Message.Instructions {
+		program, err := tx.Message.Program(inst.ProgramIDIndex)
+		if err != nil {
+			continue
+		}
+		logs = append(logs, fmt.Sprintf("Program %s invoke [1]", program))
+		if failure != "" {
+			return append(logs, fmt.Sprintf("Program %s failed: %s", program, failure))
+		}
+		logs = append(logs, fmt.Sprintf("Program %s success", program))
+	}
+	return logs
+}
+
+// signatureStatuses reports landed transactions as confirmed
+func (b *DevBank) signatureStatuses(params []json.RawMessage) (interface{}, error) {
+	var sigs []string
+	if len(params) == 0 || json.Unmarshal(params[0], &sigs) != nil {
+		return nil, &devRPCError{Code: rpcCodeInvalidParams, Message: "missing signatures"}
+	}
+
+	statuses := make([]interface{}, len(sigs))
+	for i, s := range sigs {
+		sig, err := solana.SignatureFromBase58(s)
+		if err != nil {
+			return nil, &devRPCError{Code: rpcCodeInvalidParams, Message: "invalid signature " + s}
+		}
+		landed, ok := b.transactions[sig]
+		if !ok {
+			continue
+		}
+		var txErr interface{}
+		status := map[string]interface{}{"Ok": nil}
+		if landed.Err != "" {
+			txErr = devInstructionError(landed.Err)
+			status = map[string]interface{}{"Err": txErr}
+		}
+		statuses[i] = map[string]interface{}{
+			"slot":               landed.Slot,
+			"confirmations":      nil,
+			"err":                txErr,
+			"status":             status,
+			"confirmationStatus": "confirmed",
+		}
+	}
+	return b.withContext(statuses), nil
+}
+
+// devInstructionError is the error of a transaction whose first instruction failed
+func devInstructionError(message string) interface{} {
+	return map[string]interface{}{"InstructionError": []interface{}{0, map[string]string{"Custom": message}}}
+}
+
+// devParamKey reads a public key parameter
+func devParamKey(params []json.RawMessage, i int) (solana.PublicKey, error) {
+	var s string
+	if len(params) <= i || json.Unmarshal(params[i], &s) != nil {
+		return solana.PublicKey{}, &devRPCError{Code: rpcCodeInvalidParams, Message: "missing account"}
+	}
+	key, err := solana.PublicKeyFromBase58(s)
+	if err != nil {
+		return solana.PublicKey{}, &devRPCError{Code: rpcCodeInvalidParams, Message: "invalid account " + s}
+	}
+	return key, nil
+}
+
+// preflightError is the error a node returns when simulating a transaction fails
+func preflightError(name, message string) *devRPCError {
+	return &devRPCError{
+		Code:    rpcCodePreflightFailure,
+		Message: "Transaction simulation failed: " + message,
+		Data:    map[string]interface{}{"err": name, "logs": []string{}},
+	}
+}
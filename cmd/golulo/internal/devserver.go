@@ -0,0 +1,411 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+)
+
+// devMemoPrefix starts the memo of every transaction the dev server generates,
+// followed by the ID of the operation it carries out
+const devMemoPrefix = "golulo-dev:"
+
+// Dev server endpoints, used to inject failures
+const (
+	DevEndpointAccount  = "account"
+	DevEndpointRates    = "rates"
+	DevEndpointDeposit  = "deposit"
+	DevEndpointWithdraw = "withdraw"
+)
+
+// DevServer emulates the Lulo API endpoints golulo uses, for local development
+// and tests. Generated transactions are real unsigned transactions carrying a
+// memo that names the operation, which is applied to the account once the
+// signed transaction lands in Bank. Token balances of the wallet itself are
+// not tracked.
+type DevServer struct {
+	APIKey  string
+	Version string // routes served: legacy, v1, or empty for both
+	Bank    *DevBank
+	Rates   Rates
+	Prices  map[string]float64 // USD price by mint, 1 when not listed
+	Log     *logrus.Entry      // request log
+
+	mu        sync.Mutex
+	positions map[string]map[devPositionKey]float64 // owner -> deposited amounts
+	pending   map[string]devOperation
+	faults    map[string][]devFault
+}
+
+// devPositionKey identifies a deposited token within an account
+type devPositionKey struct {
+	Mint string
+	Pool string
+}
+
+// devOperation is a generated deposit or withdrawal waiting for its
+// transaction to land
+type devOperation struct {
+	Owner    solana.PublicKey
+	Mint     string
+	Pool     string
+	Amount   float64
+	Withdraw bool
+	All      bool
+}
+
+// devFault is a failure injected into an endpoint
+type devFault struct {
+	Status     int
+	RetryAfter time.Duration
+}
+
+// NewDevServer creates a dev server with its own bank, default rates and a
+// SOL price
+func NewDevServer(apiKey string) *DevServer {
+	usdc := ResolveMint("USDC")
+	d := &DevServer{
+		APIKey: apiKey,
+		Bank:   NewDevBank(),
+		Rates: Rates{
+			Pools: []PoolRate{
+				{Pool: "protected", MintAddress: usdc, APY: 6.5},
+				{Pool: "boosted", MintAddress: usdc, APY: 9.2},
+				{Pool: "protected", MintAddress: NativeSOL.Mint, APY: 5.1},
+			},
+			Protocols: []ProtocolRate{
+				{Protocol: "kamino", MintAddress: usdc, APY: 7.4},
+				{Protocol: "marginfi", MintAddress: usdc, APY: 6.9},
+			},
+		},
+		Prices:    map[string]float64{NativeSOL.Mint: 150},
+		positions: map[string]map[devPositionKey]float64{},
+		pending:   map[string]devOperation{},
+		faults:    map[string][]devFault{},
+	}
+	d.Bank.OnTransaction = d.apply
+	return d
+}
+
+// Fail makes the next times requests to an endpoint fail with status, sending
+// Retry-After when retryAfter is set
+func (d *DevServer) Fail(endpoint string, status int, retryAfter time.Duration, times int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < times; i++ {
+		d.faults[endpoint] = append(d.faults[endpoint], devFault{Status: status, RetryAfter: retryAfter})
+	}
+}
+
+// Handler returns the HTTP handler serving the Lulo API routes
+func (d *DevServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for version, routes := range luloAPIRoutes {
+		if d.Version != "" && d.Version != version {
+			continue
+		}
+		mux.HandleFunc(routes.Account, d.endpoint(DevEndpointAccount, http.MethodGet, d.handleAccount))
+		mux.HandleFunc(routes.Rates, d.endpoint(DevEndpointRates, http.MethodGet, d.handleRates))
+		mux.HandleFunc(routes.Deposit, d.endpoint(DevEndpointDeposit, http.MethodPost, d.handleDeposit))
+		mux.HandleFunc(routes.Withdraw, d.endpoint(DevEndpointWithdraw, http.MethodPost, d.handleWithdraw))
+	}
+	return logRequests(d.Log, mux)
+}
+
+// endpoint checks the method and API key and serves injected failures
+// before calling next
+func (d *DevServer) endpoint(name, method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("x-api-key")), []byte(d.APIKey)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid API key"))
+			return
+		}
+
+		d.mu.Lock()
+		var fault *devFault
+		if faults := d.faults[name]; len(faults) > 0 {
+			fault = &faults[0]
+			d.faults[name] = faults[1:]
+		}
+		d.mu.Unlock()
+		if fault != nil {
+			if fault.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+			}
+			writeError(w, fault.Status, fmt.Errorf("injected failure"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (d *DevServer) handleAccount(w http.ResponseWriter, r *http.Request) {
+	owner, err := solana.PublicKeyFromBase58(r.Header.Get("x-wallet-pubkey"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing or invalid x-wallet-pubkey header"))
+		return
+	}
+	writeJSON(w, http.StatusOK, AccountResponse{Data: d.Account(owner)})
+}
+
+func (d *DevServer) handleRates(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, RatesResponse{Data: d.Rates})
+}
+
+func (d *DevServer) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	var req DepositRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	op, err := devOperationFor(req.Owner, req.MintAddress, req.DepositAmount, req.Pool)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if op.Amount == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("depositAmount is required"))
+		return
+	}
+	encoded, err := d.generate(op)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var response DepositResponse
+	response.Data.TransactionMeta = []TransactionMeta{{Transaction: encoded, Protocol: "lulo-dev", TotalDeposit: op.Amount}}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (d *DevServer) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	var req WithdrawRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	amount := req.WithdrawAmount
+	if req.WithdrawAll {
+		if amount != WithdrawAllAmount {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("withdrawAmount must be %q when withdrawAll is set", WithdrawAllAmount))
+			return
+		}
+		amount = ""
+	}
+	op, err := devOperationFor(req.Owner, req.MintAddress, amount, req.Pool)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	op.Withdraw = true
+	op.All = req.WithdrawAll
+	if !op.All && op.Amount == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("withdrawAmount is required unless withdrawAll is set"))
+		return
+	}
+
+	d.mu.Lock()
+	deposited := d.deposited(op)
+	d.mu.Unlock()
+	if deposited == 0 || (!op.All && op.Amount > deposited) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("insufficient deposited balance: %s deposited", strconv.FormatFloat(deposited, 'f', -1, 64)))
+		return
+	}
+	encoded, err := d.generate(op)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	total := op.Amount
+	if op.All {
+		total = deposited
+	}
+	var response WithdrawResponse
+	response.Data.TransactionMeta = []WithdrawTransactionMeta{{
+		Transaction:   encoded,
+		Protocol:      "lulo-dev",
+		TotalWithdraw: strconv.FormatFloat(total, 'f', -1, 64),
+	}}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// devOperationFor validates the fields shared by deposit and withdraw
+// requests. An empty amount is only valid for withdrawing everything.
+func devOperationFor(owner, mint, amount, pool string) (devOperation, error) {
+	ownerKey, err := solana.PublicKeyFromBase58(owner)
+	if err != nil {
+		return devOperation{}, fmt.Errorf("invalid owner %q", owner)
+	}
+	if _, err := solana.PublicKeyFromBase58(mint); err != nil {
+		return devOperation{}, fmt.Errorf("invalid mintAddress %q", mint)
+	}
+	op := devOperation{Owner: ownerKey, Mint: mint, Pool: pool}
+	if amount != "" {
+		if op.Amount, err = strconv.ParseFloat(amount, 64); err != nil || op.Amount <= 0 {
+			return devOperation{}, fmt.Errorf("invalid amount %q", amount)
+		}
+	}
+	return op, nil
+}
+
+// generate records a pending operation and returns the base64 encoded
+// transaction that carries it out
+func (d *DevServer) generate(op devOperation) (string, error) {
+	id := newRequestID()
+	tx, err := solana.NewTransaction(
+		[]solana.Instruction{devMemo(devMemoPrefix+id, op.Owner)},
+		d.Bank.LatestBlockhash(),
+		solana.TransactionPayer(op.Owner),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create transaction: %w", err)
+	}
+	// Unsigned, with room for the owner's signature as the Lulo API returns them
+	tx.Signatures = make([]solana.Signature, tx.Message.Header.NumRequiredSignatures)
+	encoded, err := tx.ToBase64()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode transaction: %w", err)
+	}
+
+	d.mu.Lock()
+	d.pending[id] = op
+	d.mu.Unlock()
+	return encoded, nil
+}
+
+// devMemo builds a memo instruction. The memo program takes the raw UTF-8
+// text, without the length prefix the solana-go memo builder adds.
+func devMemo(text string, signer solana.PublicKey) solana.Instruction {
+	return solana.NewInstruction(
+		solana.MemoProgramID,
+		solana.AccountMetaSlice{solana.Meta(signer).SIGNER()},
+		[]byte(text),
+	)
+}
+
+// apply carries out the operation named by a landed transaction's memo
+func (d *DevServer) apply(tx *solana.Transaction) error {
+	id := ""
+	for _, inst := range tx.Message.Instructions {
+		program, err := tx.Message.Program(inst.ProgramIDIndex)
+		if err != nil || !program.Equals(solana.MemoProgramID) {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(string(inst.Data), devMemoPrefix); ok {
+			id = rest
+		}
+	}
+	if id == "" {
+		return nil // not a Lulo transaction
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	op, ok := d.pending[id]
+	if !ok {
+		return fmt.Errorf("unknown operation %s", id)
+	}
+	if payer := tx.Message.AccountKeys[0]; !payer.Equals(op.Owner) {
+		return fmt.Errorf("operation %s belongs to %s", id, op.Owner)
+	}
+	delete(d.pending, id)
+
+	positions := d.positions[op.Owner.String()]
+	if positions == nil {
+		positions = map[devPositionKey]float64{}
+		d.positions[op.Owner.String()] = positions
+	}
+	if !op.Withdraw {
+		positions[devPositionKey{Mint: op.Mint, Pool: op.Pool}] += op.Amount
+		return nil
+	}
+
+	deposited := d.deposited(op)
+	if op.All {
+		op.Amount = deposited
+	}
+	if op.Amount > deposited {
+		return fmt.Errorf("insufficient deposited balance")
+	}
+	// Withdraw from the named pool, or from every pool holding the token
+	remaining := op.Amount
+	for key, amount := range positions {
+		if remaining <= 0 || key.Mint != op.Mint || (op.Pool != "" && key.Pool != op.Pool) {
+			continue
+		}
+		taken := amount
+		if taken > remaining {
+			taken = remaining
+		}
+		positions[key] -= taken
+		remaining -= taken
+		if positions[key] <= 1e-12 {
+			delete(positions, key)
+		}
+	}
+	return nil
+}
+
+// deposited returns the amount an operation can withdraw. Callers hold mu.
+func (d *DevServer) deposited(op devOperation) float64 {
+	total := 0.0
+	for key, amount := range d.positions[op.Owner.String()] {
+		if key.Mint == op.Mint && (op.Pool == "" || key.Pool == op.Pool) {
+			total += amount
+		}
+	}
+	return total
+}
+
+// Account returns the Lulo account of a wallet as the dev server sees it
+func (d *DevServer) Account(owner solana.PublicKey) Account {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	account := Account{Settings: AccountSettings{Owner: owner.String()}, Positions: []AccountPosition{}}
+	weightedAPY := 0.0
+	for key, amount := range d.positions[owner.String()] {
+		price, ok := d.Prices[key.Mint]
+		if !ok {
+			price = 1
+		}
+		value := amount * price
+		account.Positions = append(account.Positions, AccountPosition{
+			MintAddress: key.Mint,
+			Pool:        key.Pool,
+			Amount:      amount,
+			Value:       value,
+		})
+		account.TotalValue += value
+		for _, rate := range d.Rates.Pools {
+			if rate.MintAddress == key.Mint && rate.Pool == key.Pool {
+				weightedAPY += rate.APY * value
+			}
+		}
+	}
+	if account.TotalValue > 0 {
+		account.RealtimeAPY = weightedAPY / account.TotalValue
+	}
+	sort.Slice(account.Positions, func(i, j int) bool {
+		a, b := account.Positions[i], account.Positions[j]
+		if a.MintAddress != b.MintAddress {
+			return a.MintAddress < b.MintAddress
+		}
+		return a.Pool < b.Pool
+	})
+	return account
+}
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Exporter metric names
+const (
+	metricTotalValue     = "golulo_account_total_value_usd"
+	metricInterestEarned = "golulo_account_interest_earned_usd"
+	metricRealtimeAPY    = "golulo_account_realtime_apy_percent"
+	metricPositionAmount = "golulo_position_amount"
+	metricPositionValue  = "golulo_position_value_usd"
+	metricWalletBalance  = "golulo_wallet_balance"
+	metricPoolAPY        = "golulo_pool_apy_percent"
+	metricProtocolAPY    = "golulo_protocol_apy_percent"
+	metricRefreshErrors  = "golulo_refresh_errors_total"
+	metricLastRefresh    = "golulo_last_refresh_timestamp_seconds"
+)
+
+// ExporterWallet is a wallet scraped by the exporter. Only the address is
+// needed; Name is exported as the profile label.
+type ExporterWallet struct {
+	Name    string `mapstructure:"name"`
+	Address string `mapstructure:"address"`
+}
+
+// ExporterConfig is the `exporter` section of the config file
+type ExporterConfig struct {
+	Listen   string           `mapstructure:"listen"`
+	Interval time.Duration    `mapstructure:"interval"`
+	Balances bool             `mapstructure:"balances"` // also export wallet token balances from RPC
+	Wallets  []ExporterWallet `mapstructure:"wallets"`
+}
+
+// Exporter refreshes Lulo metrics for a set of wallets
+type Exporter struct {
+	Registry *MetricsRegistry
+	Log      *logrus.Entry
+
+	lulo    *LuloClient
+	rpc     RPC // nil when balances are not exported
+	wallets []exporterTarget
+}
+
+type exporterTarget struct {
+	profile string
+	wallet  solana.PublicKey
+}
+
+// NewExporter creates an exporter for wallets, logging to the Lulo client's
+// logger. The Lulo client's requests are instrumented, as are RPC requests
+// when balances is set.
+func NewExporter(luloClient *LuloClient, wallets []ExporterWallet, balances bool) (*Exporter, error) {
+	registry := NewMetricsRegistry()
+	registry.RegisterRequestMetrics()
+	registry.Register(metricTotalValue, MetricGauge, "Total value of the Lulo account in USD")
+	registry.Register(metricInterestEarned, MetricGauge, "Interest earned by the Lulo account in USD")
+	registry.Register(metricRealtimeAPY, MetricGauge, "Realtime APY of the Lulo account in percent")
+	registry.Register(metricPositionAmount, MetricGauge, "Deposited token amount per position")
+	registry.Register(metricPositionValue, MetricGauge, "Value of a position in USD")
+	registry.Register(metricPoolAPY, MetricGauge, "Current Lulo pool APY in percent")
+	registry.Register(metricProtocolAPY, MetricGauge, "Current protocol lending APY in percent")
+	registry.Register(metricRefreshErrors, MetricCounter, "Failed refreshes by wallet and source")
+	registry.Register(metricLastRefresh, MetricGauge, "Unix time of the last successful refresh of a wallet")
+
+	exporter := &Exporter{Registry: registry, Log: luloClient.log(), lulo: luloClient}
+	luloClient.HTTPClient.Transport = &InstrumentedTransport{
+		Target:   "lulo",
+		Base:     luloClient.HTTPClient.Transport,
+		Registry: registry,
+	}
+
+	if balances {
+		registry.Register(metricWalletBalance, MetricGauge, "Wallet token balance in whole token units")
+		rpcClient, err := NewRPCClient(&InstrumentedTransport{Target: "rpc", Registry: registry}, exporter.Log)
+		if err != nil {
+			return nil, err
+		}
+		exporter.rpc = rpcClient
+	}
+
+	for _, w := range wallets {
+		wallet, err := solana.PublicKeyFromBase58(w.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wallet address %q: %w", w.Address, err)
+		}
+		profile := w.Name
+		if profile == "" {
+			profile = w.Address
+		}
+		exporter.wallets = append(exporter.wallets, exporterTarget{profile: profile, wallet: wallet})
+	}
+	return exporter, nil
+}
+
+// log returns the exporter's logger
+func (e *Exporter) log() *logrus.Entry {
+	if e.Log == nil {
+		return standardLogger()
+	}
+	return e.Log
+}
+
+// Handler serves /metrics
+func (e *Exporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.Registry)
+	return mux
+}
+
+// Refresh fetches rates once and every wallet concurrently, updating the metrics
+func (e *Exporter) Refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e.refreshRates(ctx)
+	}()
+	for _, target := range e.wallets {
+		wg.Add(1)
+		go func(target exporterTarget) {
+			defer wg.Done()
+			e.refreshWallet(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (e *Exporter) refreshRates(ctx context.Context) {
+	rates, err := e.lulo.GetRates(ctx)
+	if err != nil {
+		e.log().WithError(err).Warn("Failed to refresh rates")
+		e.Registry.Add(metricRefreshErrors, Labels{"wallet": "", "profile": "", "source": "rates"}, 1)
+		return
+	}
+
+	e.Registry.DeleteMatching(metricPoolAPY, nil)
+	for _, rate := range rates.Pools {
+		e.Registry.Set(metricPoolAPY, Labels{
+			"pool":  rate.Pool,
+			"token": TokenSymbol(rate.MintAddress),
+			"mint":  rate.MintAddress,
+		}, rate.APY)
+	}
+	e.Registry.DeleteMatching(metricProtocolAPY, nil)
+	for _, rate := range rates.Protocols {
+		e.Registry.Set(metricProtocolAPY, Labels{
+			"protocol": rate.Protocol,
+			"token":    TokenSymbol(rate.MintAddress),
+			"mint":     rate.MintAddress,
+		}, rate.APY)
+	}
+}
+
+func (e *Exporter) refreshWallet(ctx context.Context, target exporterTarget) {
+	walletLabels := Labels{"wallet": target.wallet.String(), "profile": target.profile}
+	log := e.log().WithFields(logrus.Fields{"wallet": target.wallet.String(), "profile": target.profile})
+	failed := false
+
+	account, err := e.lulo.GetAccount(ctx, target.wallet)
+	if err != nil {
+		log.WithError(err).Warn("Failed to refresh account")
+		e.Registry.Add(metricRefreshErrors, withLabel(walletLabels, "source", "lulo"), 1)
+		failed = true
+	} else {
+		e.Registry.Set(metricTotalValue, walletLabels, account.TotalValue)
+		e.Registry.Set(metricInterestEarned, walletLabels, account.InterestEarned)
+		e.Registry.Set(metricRealtimeAPY, walletLabels, account.RealtimeAPY)
+
+		e.Registry.DeleteMatching(metricPositionAmount, walletLabels)
+		e.Registry.DeleteMatching(metricPositionValue, walletLabels)
+		if !account.HasPositions() {
+			log.Debug("Account has no positions, position metrics are not exported")
+		}
+		for _, position := range account.Positions {
+			labels := withLabel(walletLabels, "token", TokenSymbol(position.MintAddress))
+			labels["mint"] = position.MintAddress
+			labels["protocol"] = position.Protocol
+			labels["pool"] = position.Pool
+			e.Registry.Add(metricPositionAmount, labels, position.Amount)
+			e.Registry.Add(metricPositionValue, labels, position.Value)
+		}
+	}
+
+	if e.rpc != nil {
+		client := &SolanaClient{RpcClient: e.rpc, PublicKey: target.wallet}
+		balances, err := client.GetBalances(ctx)
+		if err != nil {
+			log.WithError(err).Warn("Failed to refresh balances")
+			e.Registry.Add(metricRefreshErrors, withLabel(walletLabels, "source", "rpc"), 1)
+			failed = true
+		} else {
+			e.Registry.DeleteMatching(metricWalletBalance, walletLabels)
+			for _, balance := range balances {
+				labels := withLabel(walletLabels, "token", balance.Symbol)
+				labels["mint"] = balance.Mint
+				e.Registry.Set(metricWalletBalance, labels, balance.UIAmount())
+			}
+		}
+	}
+
+	if !failed {
+		e.Registry.Set(metricLastRefresh, walletLabels, float64(time.Now().Unix()))
+	}
+}
+
+// withLabel returns a copy of labels with one more label
+func withLabel(labels Labels, name, value string) Labels {
+	out := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	out[name] = value
+	return out
+}
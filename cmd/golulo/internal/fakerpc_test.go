@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// FakeRPC is a scriptable in-memory RPC for tests. Sent transactions land at
+// once unless a failure is scripted: Fail makes a method return an error,
+// DropNext accepts transactions that never land, ExpireBlockhashes
+// invalidates every blockhash issued so far, FailPreflight rejects
+// transactions in simulation and FailOnChain lands them with an error.
+// Methods are named by their JSON-RPC names, such as "sendTransaction".
+type FakeRPC struct {
+	// ConfirmAfter is how many status queries report a landed transaction as
+	// processed before it is confirmed
+	ConfirmAfter int
+
+	mu            sync.Mutex
+	slot          uint64
+	latest        solana.Hash
+	blockhashes   map[solana.Hash]bool
+	balances      map[solana.PublicKey]uint64
+	accounts      map[solana.PublicKey]*rpc.Account
+	tokenAccounts map[solana.PublicKey][]*rpc.TokenAccount
+	sent          []*solana.Transaction
+	landed        map[solana.Signature]*fakeStatus
+	calls         map[string]int
+	failures      map[string][]error
+	drops         int
+	preflight     []fakePreflight
+	onChain       []interface{}
+}
+
+var _ RPC = (*FakeRPC)(nil)
+
+// fakeStatus is a transaction that landed on the fake
+type fakeStatus struct {
+	Slot    uint64
+	Err     interface{}
+	Queries int
+}
+
+// fakePreflight is a scripted simulation failure
+type fakePreflight struct {
+	Err  interface{}
+	Logs []string
+}
+
+// NewFakeRPC creates an empty fake RPC
+func NewFakeRPC() *FakeRPC {
+	f := &FakeRPC{
+		blockhashes:   map[solana.Hash]bool{},
+		balances:      map[solana.PublicKey]uint64{},
+		accounts:      map[solana.PublicKey]*rpc.Account{},
+		tokenAccounts: map[solana.PublicKey][]*rpc.TokenAccount{},
+		landed:        map[solana.Signature]*fakeStatus{},
+		calls:         map[string]int{},
+		failures:      map[string][]error{},
+	}
+	f.advance()
+	return f
+}
+
+// Fail makes the next times calls of method return err
+func (f *FakeRPC) Fail(method string, err error, times int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < times; i++ {
+		f.failures[method] = append(f.failures[method], err)
+	}
+}
+
+// DropNext makes the next n sent transactions be accepted but never land
+func (f *FakeRPC) DropNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drops += n
+}
+
+// ExpireBlockhashes invalidates every blockhash issued so far
+func (f *FakeRPC) ExpireBlockhashes() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blockhashes = map[solana.Hash]bool{}
+	f.advance()
+}
+
+// FailPreflight makes the next simulation, or send with preflight checks,
+// fail with a transaction error such as "InsufficientFundsForFee"
+func (f *FakeRPC) FailPreflight(err interface{}, logs ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.preflight = append(f.preflight, fakePreflight{Err: err, Logs: logs})
+}
+
+// FailOnChain makes the next transaction to land fail with err
+func (f *FakeRPC) FailOnChain(err interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onChain = append(f.onChain, err)
+}
+
+// SetBalance sets the lamports of an account
+func (f *FakeRPC) SetBalance(account solana.PublicKey, lamports uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.balances[account] = lamports
+}
+
+// SetAccount stores an account returned by account info queries
+func (f *FakeRPC) SetAccount(address solana.PublicKey, account *rpc.Account) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accounts[address] = account
+}
+
+// AddTokenAccount adds an account returned by token account queries for owner
+func (f *FakeRPC) AddTokenAccount(owner solana.PublicKey, account *rpc.TokenAccount) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokenAccounts[owner] = append(f.tokenAccounts[owner], account)
+}
+
+// LatestBlockhash returns the most recently issued blockhash
+func (f *FakeRPC) LatestBlockhash() solana.Hash {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.latest
+}
+
+// Sent returns the transactions accepted so far, including dropped ones
+func (f *FakeRPC) Sent() []*solana.Transaction {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*solana.Transaction(nil), f.sent...)
+}
+
+// Calls returns how many times method was called
+func (f *FakeRPC) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// advance moves to the next slot and issues its blockhash. Callers hold mu
+// except while constructing the fake.
+func (f *FakeRPC) advance() {
+	f.slot++
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], f.slot)
+	f.latest = solana.Hash(sha256.Sum256(append([]byte("golulo-fakerpc"), seed[:]...)))
+	f.blockhashes[f.latest] = true
+}
+
+// begin counts a call and returns the context's error or a scripted failure.
+// Callers hold mu.
+func (f *FakeRPC) begin(ctx context.Context, method string) error {
+	f.calls[method]++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if queued := f.failures[method]; len(queued) > 0 {
+		f.failures[method] = queued[1:]
+		return queued[0]
+	}
+	return nil
+}
+
+// rpcContext is the context of results at the current slot. Callers hold mu.
+func (f *FakeRPC) rpcContext() rpc.RPCContext {
+	return rpc.RPCContext{Context: rpc.Context{Slot: f.slot}}
+}
+
+// GetLatestBlockhash issues a new blockhash
+func (f *FakeRPC) GetLatestBlockhash(ctx context.Context, commitment rpc.CommitmentType) (*rpc.GetLatestBlockhashResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getLatestBlockhash"); err != nil {
+		return nil, err
+	}
+	f.advance()
+	return &rpc.GetLatestBlockhashResult{
+		RPCContext: f.rpcContext(),
+		Value: &rpc.LatestBlockhashResult{
+			Blockhash:            f.latest,
+			LastValidBlockHeight: f.slot + devBlockhashValidity,
+		},
+	}, nil
+}
+
+// SendTransactionWithOpts checks a transaction as a node's preflight would and
+// lands it, unless it is dropped
+func (f *FakeRPC) SendTransactionWithOpts(ctx context.Context, tx *solana.Transaction, opts rpc.TransactionOpts) (solana.Signature, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "sendTransaction"); err != nil {
+		return solana.Signature{}, err
+	}
+
+	if failure := f.check(tx, true, true); failure != nil {
+		return solana.Signature{}, fakePreflightError(failure.Err, failure.Logs)
+	}
+	sig := tx.Signatures[0]
+	if _, ok := f.landed[sig]; ok {
+		return solana.Signature{}, fakePreflightError("AlreadyProcessed", nil)
+	}
+	if !opts.SkipPreflight && len(f.preflight) > 0 {
+		failure := f.preflight[0]
+		f.preflight = f.preflight[1:]
+		return solana.Signature{}, fakePreflightError(failure.Err, failure.Logs)
+	}
+
+	f.sent = append(f.sent, tx)
+	if f.drops > 0 {
+		f.drops--
+		return sig, nil
+	}
+	f.advance()
+	status := &fakeStatus{Slot: f.slot}
+	if len(f.onChain) > 0 {
+		status.Err = f.onChain[0]
+		f.onChain = f.onChain[1:]
+	}
+	f.landed[sig] = status
+	return sig, nil
+}
+
+// SimulateTransactionWithOpts reports a scripted preflight failure, or success
+func (f *FakeRPC) SimulateTransactionWithOpts(ctx context.Context, tx *solana.Transaction, opts *rpc.SimulateTransactionOpts) (*rpc.SimulateTransactionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "simulateTransaction"); err != nil {
+		return nil, err
+	}
+
+	sigVerify := opts != nil && opts.SigVerify
+	replaceBlockhash := opts != nil && opts.ReplaceRecentBlockhash
+	result := &rpc.SimulateTransactionResult{}
+	if failure := f.check(tx, sigVerify, !replaceBlockhash); failure != nil {
+		result.Err = failure.Err
+	} else if len(f.preflight) > 0 {
+		result.Err = f.preflight[0].Err
+		result.Logs = f.preflight[0].Logs
+		f.preflight = f.preflight[1:]
+	} else {
+		units := uint64(150 * len(tx.Message.Instructions))
+		result.UnitsConsumed = &units
+		result.Logs = []string{}
+	}
+	return &rpc.SimulateTransactionResponse{RPCContext: f.rpcContext(), Value: result}, nil
+}
+
+// check returns the failure of a transaction with missing or invalid
+// signatures when sigVerify is set, or with a stale blockhash when
+// checkBlockhash is set. Callers hold mu.
+func (f *FakeRPC) check(tx *solana.Transaction, sigVerify, checkBlockhash bool) *fakePreflight {
+	if sigVerify {
+		if len(tx.Signatures) == 0 || len(tx.Signatures) != int(tx.Message.Header.NumRequiredSignatures) {
+			return &fakePreflight{Err: "MissingSignatureForFee"}
+		}
+		if err := tx.VerifySignatures(); err != nil {
+			return &fakePreflight{Err: "SignatureFailure"}
+		}
+	}
+	if checkBlockhash && !f.blockhashes[tx.Message.RecentBlockhash] {
+		return &fakePreflight{Err: "BlockhashNotFound"}
+	}
+	return nil
+}
+
+// GetSignatureStatuses reports landed transactions, as processed for the
+// first ConfirmAfter queries and as confirmed after that
+func (f *FakeRPC) GetSignatureStatuses(ctx context.Context, searchTransactionHistory bool, sigs ...solana.Signature) (*rpc.GetSignatureStatusesResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getSignatureStatuses"); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*rpc.SignatureStatusesResult, len(sigs))
+	for i, sig := range sigs {
+		landed, ok := f.landed[sig]
+		if !ok {
+			continue
+		}
+		landed.Queries++
+		confirmation := rpc.ConfirmationStatusConfirmed
+		if landed.Queries <= f.ConfirmAfter {
+			confirmation = rpc.ConfirmationStatusProcessed
+		}
+		statuses[i] = &rpc.SignatureStatusesResult{
+			Slot:               landed.Slot,
+			Err:                landed.Err,
+			ConfirmationStatus: confirmation,
+		}
+	}
+	return &rpc.GetSignatureStatusesResult{RPCContext: f.rpcContext(), Value: statuses}, nil
+}
+
+// GetBalance returns the lamports set with SetBalance
+func (f *FakeRPC) GetBalance(ctx context.Context, account solana.PublicKey, commitment rpc.CommitmentType) (*rpc.GetBalanceResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getBalance"); err != nil {
+		return nil, err
+	}
+	return &rpc.GetBalanceResult{RPCContext: f.rpcContext(), Value: f.balances[account]}, nil
+}
+
+// GetAccountInfoWithOpts returns an account stored with SetAccount, or
+// rpc.ErrNotFound as the real client does
+func (f *FakeRPC) GetAccountInfoWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetAccountInfoOpts) (*rpc.GetAccountInfoResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getAccountInfo"); err != nil {
+		return nil, err
+	}
+	stored, ok := f.accounts[account]
+	if !ok {
+		return nil, rpc.ErrNotFound
+	}
+	return &rpc.GetAccountInfoResult{RPCContext: f.rpcContext(), Value: stored}, nil
+}
+
+// GetTokenAccountsByOwner returns the token accounts added for owner that are
+// owned by the requested program
+func (f *FakeRPC) GetTokenAccountsByOwner(ctx context.Context, owner solana.PublicKey, conf *rpc.GetTokenAccountsConfig, opts *rpc.GetTokenAccountsOpts) (*rpc.GetTokenAccountsResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getTokenAccountsByOwner"); err != nil {
+		return nil, err
+	}
+	accounts := []*rpc.TokenAccount{}
+	for _, account := range f.tokenAccounts[owner] {
+		if conf != nil && conf.ProgramId != nil && !account.Account.Owner.Equals(*conf.ProgramId) {
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+	return &rpc.GetTokenAccountsResult{RPCContext: f.rpcContext(), Value: accounts}, nil
+}
+
+// GetMinimumBalanceForRentExemption uses the mainnet rent rate
+func (f *FakeRPC) GetMinimumBalanceForRentExemption(ctx context.Context, dataSize uint64, commitment rpc.CommitmentType) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getMinimumBalanceForRentExemption"); err != nil {
+		return 0, err
+	}
+	// 3480 lamports per byte-year, for two years, with 128 bytes of overhead
+	return (128 + dataSize) * 3480 * 2, nil
+}
+
+// GetSignaturesForAddressWithOpts returns no history
+func (f *FakeRPC) GetSignaturesForAddressWithOpts(ctx context.Context, account solana.PublicKey, opts *rpc.GetSignaturesForAddressOpts) ([]*rpc.TransactionSignature, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getSignaturesForAddress"); err != nil {
+		return nil, err
+	}
+	return []*rpc.TransactionSignature{}, nil
+}
+
+// GetTransaction only knows that transactions exist, not their contents
+func (f *FakeRPC) GetTransaction(ctx context.Context, sig solana.Signature, opts *rpc.GetTransactionOpts) (*rpc.GetTransactionResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin(ctx, "getTransaction"); err != nil {
+		return nil, err
+	}
+	return nil, rpc.ErrNotFound
+}
+
+// fakePreflightError is the error the RPC client returns when a node's
+// preflight simulation fails
+func fakePreflightError(txErr interface{}, logs []string) error {
+	if logs == nil {
+		logs = []string{}
+	}
+	return &jsonrpc.RPCError{
+		Code:    rpcCodePreflightFailure,
+		Message: "Transaction simulation failed: " + fmt.Sprint(txErr),
+		Data:    map[string]interface{}{"err": txErr, "logs": logs},
+	}
+}
@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+// History entry types
+const (
+	HistoryDeposit  = "deposit"
+	HistoryWithdraw = "withdraw"
+	HistorySettings = "settings"
+	HistoryOther    = "other"
+)
+
+// signaturePageSize is the number of signatures requested per getSignaturesForAddress call
+const signaturePageSize = 1000
+
+// HistoryEntry represents a single Lulo transaction of the wallet
+type HistoryEntry struct {
+	Signature   string    `json:"signature"`
+	Slot        uint64    `json:"slot"`
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Instruction string    `json:"instruction,omitempty"`
+	Mint        string    `json:"mint,omitempty"`
+	Amount      string    `json:"amount,omitempty"`
+	Protocol    string    `json:"protocol,omitempty"`
+	Fee         uint64    `json:"fee"`
+	Failed      bool      `json:"failed,omitempty"`
+}
+
+// HistoryCache holds the Lulo history already fetched for a wallet, so re-runs
+// only need to fetch signatures newer than Newest or older than Oldest
+type HistoryCache struct {
+	Wallet   string         `json:"wallet"`
+	Newest   string         `json:"newest,omitempty"`
+	Oldest   string         `json:"oldest,omitempty"`
+	OldestAt time.Time      `json:"oldestAt,omitempty"`
+	Complete bool           `json:"complete"`
+	Entries  []HistoryEntry `json:"entries"`
+
+	path string
+}
+
+// cacheFile returns the path of a per-wallet file in the golulo cache directory
+func cacheFile(kind string, wallet solana.PublicKey) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(dir, "golulo", kind, wallet.String()+".json"), nil
+}
+
+// LoadHistoryCache reads the history cache of a wallet, returning an empty cache if none exists
+func LoadHistoryCache(wallet solana.PublicKey) (*HistoryCache, error) {
+	path, err := cacheFile("history", wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &HistoryCache{Wallet: wallet.String(), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history cache: %w", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		return nil, fmt.Errorf("failed to parse history cache %s: %w", path, err)
+	}
+	return cache, nil
+}
+
+// Save writes the history cache to disk
+func (h *HistoryCache) Save() error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history cache: %w", err)
+	}
+	if err := os.WriteFile(h.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write history cache: %w", err)
+	}
+	return nil
+}
+
+// SyncHistory fetches Lulo transactions of the wallet that are missing from the
+// cache. Older transactions are only fetched back to since, unless since is zero.
+func (c *SolanaClient) SyncHistory(ctx context.Context, cache *HistoryCache, since time.Time) error {
+	// Fetch everything newer than the newest cached signature. On the first run
+	// this walks back to since.
+	firstRun := cache.Newest == ""
+	var until solana.Signature
+	var newerSince time.Time
+	if firstRun {
+		newerSince = since
+	} else {
+		until = solana.MustSignatureFromBase58(cache.Newest)
+	}
+	newer, exhausted, err := c.walkSignatures(ctx, solana.Signature{}, until, newerSince)
+	if err != nil {
+		return err
+	}
+	if err := c.addHistory(ctx, cache, newer); err != nil {
+		return err
+	}
+	if len(newer) > 0 {
+		cache.Newest = newer[0].Signature.String()
+	}
+	if firstRun {
+		cache.Complete = exhausted
+		if len(newer) > 0 {
+			last := newer[len(newer)-1]
+			cache.Oldest = last.Signature.String()
+			cache.OldestAt = signatureTime(last)
+		}
+	}
+
+	// Extend the cache further back in time if needed
+	if !cache.Complete && cache.Oldest != "" && (since.IsZero() || since.Before(cache.OldestAt)) {
+		before := solana.MustSignatureFromBase58(cache.Oldest)
+		older, exhausted, err := c.walkSignatures(ctx, before, solana.Signature{}, since)
+		if err != nil {
+			return err
+		}
+		if err := c.addHistory(ctx, cache, older); err != nil {
+			return err
+		}
+		if len(older) > 0 {
+			last := older[len(older)-1]
+			cache.Oldest = last.Signature.String()
+			cache.OldestAt = signatureTime(last)
+		}
+		cache.Complete = exhausted
+	}
+
+	sort.Slice(cache.Entries, func(i, j int) bool {
+		return cache.Entries[i].Slot > cache.Entries[j].Slot
+	})
+	return nil
+}
+
+// walkSignatures pages backwards through the wallet's signatures between before
+// and until, stopping at since. It reports whether the start of history was reached.
+func (c *SolanaClient) walkSignatures(ctx context.Context, before, until solana.Signature, since time.Time) ([]*rpc.TransactionSignature, bool, error) {
+	limit := signaturePageSize
+	var all []*rpc.TransactionSignature
+	for {
+		page, err := c.RpcClient.GetSignaturesForAddressWithOpts(ctx, c.PublicKey, &rpc.GetSignaturesForAddressOpts{
+			Limit:      &limit,
+			Before:     before,
+			Until:      until,
+			Commitment: rpc.CommitmentFinalized,
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get signatures: %w", err)
+		}
+
+		c.log().WithFields(logrus.Fields{
+			"before": before.String(),
+			"count":  len(page),
+		}).Debug("Fetched signature page")
+
+		for _, sig := range page {
+			if !since.IsZero() && signatureTime(sig).Before(since) {
+				return all, false, nil
+			}
+			all = append(all, sig)
+		}
+		if len(page) < limit {
+			return all, until.IsZero(), nil
+		}
+		before = page[len(page)-1].Signature
+	}
+}
+
+// addHistory fetches and classifies transactions, adding Lulo ones to the cache
+func (c *SolanaClient) addHistory(ctx context.Context, cache *HistoryCache, sigs []*rpc.TransactionSignature) error {
+	for _, sig := range sigs {
+		entry, err := c.ClassifyTransaction(ctx, sig.Signature)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			cache.Entries = append(cache.Entries, *entry)
+		}
+	}
+	return nil
+}
+
+// ClassifyTransaction fetches a transaction and describes it as a Lulo history
+// entry. It returns nil if the transaction did not invoke the Lulo program.
+func (c *SolanaClient) ClassifyTransaction(ctx context.Context, sig solana.Signature) (*HistoryEntry, error) {
+	maxVersion := uint64(0)
+	out, err := c.RpcClient.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentFinalized,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", sig, err)
+	}
+	if out.Meta == nil {
+		return nil, nil
+	}
+
+	instruction, protocol, ok := luloInstruction(out.Meta.LogMessages)
+	if !ok {
+		return nil, nil
+	}
+
+	entry := &HistoryEntry{
+		Signature:   sig.String(),
+		Slot:        out.Slot,
+		Type:        classifyInstruction(instruction),
+		Instruction: instruction,
+		Protocol:    protocol,
+		Fee:         out.Meta.Fee,
+		Failed:      out.Meta.Err != nil,
+	}
+	if out.BlockTime != nil {
+		entry.Time = out.BlockTime.Time().UTC()
+	}
+	entry.Mint, entry.Amount = c.balanceChange(out.Meta)
+	return entry, nil
+}
+
+// luloInstruction walks the program logs and returns the Anchor instruction name
+// logged by the Lulo program, plus the first integrated protocol it invoked
+func luloInstruction(logs []string) (instruction, protocol string, ok bool) {
+	var stack []string
+	for _, line := range logs {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 3 && fields[0] == "Program" && fields[2] == "invoke":
+			program := fields[1]
+			if len(stack) > 0 && stack[len(stack)-1] == LuloProgramID.String() && protocol == "" {
+				protocol, _ = ProtocolName(program)
+			}
+			stack = append(stack, program)
+			if program == LuloProgramID.String() {
+				ok = true
+			}
+		case len(fields) >= 3 && fields[0] == "Program" && (fields[2] == "success" || fields[2] == "failed:"):
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case strings.HasPrefix(line, "Program log: Instruction: "):
+			if len(stack) > 0 && stack[len(stack)-1] == LuloProgramID.String() && instruction == "" {
+				instruction = strings.TrimPrefix(line, "Program log: Instruction: ")
+			}
+		}
+	}
+	return instruction, protocol, ok
+}
+
+// classifyInstruction maps a Lulo instruction name to a history entry type
+func classifyInstruction(instruction string) string {
+	name := strings.ToLower(instruction)
+	switch {
+	case strings.Contains(name, "deposit"):
+		return HistoryDeposit
+	case strings.Contains(name, "withdraw"):
+		return HistoryWithdraw
+	case strings.Contains(name, "setting"), strings.Contains(name, "update"), strings.Contains(name, "initialize"):
+		return HistorySettings
+	default:
+		return HistoryOther
+	}
+}
+
+// balanceChange returns the mint and absolute amount of the wallet's largest token
+// balance change in a transaction, falling back to native SOL
+func (c *SolanaClient) balanceChange(meta *rpc.TransactionMeta) (string, string) {
+	deltas := map[string]*big.Int{}
+	decimals := map[string]uint8{}
+	collect := func(balances []rpc.TokenBalance, sign int64) {
+		for _, balance := range balances {
+			if balance.Owner == nil || !balance.Owner.Equals(c.PublicKey) || balance.UiTokenAmount == nil {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(balance.UiTokenAmount.Amount, 10)
+			if !ok {
+				continue
+			}
+			mint := balance.Mint.String()
+			if deltas[mint] == nil {
+				deltas[mint] = new(big.Int)
+			}
+			deltas[mint].Add(deltas[mint], amount.Mul(amount, big.NewInt(sign)))
+			decimals[mint] = balance.UiTokenAmount.Decimals
+		}
+	}
+	collect(meta.PreTokenBalances, -1)
+	collect(meta.PostTokenBalances, 1)
+
+	var bestMint string
+	var best *big.Int
+	for mint, delta := range deltas {
+		abs := new(big.Int).Abs(delta)
+		if abs.Sign() != 0 && (best == nil || abs.Cmp(best) > 0) {
+			bestMint, best = mint, abs
+		}
+	}
+	if best != nil {
+		return bestMint, FormatAmount(best.Uint64(), decimals[bestMint])
+	}
+
+	// The fee payer is always the first account
+	if len(meta.PreBalances) > 0 && len(meta.PostBalances) > 0 {
+		pre, post := meta.PreBalances[0], meta.PostBalances[0]+meta.Fee
+		if pre > post {
+			return NativeSOL.Mint, FormatAmount(pre-post, NativeSOL.Decimals)
+		} else if post > pre {
+			return NativeSOL.Mint, FormatAmount(post-pre, NativeSOL.Decimals)
+		}
+	}
+	return "", ""
+}
+
+// signatureTime returns the block time of a signature, or the zero time if unknown
+func signatureTime(sig *rpc.TransactionSignature) time.Time {
+	if sig.BlockTime == nil {
+		return time.Time{}
+	}
+	return sig.BlockTime.Time().UTC()
+}
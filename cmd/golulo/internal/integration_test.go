@@ -0,0 +1,349 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+const devAPIKey = "integration-test-key"
+
+// devEnv is a dev server with clients pointed at it
+type devEnv struct {
+	dev    *DevServer
+	lulo   *LuloClient
+	client *SolanaClient
+}
+
+func newDevEnv(t *testing.T, version string) *devEnv {
+	t.Helper()
+	dev := NewDevServer(devAPIKey)
+	dev.Version = version
+
+	mux := http.NewServeMux()
+	mux.Handle("/lulo/", http.StripPrefix("/lulo", dev.Handler()))
+	mux.Handle("/rpc", dev.Bank)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	wallet, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatalf("NewRandomPrivateKey: %v", err)
+	}
+	dev.Bank.Airdrop(wallet.PublicKey(), solana.LAMPORTS_PER_SOL)
+
+	return &devEnv{
+		dev: dev,
+		lulo: &LuloClient{
+			BaseURL:        srv.URL + "/lulo",
+			APIVersion:     LuloAPIAuto,
+			APIKey:         devAPIKey,
+			HTTPClient:     srv.Client(),
+			MaxRetries:     defaultLuloRetries,
+			RetryBaseDelay: time.Millisecond,
+		},
+		client: &SolanaClient{
+			RpcClient:  rpc.New(srv.URL + "/rpc"),
+			PublicKey:  wallet.PublicKey(),
+			PrivateKey: wallet,
+		},
+	}
+}
+
+// confirm waits for every signature to be confirmed
+func (e *devEnv) confirm(t *testing.T, sigs []solana.Signature) {
+	t.Helper()
+	for _, sig := range sigs {
+		if err := e.client.ConfirmTransaction(context.Background(), sig, 10*time.Second); err != nil {
+			t.Fatalf("ConfirmTransaction(%s): %v", sig, err)
+		}
+	}
+}
+
+// deposited fetches the account and returns the amount of mint deposited
+func (e *devEnv) deposited(t *testing.T, mint string) float64 {
+	t.Helper()
+	account, err := e.lulo.GetAccount(context.Background(), e.client.WalletPubKey())
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	return account.DepositedAmount(mint)
+}
+
+func TestDevServerDepositWithdraw(t *testing.T) {
+	usdc := ResolveMint("USDC")
+
+	for _, version := range []string{LuloAPILegacy, LuloAPIV1} {
+		t.Run(version, func(t *testing.T) {
+			env := newDevEnv(t, version)
+			ctx := context.Background()
+
+			sigs, err := Deposit(ctx, env.client, env.lulo, usdc, "100", "protected")
+			if err != nil {
+				t.Fatalf("Deposit: %v", err)
+			}
+			if len(sigs) != 1 {
+				t.Fatalf("Deposit sent %d transactions, want 1", len(sigs))
+			}
+			env.confirm(t, sigs)
+
+			if got, _ := env.lulo.Version(ctx); got != version {
+				t.Errorf("detected API version %s, want %s", got, version)
+			}
+			if got := env.deposited(t, usdc); got != 100 {
+				t.Fatalf("deposited after deposit = %v, want 100", got)
+			}
+
+			sigs, err = Withdraw(ctx, env.client, env.lulo, usdc, "40", false, "protected")
+			if err != nil {
+				t.Fatalf("Withdraw: %v", err)
+			}
+			env.confirm(t, sigs)
+			if got := env.deposited(t, usdc); got != 60 {
+				t.Fatalf("deposited after withdraw = %v, want 60", got)
+			}
+
+			sigs, err = Withdraw(ctx, env.client, env.lulo, usdc, "0", true, "")
+			if err != nil {
+				t.Fatalf("Withdraw all: %v", err)
+			}
+			env.confirm(t, sigs)
+			if got := env.deposited(t, usdc); got != 0 {
+				t.Fatalf("deposited after withdrawing all = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestDevServerAccountValue(t *testing.T) {
+	env := newDevEnv(t, "")
+	ctx := context.Background()
+
+	for _, deposit := range []struct{ mint, amount, pool string }{
+		{ResolveMint("USDC"), "300", "protected"},
+		{NativeSOL.Mint, "2", "protected"},
+	} {
+		// Native SOL deposits wrap first, which the dev bank cannot, so the
+		// generated transactions are sent directly
+		txs, err := env.lulo.GenerateDeposit(ctx, DepositRequest{
+			Owner:         env.client.WalletPubKey().String(),
+			MintAddress:   deposit.mint,
+			DepositAmount: deposit.amount,
+			Pool:          deposit.pool,
+		})
+		if err != nil {
+			t.Fatalf("GenerateDeposit: %v", err)
+		}
+		sigs, err := env.client.HandleB64Transactions(ctx, txs)
+		if err != nil {
+			t.Fatalf("HandleB64Transactions: %v", err)
+		}
+		env.confirm(t, sigs)
+	}
+
+	account, err := env.lulo.GetAccount(ctx, env.client.WalletPubKey())
+	if err != nil {
+		t.Fatalf("GetAccount: %v", err)
+	}
+	if len(account.Positions) != 2 {
+		t.Fatalf("got %d positions, want 2", len(account.Positions))
+	}
+	if account.TotalValue != 600 {
+		t.Errorf("TotalValue = %v, want 600", account.TotalValue)
+	}
+	if want := (300*6.5 + 300*5.1) / 600; account.RealtimeAPY != want {
+		t.Errorf("RealtimeAPY = %v, want %v", account.RealtimeAPY, want)
+	}
+}
+
+func TestDevServerWithdrawMoreThanDeposited(t *testing.T) {
+	env := newDevEnv(t, "")
+
+	_, err := Withdraw(context.Background(), env.client, env.lulo, ResolveMint("USDC"), "10", false, "")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Withdraw error = %v, want a 400 API error", err)
+	}
+	if !strings.Contains(err.Error(), "insufficient deposited balance") {
+		t.Errorf("error %q does not carry the API's message", err)
+	}
+}
+
+func TestDevServerRetries(t *testing.T) {
+	env := newDevEnv(t, LuloAPILegacy)
+	ctx := context.Background()
+
+	// Reads are retried through rate limits and server errors
+	env.dev.Fail(DevEndpointRates, http.StatusTooManyRequests, 0, 1)
+	env.dev.Fail(DevEndpointRates, http.StatusBadGateway, 0, 1)
+	if _, err := env.lulo.GetRates(ctx); err != nil {
+		t.Fatalf("GetRates after transient failures: %v", err)
+	}
+
+	// ... but give up after MaxRetries
+	env.dev.Fail(DevEndpointRates, http.StatusServiceUnavailable, 0, env.lulo.MaxRetries+1)
+	if _, err := env.lulo.GetRates(ctx); err == nil {
+		t.Fatal("GetRates succeeded with every attempt failing")
+	}
+
+	// Transaction generation is only retried when rate limited
+	env.dev.Fail(DevEndpointDeposit, http.StatusTooManyRequests, 0, 1)
+	if _, err := env.lulo.GenerateDeposit(ctx, DepositRequest{
+		Owner:         env.client.WalletPubKey().String(),
+		MintAddress:   ResolveMint("USDC"),
+		DepositAmount: "1",
+	}); err != nil {
+		t.Fatalf("GenerateDeposit after a rate limit: %v", err)
+	}
+	env.dev.Fail(DevEndpointDeposit, http.StatusInternalServerError, 0, 1)
+	_, err := env.lulo.GenerateDeposit(ctx, DepositRequest{
+		Owner:         env.client.WalletPubKey().String(),
+		MintAddress:   ResolveMint("USDC"),
+		DepositAmount: "1",
+	})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("GenerateDeposit error = %v, want the 500 without a retry", err)
+	}
+}
+
+func TestDevServerRejectsBadAPIKey(t *testing.T) {
+	env := newDevEnv(t, LuloAPILegacy)
+	env.lulo.APIKey = "wrong"
+
+	_, err := env.lulo.GetRates(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+		t.Fatalf("GetRates error = %v, want an unauthorized API error", err)
+	}
+	if !strings.Contains(err.Error(), "lulo-api-key") {
+		t.Errorf("error %q has no hint about lulo-api-key", err)
+	}
+}
+
+func TestLuloAPIVersionDetection(t *testing.T) {
+	tests := []struct {
+		name   string
+		served string // routes served, empty for both
+		status int    // failure of the detection request, 0 for none
+		want   string
+	}{
+		{name: "v1 answers", served: LuloAPIV1, want: LuloAPIV1},
+		{name: "both served", want: LuloAPIV1},
+		{name: "v1 unknown", served: LuloAPILegacy, want: LuloAPILegacy},
+		{name: "v1 refused", status: http.StatusForbidden, want: LuloAPILegacy},
+		{name: "v1 bad request", status: http.StatusBadRequest, want: LuloAPILegacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newDevEnv(t, tt.served)
+			if tt.status != 0 {
+				env.dev.Fail(DevEndpointRates, tt.status, 0, 1)
+			}
+			if got, err := env.lulo.Version(context.Background()); err != nil || got != tt.want {
+				t.Errorf("Version = %s, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+
+	// Unreachable or failing APIs are detected again on the next request
+	env := newDevEnv(t, LuloAPIV1)
+	env.dev.Fail(DevEndpointRates, http.StatusServiceUnavailable, 0, env.lulo.MaxRetries+1)
+	if _, err := env.lulo.Version(context.Background()); err == nil {
+		t.Fatal("Version succeeded with every detection attempt failing")
+	}
+	if got, err := env.lulo.Version(context.Background()); err != nil || got != LuloAPIV1 {
+		t.Errorf("Version after the API recovered = %s, %v; want %s", got, err, LuloAPIV1)
+	}
+
+	// Configured versions are used without asking the API
+	for value, want := range map[string]string{"": LuloAPILegacy, " V1 ": LuloAPIV1, "auto": LuloAPIAuto} {
+		if got, err := ParseLuloAPIVersion(value); err != nil || got != want {
+			t.Errorf("ParseLuloAPIVersion(%q) = %s, %v; want %s", value, got, err, want)
+		}
+	}
+	if _, err := ParseLuloAPIVersion("v2"); err == nil {
+		t.Error("ParseLuloAPIVersion accepted an unknown version")
+	}
+}
+
+func TestDevBankRejectsBadTransactions(t *testing.T) {
+	env := newDevEnv(t, "")
+	ctx := context.Background()
+	wallet := env.client.WalletPubKey()
+
+	newTx := func(blockhash solana.Hash) *solana.Transaction {
+		tx, err := solana.NewTransaction(
+			[]solana.Instruction{devMemo("hello", wallet)},
+			blockhash,
+			solana.TransactionPayer(wallet),
+		)
+		if err != nil {
+			t.Fatalf("NewTransaction: %v", err)
+		}
+		return tx
+	}
+	preflight := func(err error, want string) {
+		t.Helper()
+		var rpcErr *jsonrpc.RPCError
+		if !errors.As(err, &rpcErr) || !strings.Contains(rpcErr.Message, want) {
+			t.Fatalf("error = %v, want a preflight failure with %q", err, want)
+		}
+	}
+
+	// Unknown blockhash
+	tx := newTx(solana.Hash{1})
+	env.client.SignTransaction(tx)
+	_, err := env.client.SendTransaction(ctx, tx)
+	preflight(err, "Blockhash not found")
+
+	// Signed by the wrong key
+	tx = newTx(env.dev.Bank.LatestBlockhash())
+	other, _ := solana.NewRandomPrivateKey()
+	tx.Signatures = []solana.Signature{{}}
+	tx.Signatures[0], _ = other.Sign([]byte("not the message"))
+	_, err = env.client.SendTransaction(ctx, tx)
+	preflight(err, "signature verification failed")
+
+	// Sent twice
+	tx = newTx(env.dev.Bank.LatestBlockhash())
+	env.client.SignTransaction(tx)
+	if _, err := env.client.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	_, err = env.client.SendTransaction(ctx, tx)
+	preflight(err, "already been processed")
+}
+
+func TestDevServerAllowedProtocols(t *testing.T) {
+	usdc := ResolveMint("USDC")
+	env := newDevEnv(t, LuloAPILegacy)
+	ctx := context.Background()
+
+	env.lulo.AllowedProtocols = []string{"kamino"}
+	sigs, err := Deposit(ctx, env.client, env.lulo, usdc, "100", "")
+	if err == nil || !strings.Contains(err.Error(), "lulo-dev") {
+		t.Fatalf("Deposit into a protocol that is not allowed = %v, want an error naming it", err)
+	}
+	if len(sigs) != 0 {
+		t.Fatalf("Deposit sent %d transactions", len(sigs))
+	}
+
+	env.lulo.AllowedProtocols = []string{"kamino", "LULO-DEV"}
+	sigs, err = Deposit(ctx, env.client, env.lulo, usdc, "100", "")
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	env.confirm(t, sigs)
+	if got := env.deposited(t, usdc); got != 100 {
+		t.Fatalf("deposited = %v, want 100", got)
+	}
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DefaultBlockEngineURL is the Jito block engine used unless one is configured
+const DefaultBlockEngineURL = "https://mainnet.block-engine.jito.wtf"
+
+// MaxBundleTransactions is the most transactions a Jito bundle may contain,
+// including the tip transaction
+const MaxBundleTransactions = 5
+
+// Jito inflight bundle statuses
+const (
+	BundlePending = "Pending"
+	BundleLanded  = "Landed"
+	BundleFailed  = "Failed"
+	BundleInvalid = "Invalid" // not known to the block engine
+)
+
+// ErrBundlesUnavailable is returned when the block engine did not accept a
+// bundle, so nothing was sent and the transactions can be sent another way
+var ErrBundlesUnavailable = errors.New("jito bundles unavailable")
+
+// JitoConfig is the `jito` section of the config file
+type JitoConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	BlockEngineURL string        `mapstructure:"block-engine-url"`
+	Tip            float64       `mapstructure:"tip"`     // SOL paid to the tip account
+	Timeout        time.Duration `mapstructure:"timeout"` // how long to wait for a bundle to land
+}
+
+// JitoClient submits transaction bundles to a Jito block engine
+type JitoClient struct {
+	URL          string
+	TipLamports  uint64
+	Timeout      time.Duration
+	PollInterval time.Duration
+	HTTPClient   *http.Client
+	Log          *logrus.Entry
+}
+
+// LoadJitoClient creates a Jito client from the config, or returns nil when
+// bundles are disabled
+func LoadJitoClient() (*JitoClient, error) {
+	var cfg JitoConfig
+	if err := viper.UnmarshalKey("jito", &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse jito config: %w", err)
+	}
+	// Read separately so the --jito flag overrides the config file
+	cfg.Enabled = viper.GetBool("jito.enabled")
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return NewJitoClient(cfg)
+}
+
+// NewJitoClient creates a Jito client, filling in defaults
+func NewJitoClient(cfg JitoConfig) (*JitoClient, error) {
+	if cfg.BlockEngineURL == "" {
+		cfg.BlockEngineURL = DefaultBlockEngineURL
+	}
+	if cfg.Tip == 0 {
+		cfg.Tip = 0.0001
+	}
+	if cfg.Tip < 0 {
+		return nil, fmt.Errorf("jito tip must be positive")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	tip, err := ToBaseUnits(FloatAmount(cfg.Tip), NativeSOL.Decimals)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jito tip: %w", err)
+	}
+	return &JitoClient{
+		URL:          strings.TrimRight(cfg.BlockEngineURL, "/"),
+		TipLamports:  tip,
+		Timeout:      cfg.Timeout,
+		PollInterval: defaultConfirmPollInterval,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// log returns the client's logger
+func (j *JitoClient) log() *logrus.Entry {
+	if j.Log == nil {
+		return standardLogger()
+	}
+	return j.Log
+}
+
+// jitoRequest is a JSON-RPC request to the block engine
+type jitoRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// jitoResponse is a JSON-RPC response from the block engine
+type jitoResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call invokes a block engine JSON-RPC method and decodes its result into out
+func (j *JitoClient) call(ctx context.Context, path, method string, params []interface{}, out interface{}) error {
+	body, err := json.Marshal(jitoRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := j.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d: %s", method, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var rpcResp jitoResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("%s failed: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+	if err := json.Unmarshal(rpcResp.Result, out); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+	return nil
+}
+
+// TipAccounts returns the accounts the block engine accepts tips on
+func (j *JitoClient) TipAccounts(ctx context.Context) ([]solana.PublicKey, error) {
+	var accounts []string
+	if err := j.call(ctx, "/api/v1/getTipAccounts", "getTipAccounts", []interface{}{}, &accounts); err != nil {
+		return nil, err
+	}
+	keys := make([]solana.PublicKey, 0, len(accounts))
+	for _, account := range accounts {
+		key, err := solana.PublicKeyFromBase58(account)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tip account %q: %w", account, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("block engine returned no tip accounts")
+	}
+	return keys, nil
+}
+
+// SendBundle submits signed transactions as a bundle and returns its ID
+func (j *JitoClient) SendBundle(ctx context.Context, txs []*solana.Transaction) (string, error) {
+	encoded := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		data, err := tx.MarshalBinary()
+		if err != nil {
+			return "", fmt.Errorf("failed to encode transaction: %w", err)
+		}
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(data))
+	}
+
+	var bundleID string
+	params := []interface{}{encoded, map[string]string{"encoding": "base64"}}
+	if err := j.call(ctx, "/api/v1/bundles", "sendBundle", params, &bundleID); err != nil {
+		return "", err
+	}
+	return bundleID, nil
+}
+
+// BundleStatus returns the inflight status of a bundle
+func (j *JitoClient) BundleStatus(ctx context.Context, bundleID string) (string, error) {
+	var result struct {
+		Value []struct {
+			BundleID string `json:"bundle_id"`
+			Status   string `json:"status"`
+		} `json:"value"`
+	}
+	params := []interface{}{[]string{bundleID}}
+	if err := j.call(ctx, "/api/v1/getInflightBundleStatuses", "getInflightBundleStatuses", params, &result); err != nil {
+		return "", err
+	}
+	for _, status := range result.Value {
+		if status.BundleID == bundleID {
+			return status.Status, nil
+		}
+	}
+	return BundleInvalid, nil
+}
+
+// WaitForBundle polls a bundle until it lands, fails or the timeout elapses
+func (j *JitoClient) WaitForBundle(ctx context.Context, bundleID string) error {
+	ctx, cancel := context.WithTimeout(ctx, j.Timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(j.PollInterval)
+	defer ticker.Stop()
+
+	last := BundlePending
+	for {
+		status, err := j.BundleStatus(ctx, bundleID)
+		if err != nil {
+			j.log().WithError(err).WithField("bundle", bundleID).Debug("Failed to get bundle status")
+		} else {
+			last = status
+			switch status {
+			case BundleLanded:
+				return nil
+			case BundleFailed:
+				return fmt.Errorf("bundle %s failed: no transactions landed", bundleID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("bundle %s not landed (last status %s): %w", bundleID, last, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAsBundle sends signed transactions as one Jito bundle with a tip
+// transaction appended, and waits for it to land. It returns
+// ErrBundlesUnavailable when the block engine did not accept the bundle.
+func (c *SolanaClient) sendAsBundle(ctx context.Context, txs []*solana.Transaction, blockhash solana.Hash) error {
+	if len(txs)+1 > MaxBundleTransactions {
+		return fmt.Errorf("%w: %d transactions do not fit in a bundle", ErrBundlesUnavailable, len(txs))
+	}
+
+	tipAccounts, err := c.Jito.TipAccounts(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBundlesUnavailable, err)
+	}
+	tipAccount := tipAccounts[rand.Intn(len(tipAccounts))]
+
+	tipTx, err := solana.NewTransaction(
+		[]solana.Instruction{system.NewTransferInstruction(c.Jito.TipLamports, c.PublicKey, tipAccount).Build()},
+		blockhash,
+		solana.TransactionPayer(c.PublicKey),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create tip transaction: %w", err)
+	}
+	if _, err := c.SignTransaction(tipTx); err != nil {
+		return fmt.Errorf("failed to sign tip transaction: %w", err)
+	}
+
+	bundleID, err := c.Jito.SendBundle(ctx, append(txs, tipTx))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBundlesUnavailable, err)
+	}
+	for _, tx := range txs {
+		recordSent(ctx, SentTransaction{Signature: tx.Signatures[0], Wallet: c.PublicKey, Status: SentBundle, Bundle: bundleID})
+	}
+
+	logger := c.log().WithFields(logrus.Fields{
+		"bundle":       bundleID,
+		"transactions": len(txs),
+		"tipLamports":  c.Jito.TipLamports,
+		"tipAccount":   tipAccount.String(),
+	})
+	logger.Info("Bundle sent, waiting for it to land")
+
+	if err := c.Jito.WaitForBundle(ctx, bundleID); err != nil {
+		return err
+	}
+	logger.Info("Bundle landed")
+	return nil
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// fakeBlockEngine is a stand-in for a Jito block engine
+type fakeBlockEngine struct {
+	tipAccount solana.PublicKey
+	rejectSend bool   // fail sendBundle with a server error
+	status     string // inflight status reported for the bundle
+
+	mu      sync.Mutex
+	bundles [][]*solana.Transaction
+}
+
+func (e *fakeBlockEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "getTipAccounts":
+		result = []string{e.tipAccount.String()}
+	case "sendBundle":
+		if e.rejectSend {
+			http.Error(w, "bundles are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		var encoded []string
+		json.Unmarshal(req.Params[0], &encoded)
+		var bundle []*solana.Transaction
+		for _, tx := range encoded {
+			data, _ := base64.StdEncoding.DecodeString(tx)
+			decoded, err := solana.TransactionFromBytes(data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			bundle = append(bundle, decoded)
+		}
+		e.mu.Lock()
+		e.bundles = append(e.bundles, bundle)
+		e.mu.Unlock()
+		result = "bundle-1"
+	case "getInflightBundleStatuses":
+		result = map[string]interface{}{"value": []map[string]string{{"bundle_id": "bundle-1", "status": e.status}}}
+	default:
+		http.Error(w, "unknown method "+req.Method, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+// sent returns the bundles the block engine accepted
+func (e *fakeBlockEngine) sent() [][]*solana.Transaction {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bundles
+}
+
+// newJitoClient returns a fake client that sends bundles to a fake block engine
+func newJitoClient(t *testing.T, engine *fakeBlockEngine) (*SolanaClient, *FakeRPC) {
+	t.Helper()
+	tip, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.tipAccount = tip.PublicKey()
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+
+	client, fake := newFakeClient(t)
+	client.Jito = &JitoClient{
+		URL:          srv.URL,
+		TipLamports:  1000,
+		Timeout:      time.Second,
+		PollInterval: time.Millisecond,
+		HTTPClient:   srv.Client(),
+	}
+	return client, fake
+}
+
+// jitoTransactions returns three API transactions for the wallet
+func jitoTransactions(t *testing.T, client *SolanaClient) []string {
+	t.Helper()
+	wallet := client.WalletPubKey()
+	return []string{
+		apiTransaction(t, "first", wallet),
+		apiTransaction(t, "second", wallet),
+		apiTransaction(t, "third", wallet),
+	}
+}
+
+func TestHandleB64TransactionsBundleLands(t *testing.T) {
+	engine := &fakeBlockEngine{status: BundleLanded}
+	client, fake := newJitoClient(t, engine)
+
+	sigs, err := client.HandleB64Transactions(context.Background(), jitoTransactions(t, client))
+	if err != nil {
+		t.Fatalf("HandleB64Transactions: %v", err)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Errorf("%d transactions sent over RPC, want all in the bundle", len(fake.Sent()))
+	}
+
+	bundles := engine.sent()
+	if len(bundles) != 1 || len(bundles[0]) != 4 {
+		t.Fatalf("block engine received %d bundles, want one of 3 transactions and a tip", len(bundles))
+	}
+	bundle := bundles[0]
+	for i, sig := range sigs {
+		if bundle[i].Signatures[0] != sig {
+			t.Errorf("signature %d = %s, bundle has %s", i, sig, bundle[i].Signatures[0])
+		}
+	}
+	for i, tx := range bundle {
+		if err := tx.VerifySignatures(); err != nil {
+			t.Errorf("bundle transaction %d: %v", i, err)
+		}
+		if tx.Message.RecentBlockhash != bundle[0].Message.RecentBlockhash {
+			t.Errorf("bundle transaction %d uses another blockhash", i)
+		}
+	}
+	if got := DecodeTransaction(bundle[3], nil, client.WalletPubKey()).Summary(); got != "System: Transfer" {
+		t.Errorf("tip transaction = %q, want a transfer", got)
+	}
+	if writable, err := bundle[3].IsWritable(engine.tipAccount); err != nil || !writable {
+		t.Error("tip transaction does not pay the tip account")
+	}
+}
+
+func TestHandleB64TransactionsBundleUnavailable(t *testing.T) {
+	engine := &fakeBlockEngine{rejectSend: true}
+	client, fake := newJitoClient(t, engine)
+
+	sigs, err := client.HandleB64Transactions(context.Background(), jitoTransactions(t, client))
+	if err != nil {
+		t.Fatalf("HandleB64Transactions: %v", err)
+	}
+	sent := fake.Sent()
+	if len(sent) != 3 || len(sigs) != 3 {
+		t.Fatalf("sent %d transactions and returned %d signatures, want 3 each", len(sent), len(sigs))
+	}
+	// The transactions signed for the bundle are sent as they are, so they cannot land twice
+	for i, tx := range sent {
+		if tx.Signatures[0] != sigs[i] {
+			t.Errorf("transaction %d sent as %s, want %s", i, tx.Signatures[0], sigs[i])
+		}
+	}
+	if fake.Calls("getLatestBlockhash") != 1 {
+		t.Errorf("fetched %d blockhashes, want the bundle's one reused", fake.Calls("getLatestBlockhash"))
+	}
+}
+
+func TestHandleB64TransactionsBundleFailed(t *testing.T) {
+	engine := &fakeBlockEngine{status: BundleFailed}
+	client, fake := newJitoClient(t, engine)
+
+	sigs, err := client.HandleB64Transactions(context.Background(), jitoTransactions(t, client))
+	if err == nil {
+		t.Fatal("HandleB64Transactions succeeded with a failed bundle")
+	}
+	if errors.Is(err, ErrBundlesUnavailable) || len(sigs) != 0 {
+		t.Errorf("err = %v, sigs = %v; want a failure without signatures", err, sigs)
+	}
+	if len(fake.Sent()) != 0 {
+		t.Errorf("%d transactions sent over RPC after the bundle failed", len(fake.Sent()))
+	}
+}
+
+func TestHandleB64TransactionsBundleTimeout(t *testing.T) {
+	engine := &fakeBlockEngine{status: BundlePending}
+	client, fake := newJitoClient(t, engine)
+	client.Jito.Timeout = 50 * time.Millisecond
+
+	sigs, err := client.HandleB64Transactions(context.Background(), jitoTransactions(t, client))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	bundles := engine.sent()
+	if len(sigs) != 3 || len(bundles) != 1 {
+		t.Fatalf("returned %d signatures for %d bundles, want the 3 that may still land", len(sigs), len(bundles))
+	}
+	for i, sig := range sigs {
+		if bundles[0][i].Signatures[0] != sig {
+			t.Errorf("signature %d = %s, want %s", i, sig, bundles[0][i].Signatures[0])
+		}
+	}
+	if len(fake.Sent()) != 0 {
+		t.Errorf("%d transactions sent over RPC while the bundle may still land", len(fake.Sent()))
+	}
+}
+
+func TestHandleB64TransactionsSingleSkipsBundle(t *testing.T) {
+	engine := &fakeBlockEngine{status: BundleLanded}
+	client, fake := newJitoClient(t, engine)
+
+	if _, err := client.HandleB64Transactions(context.Background(), jitoTransactions(t, client)[:1]); err != nil {
+		t.Fatalf("HandleB64Transactions: %v", err)
+	}
+	if len(engine.sent()) != 0 || len(fake.Sent()) != 1 {
+		t.Errorf("sent %d bundles and %d transactions, want a single transaction without a bundle", len(engine.sent()), len(fake.Sent()))
+	}
+}
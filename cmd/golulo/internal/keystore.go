@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// keystoreIterations is the PBKDF2 work factor for new encrypted keypairs
+const keystoreIterations = 600_000
+
+// EncryptedKeypair is a keypair file encrypted with a passphrase using
+// PBKDF2-SHA256 and AES-256-GCM
+type EncryptedKeypair struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+	PublicKey  string `json:"publicKey"` // lets watch-only lookups skip the passphrase
+}
+
+// EncryptKeypair encrypts a private key with a passphrase
+func EncryptKeypair(privateKey solana.PrivateKey, passphrase string) (*EncryptedKeypair, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+	if err := privateKey.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid keypair: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := keystoreCipher(passphrase, salt, keystoreIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &EncryptedKeypair{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: keystoreIterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, privateKey, nil),
+		PublicKey:  privateKey.PublicKey().String(),
+	}, nil
+}
+
+// Decrypt returns the private key, failing when the passphrase is wrong or
+// the key does not match the public key stored next to it
+func (k *EncryptedKeypair) Decrypt(passphrase string) (solana.PrivateKey, error) {
+	if k.Version != 1 || k.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported encrypted keypair (version %d, kdf %s)", k.Version, k.KDF)
+	}
+	gcm, err := keystoreCipher(passphrase, k.Salt, k.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted keypair: nonce is %d bytes", len(k.Nonce))
+	}
+	plaintext, err := gcm.Open(nil, k.Nonce, k.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keypair: wrong passphrase")
+	}
+	privateKey := solana.PrivateKey(plaintext)
+	if err := privateKey.Validate(); err != nil {
+		return nil, fmt.Errorf("decrypted keypair is invalid: %w", err)
+	}
+	if privateKey.PublicKey().String() != k.PublicKey {
+		return nil, fmt.Errorf("decrypted keypair does not match its public key %s", k.PublicKey)
+	}
+	return privateKey, nil
+}
+
+// parseEncryptedKeypair decodes an encrypted keypair file, reporting false
+// for plain Solana CLI keypair files
+func parseEncryptedKeypair(data []byte) (*EncryptedKeypair, bool, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, false, nil
+	}
+	var keypair EncryptedKeypair
+	if err := json.Unmarshal(data, &keypair); err != nil {
+		return nil, true, fmt.Errorf("failed to parse encrypted keypair file: %w", err)
+	}
+	return &keypair, true, nil
+}
+
+// keypairPassphrase returns the passphrase for an encrypted keypair: the
+// passphrase of the profile using it, or keypair-passphrase
+func keypairPassphrase(path string) (string, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return "", err
+	}
+	for _, profile := range profiles {
+		if profile.Keypair == path && profile.Passphrase != "" {
+			passphrase, err := ResolveSecret(profile.Passphrase)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve passphrase of profile %s: %w", profile.Name, err)
+			}
+			return passphrase, nil
+		}
+	}
+
+	passphrase, err := ConfigSecret("keypair-passphrase")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("keypair %s is encrypted: set keypair-passphrase", path)
+	}
+	return passphrase, nil
+}
+
+// keystoreCipher derives the AES-GCM cipher for a passphrase
+func keystoreCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("invalid iteration count %d", iterations)
+	}
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/viper"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// encryptTestKeypair returns a new private key and its encrypted form
+func encryptTestKeypair(t *testing.T) (solana.PrivateKey, *EncryptedKeypair) {
+	t.Helper()
+	privateKey, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := EncryptKeypair(privateKey, testPassphrase)
+	if err != nil {
+		t.Fatalf("EncryptKeypair: %v", err)
+	}
+	return privateKey, encrypted
+}
+
+func TestEncryptedKeypairRoundTrip(t *testing.T) {
+	privateKey, encrypted := encryptTestKeypair(t)
+	if encrypted.PublicKey != privateKey.PublicKey().String() || encrypted.Iterations != keystoreIterations {
+		t.Errorf("encrypted keypair = %+v", encrypted)
+	}
+	if strings.Contains(string(encrypted.Ciphertext), string(privateKey)) {
+		t.Error("ciphertext contains the private key")
+	}
+
+	// Through a file, as the keypair command writes it
+	data, err := json.Marshal(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok, err := parseEncryptedKeypair(data)
+	if !ok || err != nil {
+		t.Fatalf("parseEncryptedKeypair = %v, %v", ok, err)
+	}
+	decrypted, err := parsed.Decrypt(testPassphrase)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !decrypted.PublicKey().Equals(privateKey.PublicKey()) || decrypted.String() != privateKey.String() {
+		t.Error("decrypted keypair differs from the original")
+	}
+
+	// Salt and nonce are fresh for every encryption
+	again, err := EncryptKeypair(privateKey, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again.Salt) == string(encrypted.Salt) || string(again.Nonce) == string(encrypted.Nonce) {
+		t.Error("salt or nonce reused")
+	}
+}
+
+func TestEncryptKeypairInvalid(t *testing.T) {
+	privateKey, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncryptKeypair(privateKey, ""); err == nil {
+		t.Error("EncryptKeypair accepted an empty passphrase")
+	}
+	if _, err := EncryptKeypair(privateKey[:32], testPassphrase); err == nil {
+		t.Error("EncryptKeypair accepted a truncated key")
+	}
+}
+
+func TestEncryptedKeypairDecryptFails(t *testing.T) {
+	_, encrypted := encryptTestKeypair(t)
+	other, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		tamper     func(k *EncryptedKeypair)
+		want       string
+	}{
+		{name: "wrong passphrase", passphrase: "incorrect horse battery staple", want: "wrong passphrase"},
+		{name: "empty passphrase", passphrase: "", want: "wrong passphrase"},
+		{name: "ciphertext", tamper: func(k *EncryptedKeypair) { k.Ciphertext[0] ^= 1 }, want: "wrong passphrase"},
+		{name: "truncated ciphertext", tamper: func(k *EncryptedKeypair) { k.Ciphertext = k.Ciphertext[:len(k.Ciphertext)-1] }, want: "wrong passphrase"},
+		{name: "salt", tamper: func(k *EncryptedKeypair) { k.Salt[0] ^= 1 }, want: "wrong passphrase"},
+		{name: "nonce", tamper: func(k *EncryptedKeypair) { k.Nonce[0] ^= 1 }, want: "wrong passphrase"},
+		{name: "short nonce", tamper: func(k *EncryptedKeypair) { k.Nonce = k.Nonce[:4] }, want: "nonce is 4 bytes"},
+		{name: "iterations", tamper: func(k *EncryptedKeypair) { k.Iterations = 1000 }, want: "wrong passphrase"},
+		{name: "no iterations", tamper: func(k *EncryptedKeypair) { k.Iterations = 0 }, want: "invalid iteration count"},
+		{name: "public key", tamper: func(k *EncryptedKeypair) { k.PublicKey = other.PublicKey().String() }, want: "does not match its public key"},
+		{name: "version", tamper: func(k *EncryptedKeypair) { k.Version = 2 }, want: "unsupported"},
+		{name: "kdf", tamper: func(k *EncryptedKeypair) { k.KDF = "scrypt" }, want: "unsupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := *encrypted
+			k.Salt = append([]byte(nil), encrypted.Salt...)
+			k.Nonce = append([]byte(nil), encrypted.Nonce...)
+			k.Ciphertext = append([]byte(nil), encrypted.Ciphertext...)
+			passphrase := testPassphrase
+			if tt.tamper != nil {
+				tt.tamper(&k)
+			} else {
+				passphrase = tt.passphrase
+			}
+			privateKey, err := k.Decrypt(passphrase)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decrypt error = %v, want %q", err, tt.want)
+			}
+			if privateKey != nil {
+				t.Error("Decrypt returned a key with its error")
+			}
+		})
+	}
+}
+
+func TestParseEncryptedKeypair(t *testing.T) {
+	plain, err := json.Marshal([]byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := parseEncryptedKeypair(plain); ok || err != nil {
+		t.Errorf("plain keypair file parsed as encrypted: %v, %v", ok, err)
+	}
+	if _, ok, err := parseEncryptedKeypair([]byte("  {not json")); !ok || err == nil {
+		t.Errorf("malformed encrypted keypair file = %v, %v; want an error", ok, err)
+	}
+}
+
+func TestLoadEncryptedKeypair(t *testing.T) {
+	privateKey, encrypted := encryptTestKeypair(t)
+	data, err := json.MarshalIndent(encrypted, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "id.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { viper.Set("keypair-passphrase", "") })
+
+	// The public key needs no passphrase
+	publicKey, err := KeypairPublicKey(path)
+	if err != nil || !publicKey.Equals(privateKey.PublicKey()) {
+		t.Errorf("KeypairPublicKey = %s, %v", publicKey, err)
+	}
+	if _, err := LoadKeypair(path); err == nil || !strings.Contains(err.Error(), "set keypair-passphrase") {
+		t.Errorf("LoadKeypair without a passphrase = %v", err)
+	}
+
+	viper.Set("keypair-passphrase", testPassphrase)
+	loaded, err := LoadKeypair(path)
+	if err != nil {
+		t.Fatalf("LoadKeypair: %v", err)
+	}
+	if loaded.String() != privateKey.String() {
+		t.Error("loaded keypair differs from the original")
+	}
+}
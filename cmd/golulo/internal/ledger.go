@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Cost basis methods
+const (
+	CostBasisFIFO    = "fifo"
+	CostBasisAverage = "average"
+)
+
+// Ledger row types
+const (
+	LedgerDeposit  = "deposit"
+	LedgerWithdraw = "withdraw"
+	LedgerInterest = "interest_snapshot"
+)
+
+// LedgerColumns are the CSV columns of an export, in order. Downstream
+// spreadsheets depend on them, so only ever append new columns.
+var LedgerColumns = []string{
+	"date",                // RFC 3339 UTC time of the event
+	"type",                // deposit, withdraw or interest_snapshot
+	"token",               // token symbol
+	"mint",                // token mint address
+	"amount",              // token amount moved
+	"price_usd",           // USD price of the token at event time
+	"value_usd",           // USD value of the amount, or total account value for snapshots
+	"cost_basis_usd",      // USD cost of the lot (deposit) or of the principal withdrawn
+	"realized_yield",      // token amount withdrawn in excess of principal
+	"realized_gain_usd",   // value_usd minus cost_basis_usd on withdrawals
+	"interest_earned_usd", // cumulative interest earned, snapshots only
+	"fee_sol",             // network fee paid in SOL
+	"signature",           // transaction signature
+}
+
+// LedgerRow is a single entry of the accounting ledger. Every row has every
+// field; numbers that do not apply to the row type, or that depend on a price
+// that is unknown, are nil.
+type LedgerRow struct {
+	Date              time.Time `json:"date"`
+	Type              string    `json:"type"`
+	Token             string    `json:"token"`
+	Mint              string    `json:"mint"`
+	Amount            *float64  `json:"amount"`
+	PriceUSD          *float64  `json:"priceUsd"`
+	ValueUSD          *float64  `json:"valueUsd"`
+	CostBasisUSD      *float64  `json:"costBasisUsd"`
+	RealizedYield     *float64  `json:"realizedYield"`
+	RealizedGainUSD   *float64  `json:"realizedGainUsd"`
+	InterestEarnedUSD *float64  `json:"interestEarnedUsd"`
+	FeeSOL            string    `json:"feeSol"`
+	Signature         string    `json:"signature"`
+}
+
+// lot is a deposited amount and what it cost. unpriced lots were deposited
+// while the token had no known price, so their cost is unknown.
+type lot struct {
+	amount   float64
+	costUSD  float64
+	unpriced bool
+}
+
+// BuildLedger turns Lulo history and account snapshots into ledger rows between
+// from and to (either may be zero). Cost basis is tracked over the full history
+// so withdrawals inside the range consume lots deposited before it.
+func BuildLedger(ctx context.Context, entries []HistoryEntry, snapshots []AccountSnapshot, prices PriceSource, method string, from, to time.Time) ([]LedgerRow, error) {
+	if method != CostBasisFIFO && method != CostBasisAverage {
+		return nil, fmt.Errorf("unknown cost basis method %q, expected %s or %s", method, CostBasisFIFO, CostBasisAverage)
+	}
+
+	events := make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Failed || (entry.Type != HistoryDeposit && entry.Type != HistoryWithdraw) {
+			continue
+		}
+		if entry.Amount == "" {
+			LoggerFrom(ctx).WithField("signature", entry.Signature).Warn("Skipping Lulo transaction without a token amount")
+			continue
+		}
+		events = append(events, entry)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Slot < events[j].Slot
+	})
+
+	lots := map[string][]lot{}
+	var rows []LedgerRow
+	for _, entry := range events {
+		amount, err := strconv.ParseFloat(entry.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q in %s: %w", entry.Amount, entry.Signature, err)
+		}
+		priced := true
+		price, err := prices.PriceAt(ctx, entry.Mint, entry.Time)
+		if errors.Is(err, ErrPriceUnknown) {
+			LoggerFrom(ctx).WithError(err).WithField("signature", entry.Signature).
+				Warn("Exporting transaction without a USD price")
+			priced = false
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to price %s: %w", entry.Signature, err)
+		}
+
+		row := LedgerRow{
+			Date:      entry.Time.UTC(),
+			Type:      entry.Type,
+			Token:     TokenSymbol(entry.Mint),
+			Mint:      entry.Mint,
+			Amount:    &amount,
+			FeeSOL:    FormatAmount(entry.Fee, NativeSOL.Decimals),
+			Signature: entry.Signature,
+		}
+		if priced {
+			row.PriceUSD = &price
+			row.ValueUSD = usd(amount * price)
+		}
+
+		if entry.Type == HistoryDeposit {
+			lots[entry.Mint] = append(lots[entry.Mint], lot{amount: amount, costUSD: amount * price, unpriced: !priced})
+			row.CostBasisUSD = row.ValueUSD
+		} else {
+			var principal, cost float64
+			var unpriced bool
+			lots[entry.Mint], principal, cost, unpriced = consumeLots(lots[entry.Mint], amount, method)
+			row.RealizedYield = float(roundAmount(amount - principal))
+			if !unpriced {
+				row.CostBasisUSD = usd(cost)
+			}
+			if priced && !unpriced {
+				row.RealizedGainUSD = usd(amount*price - cost)
+			}
+		}
+
+		if inRange(row.Date, from, to) {
+			rows = append(rows, row)
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		if !inRange(snapshot.Time, from, to) {
+			continue
+		}
+		rows = append(rows, LedgerRow{
+			Date:              snapshot.Time.UTC(),
+			Type:              LedgerInterest,
+			ValueUSD:          usd(snapshot.TotalValue),
+			InterestEarnedUSD: usd(snapshot.InterestEarned),
+		})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Date.Before(rows[j].Date)
+	})
+	return rows, nil
+}
+
+// consumeLots removes up to amount of principal from lots and returns the
+// remaining lots, the principal removed, its cost and whether part of the
+// principal came from an unpriced lot, which makes the cost unknown
+func consumeLots(lots []lot, amount float64, method string) ([]lot, float64, float64, bool) {
+	if method == CostBasisAverage {
+		var total, totalCost float64
+		unpriced := false
+		for _, l := range lots {
+			total += l.amount
+			totalCost += l.costUSD
+			unpriced = unpriced || l.unpriced
+		}
+		if total <= 0 {
+			return nil, 0, 0, false
+		}
+		principal := math.Min(amount, total)
+		cost := totalCost * principal / total
+		if principal >= total {
+			return nil, principal, cost, unpriced
+		}
+		return []lot{{amount: total - principal, costUSD: totalCost - cost, unpriced: unpriced}}, principal, cost, unpriced
+	}
+
+	var principal, cost float64
+	unpriced := false
+	for len(lots) > 0 && principal < amount {
+		take := math.Min(amount-principal, lots[0].amount)
+		share := lots[0].costUSD * take / lots[0].amount
+		principal += take
+		cost += share
+		unpriced = unpriced || lots[0].unpriced
+		if take >= lots[0].amount {
+			lots = lots[1:]
+		} else {
+			lots[0] = lot{amount: lots[0].amount - take, costUSD: lots[0].costUSD - share, unpriced: lots[0].unpriced}
+		}
+	}
+	return lots, principal, cost, unpriced
+}
+
+// WriteLedgerCSV writes ledger rows as CSV with LedgerColumns as header.
+// Columns that do not apply to a row type, or whose price is unknown, are left empty.
+func WriteLedgerCSV(w io.Writer, rows []LedgerRow) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(LedgerColumns); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := []string{
+			row.Date.Format(time.RFC3339),
+			row.Type,
+			row.Token,
+			row.Mint,
+			formatFloat(row.Amount),
+			formatFloat(row.PriceUSD),
+			formatUSD(row.ValueUSD),
+			formatUSD(row.CostBasisUSD),
+			formatFloat(row.RealizedYield),
+			formatUSD(row.RealizedGainUSD),
+			formatUSD(row.InterestEarnedUSD),
+			row.FeeSOL,
+			row.Signature,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteLedgerJSON writes ledger rows as an indented JSON array
+func WriteLedgerJSON(w io.Writer, rows []LedgerRow) error {
+	if rows == nil {
+		rows = []LedgerRow{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// inRange reports whether t lies in [from, to), treating zero bounds as open
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+func roundAmount(value float64) float64 {
+	return math.Round(value*1e9) / 1e9
+}
+
+// usd rounds a USD value to cents
+func usd(value float64) *float64 {
+	return float(math.Round(value*100) / 100)
+}
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func formatUSD(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', 2, 64)
+}
+
+func formatFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// fixedPrices prices every token at a fixed USD value per day
+type fixedPrices map[string]float64
+
+func (p fixedPrices) PriceAt(ctx context.Context, mint string, at time.Time) (float64, error) {
+	price, ok := p[mint+"@"+at.Format("2006-01-02")]
+	if !ok {
+		return 0, fmt.Errorf("no price for %s on %s", mint, at.Format("2006-01-02"))
+	}
+	return price, nil
+}
+
+func ledgerFixture() ([]HistoryEntry, []AccountSnapshot, PriceSource) {
+	usdc := "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	sol := NativeSOL.Mint
+	day := func(d int) time.Time {
+		return time.Date(2024, time.March, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	entries := []HistoryEntry{
+		// Newest first, as stored in the history cache
+		{Signature: "sig8", Slot: 800, Time: day(22), Type: HistoryWithdraw, Mint: sol, Amount: "1.6", Fee: 5000},
+		{Signature: "sig7", Slot: 700, Time: day(20), Type: HistoryWithdraw, Mint: sol, Amount: "1.5", Fee: 5000},
+		{Signature: "sig5", Slot: 500, Time: day(15), Type: HistorySettings, Fee: 5000},
+		{Signature: "sig4", Slot: 400, Time: day(10), Type: HistoryWithdraw, Mint: usdc, Amount: "160", Fee: 5000},
+		{Signature: "sig6", Slot: 350, Time: day(7), Type: HistoryDeposit, Mint: sol, Amount: "1", Fee: 5000},
+		{Signature: "sig3", Slot: 300, Time: day(5), Type: HistoryDeposit, Mint: sol, Amount: "2", Fee: 5000},
+		{Signature: "sig2", Slot: 200, Time: day(3), Type: HistoryDeposit, Mint: usdc, Amount: "100", Fee: 5000, Failed: true},
+		{Signature: "sig1", Slot: 150, Time: day(2), Type: HistoryDeposit, Mint: usdc, Amount: "50", Fee: 5000},
+		{Signature: "sig0", Slot: 100, Time: day(1), Type: HistoryDeposit, Mint: usdc, Amount: "100", Fee: 5000},
+	}
+	snapshots := []AccountSnapshot{
+		{Time: day(12), TotalValue: 300.123, InterestEarned: 10.456, RealtimeAPY: 7.5},
+		{Time: day(25), TotalValue: 0, InterestEarned: 12.5, RealtimeAPY: 7.1},
+	}
+	prices := fixedPrices{
+		usdc + "@2024-03-01": 1,
+		usdc + "@2024-03-02": 1,
+		usdc + "@2024-03-10": 1,
+		sol + "@2024-03-05":  150,
+		sol + "@2024-03-07":  120,
+		sol + "@2024-03-20":  180,
+		sol + "@2024-03-22":  200,
+	}
+	return entries, snapshots, prices
+}
+
+func TestLedgerGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		from   time.Time
+		to     time.Time
+		json   bool
+	}{
+		{name: "ledger_fifo.csv", method: CostBasisFIFO},
+		{name: "ledger_average.csv", method: CostBasisAverage},
+		{name: "ledger_fifo.json", method: CostBasisFIFO, json: true},
+		{
+			name:   "ledger_range.csv",
+			method: CostBasisFIFO,
+			from:   time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, time.March, 21, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, snapshots, prices := ledgerFixture()
+			rows, err := BuildLedger(context.Background(), entries, snapshots, prices, tt.method, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("BuildLedger: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if tt.json {
+				err = WriteLedgerJSON(&buf, rows)
+			} else {
+				err = WriteLedgerCSV(&buf, rows)
+			}
+			if err != nil {
+				t.Fatalf("write ledger: %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create): %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("ledger mismatch for %s\ngot:\n%s\nwant:\n%s", tt.name, buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestBuildLedgerUnknownMethod(t *testing.T) {
+	entries, snapshots, prices := ledgerFixture()
+	if _, err := BuildLedger(context.Background(), entries, snapshots, prices, "lifo", time.Time{}, time.Time{}); err == nil {
+		t.Fatal("expected error for unknown cost basis method")
+	}
+}
+
+// unpricedMint has no price source, like a token missing from CoinGecko
+const unpricedMint = "Unpriced1111111111111111111111111111111111"
+
+// partialPrices prices everything but unpricedMint
+type partialPrices struct {
+	PriceSource
+}
+
+func (p partialPrices) PriceAt(ctx context.Context, mint string, at time.Time) (float64, error) {
+	if mint == unpricedMint {
+		return 0, fmt.Errorf("%w: no price source for token %s", ErrPriceUnknown, mint)
+	}
+	return p.PriceSource.PriceAt(ctx, mint, at)
+}
+
+func TestBuildLedgerUnknownPrice(t *testing.T) {
+	entries, snapshots, prices := ledgerFixture()
+	day := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	entries = append(entries,
+		HistoryEntry{Signature: "unpriced-withdraw", Slot: 260, Time: day, Type: HistoryWithdraw, Mint: unpricedMint, Amount: "12", Fee: 5000},
+		HistoryEntry{Signature: "unpriced-deposit", Slot: 250, Time: day, Type: HistoryDeposit, Mint: unpricedMint, Amount: "10", Fee: 5000},
+	)
+
+	rows, err := BuildLedger(context.Background(), entries, snapshots, partialPrices{prices}, CostBasisFIFO, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("BuildLedger: %v", err)
+	}
+
+	bySignature := map[string]LedgerRow{}
+	for _, row := range rows {
+		bySignature[row.Signature] = row
+	}
+	deposit, withdraw := bySignature["unpriced-deposit"], bySignature["unpriced-withdraw"]
+	if deposit.Amount == nil || *deposit.Amount != 10 || deposit.PriceUSD != nil || deposit.ValueUSD != nil || deposit.CostBasisUSD != nil {
+		t.Errorf("unpriced deposit = %+v, want its amount without USD values", deposit)
+	}
+	if withdraw.RealizedYield == nil || *withdraw.RealizedYield != 2 || withdraw.CostBasisUSD != nil || withdraw.RealizedGainUSD != nil {
+		t.Errorf("unpriced withdrawal = %+v, want a realized yield of 2 without USD values", withdraw)
+	}
+	if sol := bySignature["sig3"]; sol.PriceUSD == nil || *sol.PriceUSD != 150 {
+		t.Errorf("priced deposit = %+v, want it priced as usual", sol)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteLedgerCSV(&buf, rows); err != nil {
+		t.Fatalf("WriteLedgerCSV: %v", err)
+	}
+	want := "2024-03-04T12:00:00Z,deposit,Unpr…1111," + unpricedMint + ",10,,,,,,,0.000005,unpriced-deposit\n"
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("CSV does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestBuildLedgerPriceLookupFailure(t *testing.T) {
+	entries, snapshots, _ := ledgerFixture()
+	// A failed lookup is not an unknown price, the export must not guess
+	if _, err := BuildLedger(context.Background(), entries, snapshots, fixedPrices{}, CostBasisFIFO, time.Time{}, time.Time{}); err == nil {
+		t.Fatal("expected error when prices cannot be fetched")
+	}
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogConfig configures where and how logs are written
+type LogConfig struct {
+	Level      string // panic, fatal, error, warn, info, debug or trace
+	Format     string // text or json
+	File       string // log file instead of stderr
+	MaxSize    int64  // bytes before the log file is rotated, 0 for no rotation
+	MaxBackups int    // rotated files kept
+}
+
+// loggerKey is the context key of the command's logger
+type loggerKey struct{}
+
+// SetupLogging configures the standard logger from cfg and returns it as the
+// base entry for a command, carrying the command name, along with a function
+// that closes the log file
+func SetupLogging(cfg LogConfig, command string) (*logrus.Entry, func() error, error) {
+	base := logrus.StandardLogger()
+
+	level := logrus.InfoLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(cfg.Level); err != nil {
+			return nil, nil, fmt.Errorf("invalid log level %q", cfg.Level)
+		}
+	}
+	base.SetLevel(level)
+
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		base.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		base.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return nil, nil, fmt.Errorf("invalid log format %q: use text or json", cfg.Format)
+	}
+
+	base.SetOutput(os.Stderr)
+	closeLog := func() error { return nil }
+	if cfg.File != "" {
+		file, err := OpenRotatingFile(cfg.File, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		base.SetOutput(file)
+		closeLog = func() error {
+			base.SetOutput(os.Stderr)
+			return file.Close()
+		}
+	}
+
+	entry := logrus.NewEntry(base)
+	if command != "" {
+		entry = entry.WithField("command", command)
+	}
+	return entry, closeLog, nil
+}
+
+// WithLogger returns a context carrying the command's logger
+func WithLogger(ctx context.Context, log *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// LoggerFrom returns the logger carried by ctx, or the standard logger when
+// there is none
+func LoggerFrom(ctx context.Context) *logrus.Entry {
+	if log, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok && log != nil {
+		return log
+	}
+	return standardLogger()
+}
+
+// standardLogger is the logger of code given none, e.g. clients built in tests
+func standardLogger() *logrus.Entry {
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// newRequestID returns a short random ID to correlate the logs of a request
+func newRequestID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// RotatingFile is a log file that is rotated when it grows beyond MaxSize:
+// file.log becomes file.log.1, file.log.1 becomes file.log.2 and so on, and
+// files beyond MaxBackups are removed
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens a log file for appending, creating its directory
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{Path: path, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write implements io.Writer, rotating the file first when the write would
+// take it past MaxSize. When rotating fails the entry is still written to
+// the current file and the rotation error returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotateErr error
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		rotateErr = r.rotate()
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, errors.Join(rotateErr, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// Close closes the current file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// rotate closes the file, shifts the backups and opens a new file. On error
+// the file is left closed, and reopened as it is by the next write.
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	if r.MaxBackups <= 0 {
+		if err := os.Remove(r.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove log file: %w", err)
+		}
+		return r.open()
+	}
+
+	oldest := r.backupPath(r.MaxBackups)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old log file: %w", err)
+	}
+	for i := r.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(r.backupPath(i), r.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(r.Path, r.backupPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return r.open()
+}
+
+// backupPath returns the path of the nth rotated file
+func (r *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.Path, n)
+}
+
+var _ io.WriteCloser = (*RotatingFile)(nil)
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readLog returns the content of a log file, or "" when it does not exist
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "golulo.log")
+	file, err := OpenRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first entry\n", "second entry\n", "third entry\n", "fourth entry\n"} {
+		if n, err := file.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("Write(%q) = %d, %v", line, n, err)
+		}
+	}
+	want := map[string]string{
+		path:        "fourth entry\n",
+		path + ".1": "third entry\n",
+		path + ".2": "second entry\n",
+		path + ".3": "",
+	}
+	for p, content := range want {
+		if got := readLog(t, p); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golulo.log")
+	if err := os.WriteFile(path, []byte("earlier run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := OpenRotatingFile(path, 1<<20, 1)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write([]byte("this run\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLog(t, path); got != "earlier run\nthis run\n" {
+		t.Errorf("log = %q, want the existing file appended to", got)
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golulo.log")
+	file, err := OpenRotatingFile(path, 20, 0)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first entry\n", "second entry\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if got := readLog(t, path); got != "second entry\n" {
+		t.Errorf("log = %q, want only the latest entry", got)
+	}
+	if got := readLog(t, path+".1"); got != "" {
+		t.Errorf("backup written without MaxBackups: %q", got)
+	}
+}
+
+func TestRotatingFileRotateFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golulo.log")
+	// The oldest backup cannot be removed, so rotating fails
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := OpenRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write([]byte("first entry\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	n, err := file.Write([]byte("second entry\n"))
+	if err == nil || !strings.Contains(err.Error(), "failed to remove old log file") {
+		t.Errorf("Write error = %v, want the rotation error", err)
+	}
+	if n != len("second entry\n") {
+		t.Errorf("Write = %d bytes, want the entry written anyway", n)
+	}
+	if got := readLog(t, path); got != "first entry\nsecond entry\n" {
+		t.Errorf("log = %q, want both entries kept in the current file", got)
+	}
+}
+
+func TestSetupLoggingInvalid(t *testing.T) {
+	if _, _, err := SetupLogging(LogConfig{Level: "loud"}, "test"); err == nil {
+		t.Error("SetupLogging accepted an unknown level")
+	}
+	if _, _, err := SetupLogging(LogConfig{Format: "xml"}, "test"); err == nil {
+		t.Error("SetupLogging accepted an unknown format")
+	}
+}
+
+func TestLoggerFrom(t *testing.T) {
+	if log := LoggerFrom(context.Background()); log == nil || log.Logger != logrus.StandardLogger() {
+		t.Errorf("LoggerFrom without a logger = %v, want the standard logger", log)
+	}
+	entry := logrus.NewEntry(logrus.New()).WithField("command", "test")
+	if got := LoggerFrom(WithLogger(context.Background(), entry)); got != entry {
+		t.Errorf("LoggerFrom = %v, want the logger the context carries", got)
+	}
+}
@@ -0,0 +1,557 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DefaultLuloAPIURL is the Lulo API used unless lulo-api-url is set
+const DefaultLuloAPIURL = "https://api.flexlend.fi"
+
+// luloRequestTimeout bounds a single Lulo API request
+const luloRequestTimeout = 30 * time.Second
+
+// Lulo API retry settings
+const (
+	defaultLuloRetries    = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	maxRetryDelay         = 10 * time.Second
+	maxRetryAfter         = time.Minute // longer Retry-After waits fail instead
+	maxErrorBody          = 64 << 10
+)
+
+// AccountSettings represents user account settings
+type AccountSettings struct {
+	Owner            string  `json:"owner"`
+	AllowedProtocols string  `json:"allowedProtocols"`
+	Homebase         *string `json:"homebase"`
+	MinimumRate      float64 `json:"minimumRate"` // number
+}
+
+// AccountPosition represents the deposited balance of a single token
+type AccountPosition struct {
+	MintAddress string  `json:"mintAddress"`
+	Pool        string  `json:"pool,omitempty"`
+	Protocol    string  `json:"protocol,omitempty"`
+	Amount      float64 `json:"amount"`
+	Value       float64 `json:"value"`
+}
+
+// PendingWithdrawal represents a withdrawal waiting out its cooldown
+type PendingWithdrawal struct {
+	WithdrawalID string  `json:"withdrawalId"`
+	MintAddress  string  `json:"mintAddress"`
+	Amount       float64 `json:"amount"`
+	UnlockTime   int64   `json:"unlockTime"` // unix seconds
+}
+
+// Account represents the account data returned by the Lulo API. Positions is
+// not part of the documented account response: it is nil when the API does
+// not return it, which HasPositions tells apart from having nothing deposited.
+type Account struct {
+	TotalValue         float64             `json:"totalValue"`
+	InterestEarned     float64             `json:"interestEarned"`
+	RealtimeAPY        float64             `json:"realtimeAPY"`
+	Settings           AccountSettings     `json:"settings"`
+	Positions          []AccountPosition   `json:"positions"`
+	PendingWithdrawals []PendingWithdrawal `json:"pendingWithdrawals,omitempty"`
+}
+
+// AccountResponse represents the response from the account API
+type AccountResponse struct {
+	Data Account `json:"data"`
+}
+
+// PoolRate is the current APY of a Lulo pool for a token
+type PoolRate struct {
+	Pool        string  `json:"pool"`
+	MintAddress string  `json:"mintAddress"`
+	APY         float64 `json:"apy"`
+}
+
+// ProtocolRate is the current lending APY of an integrated protocol for a token
+type ProtocolRate struct {
+	Protocol    string  `json:"protocol"`
+	MintAddress string  `json:"mintAddress"`
+	APY         float64 `json:"apy"`
+}
+
+// Rates holds the current Lulo pool and protocol rates
+type Rates struct {
+	Pools     []PoolRate     `json:"pools"`
+	Protocols []ProtocolRate `json:"protocols"`
+}
+
+// RatesResponse represents the response from the rates API
+type RatesResponse struct {
+	Data Rates `json:"data"`
+}
+
+// DepositRequest represents the request body for the deposit API
+type DepositRequest struct {
+	Owner         string `json:"owner"`
+	MintAddress   string `json:"mintAddress"`
+	DepositAmount string `json:"depositAmount"`
+	Pool          string `json:"pool,omitempty"`
+}
+
+// TransactionMeta represents a single transaction in the response
+type TransactionMeta struct {
+	Transaction  string  `json:"transaction"`
+	Protocol     string  `json:"protocol"`
+	TotalDeposit float64 `json:"totalDeposit"`
+}
+
+// DepositResponse represents the response from the deposit API
+type DepositResponse struct {
+	Data struct {
+		TransactionMeta []TransactionMeta `json:"transactionMeta"`
+	} `json:"data"`
+}
+
+// WithdrawAllAmount is the withdrawAmount sent along with withdrawAll
+const WithdrawAllAmount = "0"
+
+// WithdrawRequest represents the request body for the withdraw API
+type WithdrawRequest struct {
+	Owner          string `json:"owner"`
+	MintAddress    string `json:"mintAddress"`
+	WithdrawAmount string `json:"withdrawAmount"`
+	WithdrawAll    bool   `json:"withdrawAll"`
+	Pool           string `json:"pool,omitempty"`
+}
+
+// WithdrawTransactionMeta represents a single transaction in the response
+type WithdrawTransactionMeta struct {
+	Transaction   string `json:"transaction"`
+	Protocol      string `json:"protocol"`
+	TotalWithdraw string `json:"totalWithdraw"`
+}
+
+// WithdrawResponse represents the response from the withdraw API
+type WithdrawResponse struct {
+	Data struct {
+		TransactionMeta []WithdrawTransactionMeta `json:"transactionMeta"`
+	} `json:"data"`
+}
+
+// LuloClient talks to the Lulo API
+type LuloClient struct {
+	BaseURL     string
+	APIVersion  string // legacy, v1, or auto to detect on first use
+	APIKey      string
+	PriorityFee string
+	HTTPClient  *http.Client
+	Log         *logrus.Entry
+
+	// AllowedProtocols restricts deposits to these protocols, empty for any
+	AllowedProtocols []string
+
+	MaxRetries     int           // retries of failed requests that are safe to repeat
+	RetryBaseDelay time.Duration // backoff before the first retry, doubled after each
+
+	versionMu sync.Mutex
+}
+
+// NewLuloClient creates a new Lulo API client from config values, logging to log
+func NewLuloClient(log *logrus.Entry) (*LuloClient, error) {
+	apiKey, err := ConfigSecret("lulo-api-key")
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("FLEXLEND_API_KEY environment variable not set")
+	}
+
+	baseURL := viper.GetString("lulo-api-url")
+	if baseURL == "" {
+		baseURL = DefaultLuloAPIURL
+	}
+	RegisterURLSecrets(baseURL)
+	version, err := ParseLuloAPIVersion(viper.GetString("lulo-api-version"))
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries := defaultLuloRetries
+	if viper.IsSet("lulo-max-retries") {
+		maxRetries = viper.GetInt("lulo-max-retries")
+	}
+
+	return &LuloClient{
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		APIVersion:  version,
+		APIKey:      apiKey,
+		PriorityFee: viper.GetString("priority-fee"),
+		HTTPClient:  &http.Client{Timeout: luloRequestTimeout},
+		Log:         log,
+
+		AllowedProtocols: viper.GetStringSlice("allowed-protocols"),
+
+		MaxRetries:     maxRetries,
+		RetryBaseDelay: defaultRetryBaseDelay,
+	}, nil
+}
+
+// log returns the client's logger
+func (c *LuloClient) log() *logrus.Entry {
+	if c.Log == nil {
+		return standardLogger()
+	}
+	return c.Log
+}
+
+// GetAccount fetches the Lulo account of the given wallet
+func (c *LuloClient) GetAccount(ctx context.Context, owner solana.PublicKey) (*Account, error) {
+	routes, err := c.routes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response AccountResponse
+	if err := c.get(ctx, routes.Account, owner, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// GetRates fetches the current pool and protocol rates
+func (c *LuloClient) GetRates(ctx context.Context) (*Rates, error) {
+	routes, err := c.routes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response RatesResponse
+	if err := c.get(ctx, routes.Rates, solana.PublicKey{}, &response); err != nil {
+		return nil, err
+	}
+	return &response.Data, nil
+}
+
+// GenerateDeposit asks the API for the transactions that deposit into Lulo,
+// returned base64 encoded and in the order they must be sent
+func (c *LuloClient) GenerateDeposit(ctx context.Context, request DepositRequest) ([]string, error) {
+	c.log().WithFields(logrus.Fields{
+		"owner":         request.Owner,
+		"mintAddress":   request.MintAddress,
+		"depositAmount": request.DepositAmount,
+		"pool":          request.Pool,
+	}).Info("Creating deposit request")
+
+	routes, err := c.routes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response DepositResponse
+	if err := c.post(ctx, routes.Deposit, request.Owner, request, &response); err != nil {
+		return nil, err
+	}
+
+	c.log().WithField("transactionCount", len(response.Data.TransactionMeta)).
+		Info("Received transactions from API")
+
+	b64_txs := make([]string, len(response.Data.TransactionMeta))
+	for i, meta := range response.Data.TransactionMeta {
+		if !c.protocolAllowed(meta.Protocol) {
+			return nil, fmt.Errorf("deposit would go to protocol %q, which is not in allowed-protocols %v", meta.Protocol, c.AllowedProtocols)
+		}
+		b64_txs[i] = meta.Transaction
+	}
+	return b64_txs, nil
+}
+
+// protocolAllowed reports whether deposits may go to protocol
+func (c *LuloClient) protocolAllowed(protocol string) bool {
+	if len(c.AllowedProtocols) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedProtocols {
+		if strings.EqualFold(allowed, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateWithdraw asks the API for the transactions that withdraw from Lulo,
+// returned base64 encoded and in the order they must be sent
+func (c *LuloClient) GenerateWithdraw(ctx context.Context, request WithdrawRequest) ([]string, error) {
+	c.log().WithFields(logrus.Fields{
+		"owner":          request.Owner,
+		"mintAddress":    request.MintAddress,
+		"withdrawAmount": request.WithdrawAmount,
+		"withdrawAll":    request.WithdrawAll,
+		"pool":           request.Pool,
+	}).Info("Creating withdraw request")
+
+	routes, err := c.routes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var response WithdrawResponse
+	if err := c.post(ctx, routes.Withdraw, request.Owner, request, &response); err != nil {
+		return nil, err
+	}
+
+	c.log().WithField("transactionCount", len(response.Data.TransactionMeta)).
+		Info("Received transactions from API")
+
+	b64_txs := make([]string, len(response.Data.TransactionMeta))
+	for i, meta := range response.Data.TransactionMeta {
+		b64_txs[i] = meta.Transaction
+	}
+	return b64_txs, nil
+}
+
+// post sends a JSON body to a transaction generation endpoint, adding the
+// configured priority fee, and decodes the JSON response into out. Only rate
+// limited requests are retried: the API refused them before doing any work.
+func (c *LuloClient) post(ctx context.Context, path string, owner string, body interface{}, out interface{}) error {
+	// Convert request to JSON
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request with priority fee
+	url := fmt.Sprintf("%s%s?priorityFee=%s", c.BaseURL, path, c.PriorityFee)
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-wallet-pubkey", owner)
+		return req, nil
+	}
+	return c.do(ctx, newRequest, func(status int) bool {
+		return status == http.StatusTooManyRequests
+	}, out)
+}
+
+// get performs a GET request against the Lulo API and decodes the JSON response
+// into out. The wallet header is only sent when owner is set. Reads are
+// retried on rate limits, server errors and network failures.
+func (c *LuloClient) get(ctx context.Context, path string, owner solana.PublicKey, out interface{}) error {
+	url := c.BaseURL + path
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !owner.IsZero() {
+			req.Header.Set("x-wallet-pubkey", owner.String())
+		}
+		return req, nil
+	}
+	return c.do(ctx, newRequest, func(status int) bool {
+		return status == 0 || status == http.StatusTooManyRequests || status >= 500
+	}, out)
+}
+
+// do sends a request built by newRequest, retrying with exponential backoff
+// while retryable reports true for the response status (0 for network
+// errors), and decodes the JSON response into out
+func (c *LuloClient) do(ctx context.Context, newRequest func() (*http.Request, error), retryable func(status int) bool, out interface{}) error {
+	requestID := newRequestID()
+	log := c.log().WithField("requestId", requestID)
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Request-Id", requestID)
+		req.Header.Set("x-api-key", c.APIKey)
+		log.WithFields(logrus.Fields{"url": req.URL.String(), "attempt": attempt + 1}).Debug("Making API request")
+
+		status, retryAfter, err := c.roundTrip(req, out)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || attempt >= c.MaxRetries || !retryable(status) {
+			// Callers report the error, only trace it here
+			log.WithError(err).Debug("API request failed")
+			return err
+		}
+
+		delay := retryDelay(attempt, c.RetryBaseDelay)
+		if retryAfter > 0 {
+			if retryAfter > maxRetryAfter {
+				log.WithError(err).WithField("retryAfter", retryAfter).Error("API asked to wait too long, giving up")
+				return fmt.Errorf("%w (retry after %s)", err, retryAfter)
+			}
+			delay = retryAfter
+		}
+		log.WithError(err).WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+		}).Warn("API request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry cancelled: %v)", err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// roundTrip sends one request and decodes a successful response into out. It
+// returns the response status (0 when none was received) and the delay the
+// API asked for in Retry-After.
+func (c *LuloClient) roundTrip(req *http.Request, out interface{}) (int, time.Duration, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")), newAPIError(resp.StatusCode, body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return resp.StatusCode, 0, nil
+}
+
+// APIError is a non-200 response from the Lulo API
+type APIError struct {
+	StatusCode int
+	Message    string // the API's error message, or the start of the body
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("Lulo API returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if hint := e.Hint(); hint != "" {
+		msg += " (" + hint + ")"
+	}
+	return msg
+}
+
+// Unauthorized reports whether the API rejected the API key
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// Hint suggests how to fix errors the user can act on
+func (e *APIError) Hint() string {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return "check lulo-api-key: the API did not accept the key sent as x-api-key"
+	case e.StatusCode == http.StatusForbidden:
+		return "the API key is valid but not allowed to do this, check its permissions with Lulo"
+	case e.StatusCode == http.StatusTooManyRequests:
+		return "rate limited, wait a moment or lower request concurrency"
+	}
+	return ""
+}
+
+// newAPIError builds an APIError from a response body, using the message of
+// a JSON error body when there is one
+func newAPIError(status int, body []byte) *APIError {
+	var parsed struct {
+		Error   interface{} `json:"error"`
+		Message string      `json:"message"`
+		Detail  string      `json:"detail"`
+	}
+	message := ""
+	if json.Unmarshal(body, &parsed) == nil {
+		switch {
+		case parsed.Message != "":
+			message = parsed.Message
+		case parsed.Detail != "":
+			message = parsed.Detail
+		default:
+			switch e := parsed.Error.(type) {
+			case string:
+				message = e
+			case map[string]interface{}:
+				if m, ok := e["message"].(string); ok {
+					message = m
+				}
+			}
+		}
+	}
+	if message == "" {
+		message = strings.Join(strings.Fields(string(body)), " ")
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+	}
+	return &APIError{StatusCode: status, Message: RedactSecrets(message)}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryDelay returns the backoff before retry number attempt+1: base doubled
+// per attempt up to maxRetryDelay, with jitter so clients spread out
+func retryDelay(attempt int, base time.Duration) time.Duration {
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	delay := base << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// HasPositions reports whether the API returned per-token positions
+func (a *Account) HasPositions() bool {
+	return a.Positions != nil
+}
+
+// ProtocolValue returns the total value allocated to a protocol
+func (a *Account) ProtocolValue(protocol string) float64 {
+	total := 0.0
+	for _, position := range a.Positions {
+		if strings.EqualFold(position.Protocol, protocol) {
+			total += position.Value
+		}
+	}
+	return total
+}
+
+// DepositedAmount returns the total amount of a mint deposited across all protocols
+func (a *Account) DepositedAmount(mint string) float64 {
+	total := 0.0
+	for _, position := range a.Positions {
+		if position.MintAddress == mint {
+			total += position.Amount
+		}
+	}
+	return total
+}
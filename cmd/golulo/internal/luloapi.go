@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Lulo API versions
+const (
+	LuloAPIAuto   = "auto"   // detect from the API on first use
+	LuloAPILegacy = "legacy" // flexlend paths such as /generate/account/deposit, the default
+	LuloAPIV1     = "v1"     // versioned routes such as /v1/generate.transactions.deposit
+)
+
+// luloRoutes are the paths of the endpoints the CLI uses in one API version
+type luloRoutes struct {
+	Account  string
+	Rates    string
+	Deposit  string
+	Withdraw string
+}
+
+var luloAPIRoutes = map[string]luloRoutes{
+	LuloAPILegacy: {
+		Account:  "/account",
+		Rates:    "/rates",
+		Deposit:  "/generate/account/deposit",
+		Withdraw: "/generate/account/withdraw",
+	},
+	LuloAPIV1: {
+		Account:  "/v1/account.getAccount",
+		Rates:    "/v1/rates.getRates",
+		Deposit:  "/v1/generate.transactions.deposit",
+		Withdraw: "/v1/generate.transactions.withdraw",
+	},
+}
+
+// ParseLuloAPIVersion validates a configured API version, defaulting to legacy
+func ParseLuloAPIVersion(version string) (string, error) {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version == "" {
+		return LuloAPILegacy, nil
+	}
+	if _, ok := luloAPIRoutes[version]; ok || version == LuloAPIAuto {
+		return version, nil
+	}
+	return "", fmt.Errorf("unknown lulo-api-version %q: use %s, %s or %s", version, LuloAPIAuto, LuloAPILegacy, LuloAPIV1)
+}
+
+// Version returns the API version the client talks to, detecting it on first
+// use when the version is auto
+func (c *LuloClient) Version(ctx context.Context) (string, error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	if c.APIVersion != "" && c.APIVersion != LuloAPIAuto {
+		return c.APIVersion, nil
+	}
+	version, err := c.detectVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.APIVersion = version
+	return version, nil
+}
+
+// routes returns the endpoint paths of the client's API version
+func (c *LuloClient) routes(ctx context.Context) (luloRoutes, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return luloRoutes{}, err
+	}
+	return luloAPIRoutes[version], nil
+}
+
+// detectVersion asks the API for its versioned rates endpoint. Only a
+// successful response shows the API is v1; any other answer means legacy,
+// whose own requests report errors such as a bad API key. Failures to reach
+// the API are returned so detection runs again on the next request.
+func (c *LuloClient) detectVersion(ctx context.Context) (string, error) {
+	var response RatesResponse
+	err := c.get(ctx, luloAPIRoutes[LuloAPIV1].Rates, solana.PublicKey{}, &response)
+
+	var apiErr *APIError
+	version := LuloAPIV1
+	switch {
+	case err == nil:
+	case errors.As(err, &apiErr) && apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode < 500:
+		version = LuloAPILegacy
+	default:
+		return "", fmt.Errorf("failed to detect Lulo API version: %w", err)
+	}
+
+	c.log().WithFields(logrus.Fields{
+		"url":     c.BaseURL,
+		"version": version,
+	}).Debug("Detected Lulo API version")
+	return version, nil
+}
@@ -0,0 +1,271 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric kinds
+const (
+	MetricGauge     = "gauge"
+	MetricCounter   = "counter"
+	MetricHistogram = "histogram"
+)
+
+// DefaultLatencyBuckets are the histogram buckets for request latency in seconds
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Labels are the label names and values of a metric series
+type Labels map[string]string
+
+// MetricsRegistry holds metrics and renders them in the Prometheus text
+// exposition format. Metrics must be registered before use.
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels Labels
+	value  float64  // gauge and counter value, histogram sum
+	counts []uint64 // histogram bucket counts, not cumulative
+	count  uint64
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: map[string]*metricFamily{}}
+}
+
+// Register declares a metric. Histograms take their bucket upper bounds.
+func (r *MetricsRegistry) Register(name, kind, help string, buckets ...float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[name] = &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		buckets: buckets,
+		series:  map[string]*metricSeries{},
+	}
+}
+
+// Set sets a gauge
+func (r *MetricsRegistry) Set(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, labels).value = value
+}
+
+// Add increments a counter
+func (r *MetricsRegistry) Add(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, labels).value += value
+}
+
+// Observe records a histogram sample
+func (r *MetricsRegistry) Observe(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	family := r.families[name]
+	s := r.series(name, labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(family.buckets))
+	}
+	for i, bound := range family.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// DeleteMatching removes the series of a metric whose labels include all of match,
+// so positions that disappear stop being reported
+func (r *MetricsRegistry) DeleteMatching(name string, match Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	family, ok := r.families[name]
+	if !ok {
+		return
+	}
+	for key, s := range family.series {
+		matches := true
+		for k, v := range match {
+			if s.labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			delete(family.series, key)
+		}
+	}
+}
+
+// series returns the series of a metric for labels, creating it if needed.
+// The caller must hold the lock.
+func (r *MetricsRegistry) series(name string, labels Labels) *metricSeries {
+	family, ok := r.families[name]
+	if !ok {
+		panic(fmt.Sprintf("metric %s is not registered", name))
+	}
+	key := formatLabels(labels, "", "")
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labels: labels}
+		family.series[key] = s
+	}
+	return s
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		family := r.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, escapeHelp(family.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := family.series[key]
+			if family.kind != MetricHistogram {
+				fmt.Fprintf(&b, "%s%s %s\n", name, key, formatMetricValue(s.value))
+				continue
+			}
+
+			var cumulative uint64
+			for i, bound := range family.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatMetricValue(bound)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatMetricValue(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, s.count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// formatLabels renders labels sorted by name, with an optional extra label appended
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		parts = append(parts, name+`="`+escapeLabel(labels[name])+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+escapeLabel(extraValue)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelEscaper escapes label values as the text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// InstrumentedTransport records request counts and latency of outgoing HTTP requests
+type InstrumentedTransport struct {
+	Target   string // e.g. lulo or rpc
+	Base     http.RoundTripper
+	Registry *MetricsRegistry
+}
+
+// Request metric names recorded by InstrumentedTransport
+const (
+	MetricRequestsTotal   = "golulo_requests_total"
+	MetricRequestDuration = "golulo_request_duration_seconds"
+)
+
+// RegisterRequestMetrics declares the metrics recorded by InstrumentedTransport
+func (r *MetricsRegistry) RegisterRequestMetrics() {
+	r.Register(MetricRequestsTotal, MetricCounter, "Outgoing HTTP requests by target and status code (error for transport failures)")
+	r.Register(MetricRequestDuration, MetricHistogram, "Latency of outgoing HTTP requests in seconds", DefaultLatencyBuckets...)
+}
+
+// RoundTrip performs the request and records its outcome
+func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	t.Registry.Observe(MetricRequestDuration, Labels{"target": t.Target}, time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	t.Registry.Add(MetricRequestsTotal, Labels{"target": t.Target, "code": code}, 1)
+	return resp, err
+}
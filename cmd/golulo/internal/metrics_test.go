@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sampleLine is a sample in the text exposition format: name, optional labels, value
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*",?)*\})? (\S+)$`)
+
+// parseExposition checks the structure of metrics text and returns the sample
+// values by series, e.g. `name{label="value"}`
+func parseExposition(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	samples := map[string]float64{}
+	types := map[string]string{}
+	var family string
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 4 {
+				t.Fatalf("line %d: malformed HELP %q", i+1, line)
+			}
+			family = fields[2]
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(line)
+			if len(fields) != 4 || fields[2] != family {
+				t.Fatalf("line %d: TYPE %q does not follow the HELP of its family", i+1, line)
+			}
+			switch fields[3] {
+			case MetricGauge, MetricCounter, MetricHistogram:
+			default:
+				t.Fatalf("line %d: unknown type %q", i+1, fields[3])
+			}
+			types[family] = fields[3]
+		default:
+			m := sampleLine.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("line %d: malformed sample %q", i+1, line)
+			}
+			name := m[1]
+			if types[family] == MetricHistogram {
+				name = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+			}
+			if name != family || types[family] == "" {
+				t.Fatalf("line %d: sample %q outside its family %s", i+1, line, family)
+			}
+			value, err := strconv.ParseFloat(m[3], 64)
+			if err != nil {
+				t.Fatalf("line %d: value %q: %v", i+1, m[3], err)
+			}
+			series := m[1] + m[2]
+			if _, dup := samples[series]; dup {
+				t.Fatalf("line %d: duplicate series %s", i+1, series)
+			}
+			samples[series] = value
+		}
+	}
+	return samples
+}
+
+func TestMetricsWriteText(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.Register("golulo_value", MetricGauge, "Value with a \\ and\na newline")
+	r.Register("golulo_events_total", MetricCounter, "Events")
+	r.Register("golulo_empty", MetricGauge, "Never set")
+
+	r.Set("golulo_value", Labels{"token": "USDC", "pool": "protected"}, 12.5)
+	r.Set("golulo_value", Labels{"token": `we"ird\name` + "\n"}, 1)
+	r.Set("golulo_value", nil, 3)
+	r.Add("golulo_events_total", Labels{"kind": "a"}, 1)
+	r.Add("golulo_events_total", Labels{"kind": "a"}, 2)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP golulo_empty Never set
+# TYPE golulo_empty gauge
+# HELP golulo_events_total Events
+# TYPE golulo_events_total counter
+golulo_events_total{kind="a"} 3
+# HELP golulo_value Value with a \\ and\na newline
+# TYPE golulo_value gauge
+golulo_value 3
+golulo_value{pool="protected",token="USDC"} 12.5
+golulo_value{token="we\"ird\\name\n"} 1
+`
+	if b.String() != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", b.String(), want)
+	}
+	parseExposition(t, b.String())
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.Register("golulo_latency_seconds", MetricHistogram, "Latency", 0.1, 1, 10)
+	for _, v := range []float64{0.05, 0.1, 0.5, 3, 30} {
+		r.Observe("golulo_latency_seconds", Labels{"target": "rpc"}, v)
+	}
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	samples := parseExposition(t, b.String())
+	want := map[string]float64{
+		`golulo_latency_seconds_bucket{target="rpc",le="0.1"}`:  2, // le is inclusive
+		`golulo_latency_seconds_bucket{target="rpc",le="1"}`:    3,
+		`golulo_latency_seconds_bucket{target="rpc",le="10"}`:   4,
+		`golulo_latency_seconds_bucket{target="rpc",le="+Inf"}`: 5,
+		`golulo_latency_seconds_sum{target="rpc"}`:              33.65,
+		`golulo_latency_seconds_count{target="rpc"}`:            5,
+	}
+	if len(samples) != len(want) {
+		t.Errorf("samples = %v, want %v", samples, want)
+	}
+	for series, value := range want {
+		if got, ok := samples[series]; !ok || got != value {
+			t.Errorf("%s = %v (present %v), want %v", series, got, ok, value)
+		}
+	}
+}
+
+func TestMetricsDeleteMatching(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.Register("golulo_position", MetricGauge, "Position")
+	r.Set("golulo_position", Labels{"wallet": "a", "token": "USDC"}, 1)
+	r.Set("golulo_position", Labels{"wallet": "a", "token": "SOL"}, 2)
+	r.Set("golulo_position", Labels{"wallet": "b", "token": "USDC"}, 3)
+	r.DeleteMatching("golulo_position", Labels{"wallet": "a"})
+	r.DeleteMatching("golulo_unknown", Labels{"wallet": "a"})
+
+	var b strings.Builder
+	r.WriteText(&b)
+	samples := parseExposition(t, b.String())
+	if len(samples) != 1 || samples[`golulo_position{token="USDC",wallet="b"}`] != 3 {
+		t.Errorf("samples after delete = %v", samples)
+	}
+}
+
+func TestMetricsUnregisteredPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("setting an unregistered metric did not panic")
+		}
+	}()
+	NewMetricsRegistry().Set("golulo_missing", nil, 1)
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	r := NewMetricsRegistry()
+	r.RegisterRequestMetrics()
+	client := &http.Client{Transport: &InstrumentedTransport{Target: "lulo", Registry: r}}
+
+	for _, path := range []string{"/ok", "/ok", "/fail"} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	// A closed port fails in the transport
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := client.Get(closed.URL); err == nil {
+		t.Fatal("request to a closed server succeeded")
+	}
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	samples := parseExposition(t, recorder.Body.String())
+	want := map[string]float64{
+		`golulo_requests_total{code="200",target="lulo"}`:                 2,
+		`golulo_requests_total{code="500",target="lulo"}`:                 1,
+		`golulo_requests_total{code="error",target="lulo"}`:               1,
+		`golulo_request_duration_seconds_count{target="lulo"}`:            4,
+		`golulo_request_duration_seconds_bucket{target="lulo",le="+Inf"}`: 4,
+	}
+	for series, value := range want {
+		if got := samples[series]; got != value {
+			t.Errorf("%s = %v, want %v", series, got, value)
+		}
+	}
+}
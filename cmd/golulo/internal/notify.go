@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotifierConfig configures a single alert notification sink
+type NotifierConfig struct {
+	Type string `mapstructure:"type"` // webhook, command or smtp
+
+	// webhook
+	URL string `mapstructure:"url"`
+
+	// command
+	Command string `mapstructure:"command"`
+
+	// smtp
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// notifyTimeout bounds a single notification, so a hung sink cannot stall
+// the alert loop
+const notifyTimeout = 30 * time.Second
+
+// Notifier delivers alerts somewhere. Notify gives up when ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// NotifyAll sends an alert to every notifier. It succeeds when at least one
+// of them delivered the alert, and otherwise returns all their errors.
+// Failures are logged to the logger carried by ctx.
+func NotifyAll(ctx context.Context, notifiers []Notifier, alert Alert) error {
+	var errs []error
+	for i, notifier := range notifiers {
+		if err := notifier.Notify(ctx, alert); err != nil {
+			LoggerFrom(ctx).WithError(err).WithField("notifier", i).Error("Failed to send notification")
+			errs = append(errs, err)
+		}
+	}
+	if len(notifiers) > 0 && len(errs) == len(notifiers) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// NewNotifier creates a notifier from its config
+func NewNotifier(cfg NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook notifier requires a url")
+		}
+		return &WebhookNotifier{URL: cfg.URL, HTTPClient: &http.Client{Timeout: 15 * time.Second}}, nil
+	case "command":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("command notifier requires a command")
+		}
+		return &CommandNotifier{Command: cfg.Command}, nil
+	case "smtp":
+		if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("smtp notifier requires host, from and to")
+		}
+		port := cfg.Port
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPNotifier{
+			Addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+			Host:     cfg.Host,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			From:     cfg.From,
+			To:       cfg.To,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+// WebhookNotifier posts alerts as JSON. The body carries the message as both
+// `text` (Slack) and `content` (Discord) so either accepts it unchanged.
+type WebhookNotifier struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+// Notify posts the alert to the webhook
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"text":    alert.Message,
+		"content": alert.Message,
+		"alert":   alert,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CommandNotifier runs a shell command per alert. The message is passed on
+// stdin and the alert fields as GOLULO_ALERT_* environment variables. The
+// command is killed when it runs longer than notifyTimeout.
+type CommandNotifier struct {
+	Command string
+}
+
+// Notify runs the command for the alert
+func (n *CommandNotifier) Notify(ctx context.Context, alert Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.Command)
+	// Don't wait on children of the killed shell that still hold its output
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = strings.NewReader(alert.Message + "\n")
+	cmd.Env = append(os.Environ(),
+		"GOLULO_ALERT_RULE="+alert.Rule,
+		"GOLULO_ALERT_MESSAGE="+alert.Message,
+		"GOLULO_ALERT_VALUE="+strconv.FormatFloat(alert.Value, 'f', -1, 64),
+		"GOLULO_ALERT_RESOLVED="+strconv.FormatBool(alert.Resolved),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("alert command did not finish: %w", ctx.Err())
+		}
+		return fmt.Errorf("alert command failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SMTPNotifier emails alerts
+type SMTPNotifier struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify sends the alert as a plain text email
+func (n *SMTPNotifier) Notify(ctx context.Context, alert Alert) error {
+
+	subject := "golulo alert: " + alert.Rule
+	if alert.Resolved {
+		subject = "golulo resolved: " + alert.Rule
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		n.From, strings.Join(n.To, ", "), subject, alert.Time.Format(time.RFC1123Z), alert.Message)
+
+	if err := n.send(ctx, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send alert email: %w", err)
+	}
+	return nil
+}
+
+// send delivers a message as smtp.SendMail does, over a connection that is
+// closed when ctx is done or notifyTimeout passes
+func (n *SMTPNotifier) send(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer c.Close()
+	if err := n.deliver(c, msg); err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// deliver runs the SMTP session of send
+func (n *SMTPNotifier) deliver(c *smtp.Client, msg []byte) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return err
+		}
+	}
+	if n.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.From); err != nil {
+		return err
+	}
+	for _, to := range n.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// contextError reports why ctx ended in place of the error it caused, such as
+// reading from a connection closed on cancellation
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
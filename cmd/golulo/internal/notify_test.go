@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlert = Alert{Rule: "low-apy", Message: "low-apy: realtime-apy is 4", Value: 4, Time: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier(NotifierConfig{Type: "webhook", URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewNotifier: %v", err)
+	}
+	if err := notifier.Notify(context.Background(), testAlert); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if body["text"] != testAlert.Message || body["content"] != testAlert.Message {
+		t.Errorf("body = %v, want the message as text and content", body)
+	}
+	if alert, _ := body["alert"].(map[string]interface{}); alert["rule"] != "low-apy" {
+		t.Errorf("body alert = %v", body["alert"])
+	}
+
+	status = http.StatusInternalServerError
+	if err := notifier.Notify(context.Background(), testAlert); err == nil {
+		t.Error("Notify succeeded on a 500 response")
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "alert.txt")
+	notifier := &CommandNotifier{Command: `{ cat; echo "$GOLULO_ALERT_RULE $GOLULO_ALERT_VALUE $GOLULO_ALERT_RESOLVED"; } > ` + out}
+	if err := notifier.Notify(context.Background(), testAlert); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testAlert.Message + "\nlow-apy 4 false\n"; string(got) != want {
+		t.Errorf("command saw %q, want %q", got, want)
+	}
+
+	if err := (&CommandNotifier{Command: "echo broken >&2; exit 3"}).Notify(context.Background(), testAlert); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Notify error = %v, want the command's output", err)
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	// A webhook and an SMTP server that accept but never answer
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-hang }))
+	defer server.Close()
+	defer close(hang)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	notifiers := map[string]Notifier{
+		"command": &CommandNotifier{Command: "sleep 30"},
+		"webhook": &WebhookNotifier{URL: server.URL, HTTPClient: &http.Client{}},
+		"smtp":    &SMTPNotifier{Addr: listener.Addr().String(), Host: "127.0.0.1", From: "golulo@example.com", To: []string{"ops@example.com"}},
+	}
+	for name, notifier := range notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		err := notifier.Notify(ctx, testAlert)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: Notify error = %v, want the deadline", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: Notify returned after %s", name, elapsed)
+		}
+	}
+}
+
+// smtpMessage is what the fake SMTP server received
+type smtpMessage struct {
+	auth       string
+	from       string
+	recipients []string
+	data       string
+}
+
+// fakeSMTPServer accepts a single SMTP session with PLAIN auth and reports it
+func fakeSMTPServer(t *testing.T) (string, <-chan smtpMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan smtpMessage, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		var msg smtpMessage
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO", "HELO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				fields := strings.Fields(line)
+				decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+				msg.auth = string(decoded)
+				reply("235 2.7.0 Authentication successful")
+			case "MAIL":
+				msg.from = line
+				reply("250 OK")
+			case "RCPT":
+				msg.recipients = append(msg.recipients, line)
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				msg.data = data.String()
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				received <- msg
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	notifier := &SMTPNotifier{
+		Addr:     addr,
+		Host:     "127.0.0.1", // plain auth is only allowed unencrypted to localhost
+		Username: "alerts",
+		Password: "secret",
+		From:     "golulo@example.com",
+		To:       []string{"ops@example.com", "finance@example.com"},
+	}
+	resolved := testAlert
+	resolved.Resolved = true
+	if err := notifier.Notify(context.Background(), resolved); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.auth != "\x00alerts\x00secret" {
+			t.Errorf("auth = %q", msg.auth)
+		}
+		if !strings.Contains(msg.from, "<golulo@example.com>") || len(msg.recipients) != 2 {
+			t.Errorf("envelope from %q to %v", msg.from, msg.recipients)
+		}
+		for _, want := range []string{"Subject: golulo resolved: low-apy\r\n", "To: ops@example.com, finance@example.com\r\n", "\r\n\r\n" + testAlert.Message} {
+			if !strings.Contains(msg.data, want) {
+				t.Errorf("message does not contain %q:\n%s", want, msg.data)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP server received no message")
+	}
+}
+
+// stubNotifier records alerts and fails with err
+type stubNotifier struct {
+	err  error
+	sent []Alert
+}
+
+func (n *stubNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.sent = append(n.sent, alert)
+	return n.err
+}
+
+func TestNotifyAll(t *testing.T) {
+	failing, working := &stubNotifier{err: errors.New("unreachable")}, &stubNotifier{}
+	if err := NotifyAll(context.Background(), []Notifier{failing, working}, testAlert); err != nil {
+		t.Errorf("NotifyAll with one working notifier: %v", err)
+	}
+	if len(failing.sent) != 1 || len(working.sent) != 1 {
+		t.Errorf("sent %d and %d alerts, want every notifier tried", len(failing.sent), len(working.sent))
+	}
+
+	other := &stubNotifier{err: errors.New("rejected")}
+	err := NotifyAll(context.Background(), []Notifier{failing, other}, testAlert)
+	if err == nil || !strings.Contains(err.Error(), "unreachable") || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("NotifyAll with no working notifier = %v, want both errors", err)
+	}
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Deposit generates and sends the deposit transactions for amount (in whole
+// token units) of mint. Native SOL is wrapped into the wSOL account first, in
+// its own transaction; if no deposit transaction is sent afterwards, what was
+// wrapped is unwrapped again.
+func Deposit(ctx context.Context, client *SolanaClient, luloClient *LuloClient, mint, amount, pool string) ([]solana.Signature, error) {
+	// Native SOL is deposited from the wSOL account, so wrap what is missing first
+	var wrapped uint64
+	if mint == NativeSOL.Mint {
+		lamports, err := ToBaseUnits(amount, NativeSOL.Decimals)
+		if err != nil {
+			return nil, err
+		}
+		if wrapped, err = client.EnsureWrappedSOL(ctx, lamports); err != nil {
+			return nil, fmt.Errorf("failed to wrap SOL: %w", err)
+		}
+	}
+
+	sigs, err := deposit(ctx, client, luloClient, mint, amount, pool)
+	if err != nil && len(sigs) == 0 && wrapped > 0 {
+		if _, unwrapErr := client.UnwrapSOL(context.WithoutCancel(ctx), wrapped); unwrapErr != nil {
+			return nil, fmt.Errorf("%w (%s SOL left wrapped: %v)", err, FormatAmount(wrapped, NativeSOL.Decimals), unwrapErr)
+		}
+	}
+	return sigs, err
+}
+
+func deposit(ctx context.Context, client *SolanaClient, luloClient *LuloClient, mint, amount, pool string) ([]solana.Signature, error) {
+	b64_txs, err := luloClient.GenerateDeposit(ctx, DepositRequest{
+		Owner:         client.WalletPubKey().String(),
+		MintAddress:   mint,
+		DepositAmount: amount,
+		Pool:          pool,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sigs, err := client.HandleB64Transactions(ctx, b64_txs)
+	if err != nil {
+		return sigs, fmt.Errorf("failed to handle transactions: %w", err)
+	}
+	return sigs, nil
+}
+
+// Withdraw generates and sends the withdraw transactions for amount (in whole
+// token units) of mint, or everything when all is set. Withdrawn native SOL is
+// unwrapped once the withdrawal confirms; wSOL the wallet held before is left wrapped.
+func Withdraw(ctx context.Context, client *SolanaClient, luloClient *LuloClient, mint, amount string, all bool, pool string) ([]solana.Signature, error) {
+	var wrappedBefore uint64
+	if mint == NativeSOL.Mint {
+		var err error
+		if wrappedBefore, _, err = client.GetWrappedSOLBalance(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if all {
+		amount = WithdrawAllAmount
+	}
+
+	b64_txs, err := luloClient.GenerateWithdraw(ctx, WithdrawRequest{
+		Owner:          client.WalletPubKey().String(),
+		MintAddress:    mint,
+		WithdrawAmount: amount,
+		WithdrawAll:    all,
+		Pool:           pool,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sigs, err := client.HandleB64Transactions(ctx, b64_txs)
+	if err != nil {
+		return sigs, fmt.Errorf("failed to handle transactions: %w", err)
+	}
+
+	// Withdrawn SOL arrives as wSOL, unwrap it once the withdrawal lands
+	if mint == NativeSOL.Mint {
+		if err := client.unwrapAfter(ctx, sigs, wrappedBefore); err != nil {
+			return sigs, err
+		}
+	}
+	return sigs, nil
+}
+
+// unwrapAfter waits for the withdrawal transactions and unwraps what they
+// added to the wSOL account on top of wrappedBefore
+func (c *SolanaClient) unwrapAfter(ctx context.Context, sigs []solana.Signature, wrappedBefore uint64) error {
+	for _, sig := range sigs {
+		if err := c.ConfirmTransaction(ctx, sig, DefaultConfirmTimeout); err != nil {
+			return fmt.Errorf("withdrawal not confirmed, SOL left wrapped: %w", err)
+		}
+	}
+
+	wrapped, exists, err := c.GetWrappedSOLBalance(ctx)
+	if err != nil || !exists || wrapped <= wrappedBefore {
+		return err
+	}
+	if _, err := c.UnwrapSOL(ctx, wrapped-wrappedBefore); err != nil {
+		return fmt.Errorf("withdrawal succeeded but SOL is still wrapped: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// PortfolioWallet is the Lulo account of one wallet in a portfolio
+type PortfolioWallet struct {
+	Name    string           `json:"name,omitempty"`
+	Wallet  solana.PublicKey `json:"wallet"`
+	Account *Account         `json:"account,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// TokenExposure is the aggregate deposited amount of one token
+type TokenExposure struct {
+	Mint   string  `json:"mint"`
+	Symbol string  `json:"symbol"`
+	Amount float64 `json:"amount"`
+	Value  float64 `json:"value"`
+	Share  float64 `json:"share"` // percent of total value
+}
+
+// Portfolio aggregates the accounts of several wallets
+type Portfolio struct {
+	Wallets        []PortfolioWallet `json:"wallets"`
+	TotalValue     float64           `json:"totalValue"`
+	InterestEarned float64           `json:"interestEarned"`
+	WeightedAPY    float64           `json:"weightedAPY"` // realtime APY weighted by value
+	Exposure       []TokenExposure   `json:"exposure"`
+	// Wallets whose account came without positions, missing from Exposure
+	NoPositions int `json:"noPositions,omitempty"`
+}
+
+// FetchPortfolio fetches the accounts of wallets with at most concurrency
+// requests in flight and no more than rate requests per second. Failed
+// wallets are kept with their error.
+func FetchPortfolio(ctx context.Context, luloClient *LuloClient, wallets []PortfolioWallet, concurrency int, rate float64) *Portfolio {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var ticks <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	results := make([]PortfolioWallet, len(wallets))
+	copy(results, wallets)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		// Start the first request right away, then wait for the rate limiter
+		if i > 0 && ticks != nil {
+			select {
+			case <-ticks:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			results[i].Error = ctx.Err().Error()
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(result *PortfolioWallet) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			account, err := luloClient.GetAccount(ctx, result.Wallet)
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Account = account
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return SummarizePortfolio(results)
+}
+
+// SummarizePortfolio computes the aggregate value, interest, weighted APY and
+// token exposure of the wallets that were fetched successfully
+func SummarizePortfolio(wallets []PortfolioWallet) *Portfolio {
+	portfolio := &Portfolio{Wallets: wallets}
+	exposure := map[string]*TokenExposure{}
+	weighted := 0.0
+
+	for _, wallet := range wallets {
+		account := wallet.Account
+		if account == nil {
+			continue
+		}
+		portfolio.TotalValue += account.TotalValue
+		portfolio.InterestEarned += account.InterestEarned
+		weighted += account.RealtimeAPY * account.TotalValue
+		if !account.HasPositions() {
+			portfolio.NoPositions++
+		}
+
+		for _, position := range account.Positions {
+			token, ok := exposure[position.MintAddress]
+			if !ok {
+				token = &TokenExposure{Mint: position.MintAddress, Symbol: TokenSymbol(position.MintAddress)}
+				exposure[position.MintAddress] = token
+			}
+			token.Amount += position.Amount
+			token.Value += position.Value
+		}
+	}
+
+	if portfolio.TotalValue > 0 {
+		portfolio.WeightedAPY = weighted / portfolio.TotalValue
+	}
+	for _, token := range exposure {
+		if portfolio.TotalValue > 0 {
+			token.Share = token.Value / portfolio.TotalValue * 100
+		}
+		portfolio.Exposure = append(portfolio.Exposure, *token)
+	}
+	sort.Slice(portfolio.Exposure, func(i, j int) bool {
+		return portfolio.Exposure[i].Value > portfolio.Exposure[j].Value
+	})
+	return portfolio
+}
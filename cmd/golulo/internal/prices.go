@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const coingeckoAPIURL = "https://api.coingecko.com/api/v3"
+
+// ErrPriceUnknown is returned when a token has no price for a day, as opposed
+// to the price lookup failing
+var ErrPriceUnknown = errors.New("price unknown")
+
+// PriceSource returns the USD price of a token at a point in time
+type PriceSource interface {
+	PriceAt(ctx context.Context, mint string, at time.Time) (float64, error)
+}
+
+// CoingeckoPrices looks up daily historical USD prices from the CoinGecko API.
+// Stablecoins in the token registry are priced at 1 without a lookup.
+type CoingeckoPrices struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+
+	cache map[string]float64
+}
+
+// NewCoingeckoPrices creates a price source from config values
+func NewCoingeckoPrices() *CoingeckoPrices {
+	baseURL := viper.GetString("price-api-url")
+	if baseURL == "" {
+		baseURL = coingeckoAPIURL
+	}
+
+	return &CoingeckoPrices{
+		BaseURL:    baseURL,
+		APIKey:     viper.GetString("price-api-key"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		cache:      map[string]float64{},
+	}
+}
+
+// PriceAt returns the USD price of a mint on the UTC day of at
+func (p *CoingeckoPrices) PriceAt(ctx context.Context, mint string, at time.Time) (float64, error) {
+	info, ok := LookupToken(mint)
+	if !ok || info.CoingeckoID == "" {
+		return 0, fmt.Errorf("%w: no price source for token %s", ErrPriceUnknown, mint)
+	}
+	if info.Stable {
+		return 1, nil
+	}
+
+	date := at.UTC().Format("02-01-2006")
+	key := info.CoingeckoID + "@" + date
+	if price, ok := p.cache[key]; ok {
+		return price, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/coins/%s/history?date=%s&localization=false",
+		p.BaseURL, url.PathEscape(info.CoingeckoID), date)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("x-cg-demo-api-key", p.APIKey)
+	}
+
+	LoggerFrom(ctx).WithFields(logrus.Fields{
+		"token": info.Symbol,
+		"date":  date,
+	}).Debug("Fetching historical price")
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch price: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code from price API: %d", resp.StatusCode)
+	}
+
+	var response struct {
+		MarketData struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("failed to decode price response: %w", err)
+	}
+
+	price, ok := response.MarketData.CurrentPrice["usd"]
+	if !ok {
+		return 0, fmt.Errorf("%w: no USD price for %s on %s", ErrPriceUnknown, info.Symbol, date)
+	}
+	p.cache[key] = price
+	return price, nil
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/spf13/viper"
+)
+
+// Profile is a named wallet from the `profiles` section of the config file.
+// Watch-only profiles only set Wallet; profiles that can sign set Keypair,
+// and Passphrase when the keypair is encrypted.
+type Profile struct {
+	Name       string `mapstructure:"-"`
+	Wallet     string `mapstructure:"wallet"`
+	Keypair    string `mapstructure:"keypair"`
+	Passphrase string `mapstructure:"passphrase"`
+}
+
+// LoadProfiles reads the configured profiles sorted by name
+func LoadProfiles() ([]Profile, error) {
+	var byName map[string]Profile
+	if err := viper.UnmarshalKey("profiles", &byName); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles config: %w", err)
+	}
+
+	profiles := make([]Profile, 0, len(byName))
+	for name, profile := range byName {
+		profile.Name = name
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	return profiles, nil
+}
+
+// PublicKey returns the profile's wallet, deriving it from the keypair when no
+// wallet is set
+func (p Profile) PublicKey() (solana.PublicKey, error) {
+	if p.Wallet != "" {
+		wallet, err := solana.PublicKeyFromBase58(p.Wallet)
+		if err != nil {
+			return solana.PublicKey{}, fmt.Errorf("profile %s: invalid wallet %q: %w", p.Name, p.Wallet, err)
+		}
+		return wallet, nil
+	}
+	if p.Keypair == "" {
+		return solana.PublicKey{}, fmt.Errorf("profile %s has neither a wallet nor a keypair", p.Name)
+	}
+	publicKey, err := KeypairPublicKey(p.Keypair)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return publicKey, nil
+}
+
+// ResolveWallet turns a wallet address or profile name into a public key,
+// returning the profile name when it was one
+func ResolveWallet(arg string) (string, solana.PublicKey, error) {
+	if wallet, err := solana.PublicKeyFromBase58(arg); err == nil {
+		return "", wallet, nil
+	}
+
+	profile, ok, err := FindProfile(arg)
+	if err != nil {
+		return "", solana.PublicKey{}, err
+	}
+	if !ok {
+		return "", solana.PublicKey{}, fmt.Errorf("%q is neither a wallet address nor a configured profile", arg)
+	}
+	wallet, err := profile.PublicKey()
+	return profile.Name, wallet, err
+}
+
+// FindProfile looks up a profile by name
+func FindProfile(name string) (Profile, bool, error) {
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return Profile{}, false, err
+	}
+	for _, profile := range profiles {
+		if strings.EqualFold(profile.Name, name) {
+			return profile, true, nil
+		}
+	}
+	return Profile{}, false, nil
+}
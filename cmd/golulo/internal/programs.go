@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// LuloProgramID is the on-chain Lulo (Flexlend) program
+var LuloProgramID = solana.MustPublicKeyFromBase58("FL3X2pRsQ9zHENpZSKDRREtccwJuei8yg9fwDu9UN69Q")
+
+// protocolPrograms maps the lending protocols Lulo routes deposits into to their names
+var protocolPrograms = map[string]string{
+	"KLend2g3cP87fffoy8q1mQqGKjrxjC8boSyAYavgmjD":      "kamino",
+	"MFv2hWf31Z9kbCa1snEPYctwafyhdvnV7FCnsc3LdvNwrFuE": "marginfi",
+	"So1endDq2YkqhipRh3WViPa8hdiSpxWy6z3Z6tMCpAo":      "solend",
+	"dRiftyHA39MWEi3m9aunc5MzRF1JYuBsbn6VPcn33UH":      "drift",
+}
+
+// ProtocolName returns the lending protocol name for a program ID, if known
+func ProtocolName(programID string) (string, bool) {
+	name, ok := protocolPrograms[programID]
+	return name, ok
+}
+
+// programNames maps well-known program IDs to display names
+var programNames = map[solana.PublicKey]string{
+	solana.SystemProgramID:                    "System",
+	solana.TokenProgramID:                     "SPL Token",
+	solana.Token2022ProgramID:                 "Token-2022",
+	solana.SPLAssociatedTokenAccountProgramID: "Associated Token",
+	solana.ComputeBudget:                      "Compute Budget",
+	solana.MemoProgramID:                      "Memo",
+	LuloProgramID:                             "Lulo",
+}
+
+// ProgramName returns the display name of a program ID, if known. Lending
+// protocols are named after the protocol, e.g. "Kamino".
+func ProgramName(programID solana.PublicKey) (string, bool) {
+	if name, ok := programNames[programID]; ok {
+		return name, true
+	}
+	if name, ok := ProtocolName(programID.String()); ok {
+		return strings.ToUpper(name[:1]) + name[1:], true
+	}
+	return "", false
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RPC authentication styles
+const (
+	RPCAuthQuery  = "query"  // ?<param>=<key>, the default
+	RPCAuthHeader = "header" // <header>: <key>
+	RPCAuthBearer = "bearer" // Authorization: Bearer <key>
+	RPCAuthBasic  = "basic"  // Authorization: Basic <username:key>
+	RPCAuthPath   = "path"   // key as a path segment, or in place of {api-key}
+	RPCAuthNone   = "none"
+)
+
+// redacted replaces secrets in printed URLs and messages
+const redacted = "REDACTED"
+
+// RPCAuthConfig describes how an RPC provider expects the API key
+type RPCAuthConfig struct {
+	Style    string `mapstructure:"style"`
+	Param    string `mapstructure:"param"`    // query parameter name, default api-key
+	Header   string `mapstructure:"header"`   // header name, default x-api-key
+	Username string `mapstructure:"username"` // basic auth user, the key is the password
+}
+
+// ApplyRPCAuth adds key to an RPC URL in the configured style, returning the
+// URL to call and any headers to send with each request. URLs that already
+// carry a query string keep it. Nothing is added when key is empty.
+func ApplyRPCAuth(rawURL, key string, auth RPCAuthConfig) (string, map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid RPC URL %s: %w", RedactURL(rawURL), err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", nil, fmt.Errorf("invalid RPC URL %s: scheme and host required", RedactURL(rawURL))
+	}
+	if key == "" {
+		return u.String(), nil, nil
+	}
+	RegisterSecret(key)
+
+	headers := map[string]string{}
+	switch strings.ToLower(auth.Style) {
+	case "", RPCAuthQuery:
+		param := auth.Param
+		if param == "" {
+			param = "api-key"
+		}
+		query := u.Query()
+		query.Set(param, key)
+		u.RawQuery = query.Encode()
+	case RPCAuthHeader:
+		header := auth.Header
+		if header == "" {
+			header = "x-api-key"
+		}
+		headers[header] = key
+	case RPCAuthBearer:
+		headers["Authorization"] = "Bearer " + key
+	case RPCAuthBasic:
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + key))
+		headers["Authorization"] = "Basic " + credentials
+	case RPCAuthPath:
+		if strings.Contains(u.Path, "{api-key}") {
+			u.Path = strings.ReplaceAll(u.Path, "{api-key}", key)
+			u.RawPath = ""
+		} else {
+			u = u.JoinPath(key)
+		}
+	case RPCAuthNone:
+	default:
+		return "", nil, fmt.Errorf("unknown RPC auth style %q", auth.Style)
+	}
+	return u.String(), headers, nil
+}
+
+// minSecretLength is the shortest value RegisterSecret accepts. Secrets are
+// replaced wherever they appear, so shorter ones would mangle unrelated text;
+// credentials in URLs are still redacted by RedactURL whatever their length.
+const minSecretLength = 12
+
+var (
+	secretsMu sync.RWMutex
+	secrets   []string
+)
+
+// RegisterSecret adds a value that RedactSecrets removes from messages
+func RegisterSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, variant := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+		known := false
+		for _, s := range secrets {
+			if s == variant {
+				known = true
+				break
+			}
+		}
+		if !known {
+			secrets = append(secrets, variant)
+		}
+	}
+}
+
+// RedactSecrets replaces every registered secret in s
+func RedactSecrets(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// RegisterURLSecrets registers the credentials found in a URL: the user info
+// password and the values of query parameters that look like keys or tokens
+func RegisterURLSecrets(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			RegisterSecret(password)
+		} else {
+			RegisterSecret(u.User.Username())
+		}
+	}
+	for name, values := range u.Query() {
+		if sensitiveParam(name) {
+			for _, value := range values {
+				RegisterSecret(value)
+			}
+		}
+	}
+}
+
+// sensitiveParams are query parameter name fragments whose values are redacted
+var sensitiveParams = []string{"key", "token", "secret", "auth", "password", "signature"}
+
+// RedactURL hides credentials in a URL for printing: user info, query
+// parameters that look like keys or tokens, and registered secrets
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return RedactSecrets(rawURL)
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		} else {
+			u.User = url.User(redacted)
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if sensitiveParam(name) {
+				query.Set(name, redacted)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return RedactSecrets(u.String())
+}
+
+// sensitiveParam reports whether a query parameter looks like it holds a credential
+func sensitiveParam(name string) bool {
+	lower := strings.ToLower(name)
+	for _, fragment := range sensitiveParams {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedError hides secrets in an error message while keeping the wrapped
+// error for errors.Is and errors.As
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// RedactError returns err with registered secrets removed from its message
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactSecrets(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
@@ -0,0 +1,460 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// RPC pool strategies
+const (
+	RPCFailover   = "failover"    // use endpoints in config order
+	RPCRoundRobin = "round-robin" // spread requests over healthy endpoints
+)
+
+// rpcNodeUnhealthy is the JSON-RPC error code of a node that is behind
+const rpcNodeUnhealthy = -32005
+
+// RPCEndpointConfig is one entry of rpc.endpoints in the config file
+type RPCEndpointConfig struct {
+	Name   string         `mapstructure:"name"`
+	URL    string         `mapstructure:"url"`
+	APIKey string         `mapstructure:"api-key"`
+	Auth   *RPCAuthConfig `mapstructure:"auth"` // defaults to rpc.auth
+}
+
+// RPCConfig is the `rpc` section of the config file
+type RPCConfig struct {
+	Endpoints      []RPCEndpointConfig `mapstructure:"endpoints"`
+	Auth           RPCAuthConfig       `mapstructure:"auth"` // how API keys are sent
+	Strategy       string              `mapstructure:"strategy"`
+	Broadcast      bool                `mapstructure:"broadcast"`       // send transactions to every endpoint
+	MaxSlotLag     uint64              `mapstructure:"max-slot-lag"`    // slots behind the best endpoint before it is unhealthy
+	HealthInterval time.Duration       `mapstructure:"health-interval"` // how often endpoints are re-checked
+	Timeout        time.Duration       `mapstructure:"timeout"`         // per request
+}
+
+// LoadRPCConfig reads the RPC endpoints from the config. rpc-url, when set,
+// is the first endpoint, followed by rpc.endpoints.
+func LoadRPCConfig() (RPCConfig, error) {
+	var cfg RPCConfig
+	if err := viper.UnmarshalKey("rpc", &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse rpc config: %w", err)
+	}
+	if rpcURL := viper.GetString("rpc-url"); rpcURL != "" {
+		primary := RPCEndpointConfig{Name: "default", URL: rpcURL, APIKey: viper.GetString("rpc-api-key")}
+		cfg.Endpoints = append([]RPCEndpointConfig{primary}, cfg.Endpoints...)
+	}
+	if len(cfg.Endpoints) == 0 {
+		return cfg, fmt.Errorf("RPC URL not set in config")
+	}
+
+	for i := range cfg.Endpoints {
+		endpoint := &cfg.Endpoints[i]
+		if endpoint.URL == "" {
+			return cfg, fmt.Errorf("rpc endpoint %d has no url", i+1)
+		}
+		if endpoint.Name == "" {
+			endpoint.Name = fmt.Sprintf("rpc-%d", i+1)
+		}
+		if endpoint.APIKey != "" {
+			key, err := ResolveSecret(endpoint.APIKey)
+			if err != nil {
+				return cfg, fmt.Errorf("failed to resolve api-key of rpc endpoint %s: %w", endpoint.Name, err)
+			}
+			endpoint.APIKey = key
+		}
+	}
+
+	switch cfg.Strategy {
+	case "":
+		cfg.Strategy = RPCFailover
+	case RPCFailover, RPCRoundRobin:
+	default:
+		return cfg, fmt.Errorf("unknown rpc strategy %q", cfg.Strategy)
+	}
+	if cfg.MaxSlotLag == 0 {
+		cfg.MaxSlotLag = 50
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return cfg, nil
+}
+
+// RPCEndpoint is one RPC server of a pool with its health and request stats
+type RPCEndpoint struct {
+	Name   string
+	URL    string
+	client jsonrpc.RPCClient
+
+	mu        sync.Mutex
+	healthy   bool
+	checked   bool
+	slot      uint64
+	lag       uint64
+	requests  int
+	errors    int
+	latency   time.Duration // total over all requests
+	lastError string
+}
+
+// RPCEndpointStats is a snapshot of an endpoint's health and request stats
+type RPCEndpointStats struct {
+	Name       string        `json:"name"`
+	URL        string        `json:"url"`
+	Healthy    bool          `json:"healthy"`
+	Checked    bool          `json:"checked"`
+	Slot       uint64        `json:"slot"`
+	Lag        uint64        `json:"lag"`
+	Requests   int           `json:"requests"`
+	Errors     int           `json:"errors"`
+	AvgLatency time.Duration `json:"avgLatency"`
+	LastError  string        `json:"lastError,omitempty"`
+}
+
+// record adds the outcome of a request to the endpoint's stats
+func (e *RPCEndpoint) record(latency time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests++
+	e.latency += latency
+	if err != nil {
+		e.errors++
+		e.lastError = rpcErrorMessage(err)
+	}
+}
+
+// Stats returns a snapshot of the endpoint's stats
+func (e *RPCEndpoint) Stats() RPCEndpointStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := RPCEndpointStats{
+		Name:      e.Name,
+		URL:       e.URL,
+		Healthy:   e.healthy,
+		Checked:   e.checked,
+		Slot:      e.slot,
+		Lag:       e.lag,
+		Requests:  e.requests,
+		Errors:    e.errors,
+		LastError: e.lastError,
+	}
+	if e.requests > 0 {
+		stats.AvgLatency = e.latency / time.Duration(e.requests)
+	}
+	return stats
+}
+
+// isHealthy reports whether the endpoint passed its last health check.
+// Endpoints that have not been checked yet count as healthy.
+func (e *RPCEndpoint) isHealthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.healthy || !e.checked
+}
+
+// RPCPool is a JSON-RPC client that spreads requests over several endpoints,
+// failing over to the next one on network errors, timeouts, HTTP errors and
+// unhealthy nodes. It implements rpc.JSONRPCClient.
+type RPCPool struct {
+	Endpoints []*RPCEndpoint
+	Log       *logrus.Entry
+	cfg       RPCConfig
+
+	next      atomic.Uint64
+	checkMu   sync.Mutex
+	checkedAt time.Time
+}
+
+// NewRPCPool creates a pool from the config. When transport is set it carries
+// the HTTP requests, e.g. to record metrics.
+func NewRPCPool(transport http.RoundTripper, log *logrus.Entry) (*RPCPool, error) {
+	cfg, err := LoadRPCConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := &RPCPool{cfg: cfg, Log: log}
+	for _, endpointCfg := range cfg.Endpoints {
+		auth := cfg.Auth
+		if endpointCfg.Auth != nil {
+			auth = *endpointCfg.Auth
+		}
+		RegisterURLSecrets(endpointCfg.URL)
+		rpcURL, headers, err := ApplyRPCAuth(endpointCfg.URL, endpointCfg.APIKey, auth)
+		if err != nil {
+			return nil, fmt.Errorf("rpc endpoint %s: %w", endpointCfg.Name, err)
+		}
+
+		pool.Endpoints = append(pool.Endpoints, &RPCEndpoint{
+			Name: endpointCfg.Name,
+			URL:  RedactURL(endpointCfg.URL),
+			client: jsonrpc.NewClientWithOpts(rpcURL, &jsonrpc.RPCClientOpts{
+				HTTPClient:    &http.Client{Transport: transport, Timeout: cfg.Timeout},
+				CustomHeaders: headers,
+			}),
+		})
+	}
+	return pool, nil
+}
+
+// log returns the pool's logger
+func (p *RPCPool) log() *logrus.Entry {
+	if p.Log == nil {
+		return standardLogger()
+	}
+	return p.Log
+}
+
+// CallForInto implements rpc.JSONRPCClient
+func (p *RPCPool) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	if method == "sendTransaction" && p.cfg.Broadcast && len(p.Endpoints) > 1 {
+		return p.broadcast(ctx, out, method, params)
+	}
+	return p.do(ctx, method, func(endpoint *RPCEndpoint) error {
+		return endpoint.client.CallForInto(ctx, out, method, params)
+	})
+}
+
+// CallWithCallback implements rpc.JSONRPCClient
+func (p *RPCPool) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	return p.do(ctx, method, func(endpoint *RPCEndpoint) error {
+		return endpoint.client.CallWithCallback(ctx, method, params, callback)
+	})
+}
+
+// CallBatch implements rpc.JSONRPCClient
+func (p *RPCPool) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	var responses jsonrpc.RPCResponses
+	err := p.do(ctx, "batch", func(endpoint *RPCEndpoint) error {
+		var err error
+		responses, err = endpoint.client.CallBatch(ctx, requests)
+		return err
+	})
+	return responses, err
+}
+
+// do runs call against endpoints in order until one succeeds or fails with
+// an error another endpoint would return too
+func (p *RPCPool) do(ctx context.Context, method string, call func(*RPCEndpoint) error) error {
+	p.ensureHealth(ctx)
+
+	var lastErr error
+	for _, endpoint := range p.order() {
+		start := time.Now()
+		err := call(endpoint)
+		endpoint.record(time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		err = RedactError(err)
+		if !shouldFailover(ctx, err) {
+			return err
+		}
+
+		p.log().WithFields(logrus.Fields{
+			"endpoint": endpoint.Name,
+			"method":   method,
+			"error":    err,
+		}).Warn("RPC request failed, trying next endpoint")
+		lastErr = err
+	}
+	return fmt.Errorf("all RPC endpoints failed: %w", lastErr)
+}
+
+// broadcast sends a request to every endpoint at once and returns the first
+// successful result. Used for sendTransaction, which is safe to repeat.
+func (p *RPCPool) broadcast(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	type result struct {
+		raw json.RawMessage
+		err error
+	}
+	results := make(chan result, len(p.Endpoints))
+	for _, endpoint := range p.Endpoints {
+		go func(endpoint *RPCEndpoint) {
+			var raw json.RawMessage
+			start := time.Now()
+			err := RedactError(endpoint.client.CallForInto(ctx, &raw, method, params))
+			endpoint.record(time.Since(start), err)
+			if err != nil {
+				p.log().WithFields(logrus.Fields{"endpoint": endpoint.Name, "error": err}).Debug("Broadcast failed on endpoint")
+			}
+			results <- result{raw, err}
+		}(endpoint)
+	}
+
+	// Prefer an error the node itself returned, e.g. a failed simulation,
+	// over network errors
+	var firstErr error
+	for range p.Endpoints {
+		r := <-results
+		if r.err == nil {
+			return json.Unmarshal(r.raw, out)
+		}
+		if firstErr == nil || (shouldFailover(ctx, firstErr) && !shouldFailover(ctx, r.err)) {
+			firstErr = r.err
+		}
+	}
+	return firstErr
+}
+
+// order returns the endpoints to try: healthy ones first, starting at the
+// next one in turn for round-robin, then unhealthy ones as a last resort
+func (p *RPCPool) order() []*RPCEndpoint {
+	var healthy, unhealthy []*RPCEndpoint
+	for _, endpoint := range p.Endpoints {
+		if endpoint.isHealthy() {
+			healthy = append(healthy, endpoint)
+		} else {
+			unhealthy = append(unhealthy, endpoint)
+		}
+	}
+	if p.cfg.Strategy == RPCRoundRobin && len(healthy) > 1 {
+		start := int(p.next.Add(1) % uint64(len(healthy)))
+		healthy = append(healthy[start:], healthy[:start]...)
+	}
+	return append(healthy, unhealthy...)
+}
+
+// ensureHealth re-checks the endpoints when the last check is older than the
+// health interval. Only the first check is waited for; later ones run in the
+// background while calls go on with the last known health. A single endpoint
+// is never checked since there is nothing to fail over to.
+func (p *RPCPool) ensureHealth(ctx context.Context) {
+	if len(p.Endpoints) < 2 {
+		return
+	}
+	p.checkMu.Lock()
+	defer p.checkMu.Unlock()
+	if time.Since(p.checkedAt) < p.cfg.HealthInterval {
+		return
+	}
+	if p.checkedAt.IsZero() {
+		// Nothing is known about the endpoints yet
+		p.checkHealth(ctx)
+		p.checkedAt = time.Now()
+		return
+	}
+	// Claim the check so concurrent calls don't start their own
+	p.checkedAt = time.Now()
+	go p.checkHealth(context.WithoutCancel(ctx))
+}
+
+// CheckHealth checks every endpoint with getHealth and getSlot. An endpoint is
+// healthy when it reports ok and is at most max-slot-lag slots behind the
+// most advanced endpoint.
+func (p *RPCPool) CheckHealth(ctx context.Context) {
+	p.checkHealth(ctx)
+	p.checkMu.Lock()
+	p.checkedAt = time.Now()
+	p.checkMu.Unlock()
+}
+
+func (p *RPCPool) checkHealth(ctx context.Context) {
+	type check struct {
+		ok   bool
+		slot uint64
+	}
+	checks := make([]check, len(p.Endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range p.Endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *RPCEndpoint) {
+			defer wg.Done()
+
+			var health string
+			start := time.Now()
+			err := endpoint.client.CallForInto(ctx, &health, "getHealth", nil)
+			endpoint.record(time.Since(start), err)
+			if err != nil || health != rpc.HealthOk {
+				p.log().WithFields(logrus.Fields{"endpoint": endpoint.Name, "health": health, "error": RedactError(err)}).Debug("RPC endpoint unhealthy")
+				return
+			}
+
+			var slot uint64
+			start = time.Now()
+			err = endpoint.client.CallForInto(ctx, &slot, "getSlot", []interface{}{rpc.M{"commitment": rpc.CommitmentProcessed}})
+			endpoint.record(time.Since(start), err)
+			if err != nil {
+				return
+			}
+			checks[i] = check{ok: true, slot: slot}
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, c := range checks {
+		if c.slot > best {
+			best = c.slot
+		}
+	}
+
+	for i, endpoint := range p.Endpoints {
+		c := checks[i]
+		endpoint.mu.Lock()
+		endpoint.checked = true
+		endpoint.slot = c.slot
+		endpoint.lag = 0
+		if c.ok {
+			endpoint.lag = best - c.slot
+		}
+		endpoint.healthy = c.ok && endpoint.lag <= p.cfg.MaxSlotLag
+		endpoint.mu.Unlock()
+
+		if c.ok && !endpoint.isHealthy() {
+			p.log().WithFields(logrus.Fields{"endpoint": endpoint.Name, "lag": best - c.slot}).Warn("RPC endpoint is behind")
+		}
+	}
+}
+
+// Stats returns a snapshot of every endpoint's stats
+func (p *RPCPool) Stats() []RPCEndpointStats {
+	stats := make([]RPCEndpointStats, 0, len(p.Endpoints))
+	for _, endpoint := range p.Endpoints {
+		stats = append(stats, endpoint.Stats())
+	}
+	return stats
+}
+
+// rpcErrorMessage formats an RPC error on one line
+func rpcErrorMessage(err error) string {
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return fmt.Sprintf("%s (code %d)", rpcErr.Message, rpcErr.Code)
+	}
+	var httpErr *jsonrpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return fmt.Sprintf("HTTP status %d", httpErr.Code)
+	}
+	return RedactSecrets(err.Error())
+}
+
+// shouldFailover reports whether a failed request is worth retrying on
+// another endpoint. Errors the node returned for the request itself, such as
+// a failed simulation, would be the same everywhere.
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == rpcNodeUnhealthy
+	}
+	return true
+}
@@ -0,0 +1,352 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+)
+
+// fakeEndpoint is a JSON-RPC server whose answers a test controls
+type fakeEndpoint struct {
+	slot     uint64
+	status   int           // HTTP status for every request other than health checks, 0 for 200
+	delay    time.Duration // before answering requests other than health checks
+	rpcError *jsonrpc.RPCError
+	result   interface{} // result of requests other than health checks
+	health   string      // getHealth result, "ok" when empty
+
+	mu          sync.Mutex
+	calls       map[string]int
+	healthDelay time.Duration // before answering getHealth
+}
+
+func (e *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     interface{} `json:"id"`
+		Method string      `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	if e.calls == nil {
+		e.calls = map[string]int{}
+	}
+	e.calls[req.Method]++
+	healthDelay := e.healthDelay
+	e.mu.Unlock()
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "getHealth":
+		select {
+		case <-time.After(healthDelay):
+		case <-r.Context().Done():
+			return
+		}
+		health := e.health
+		if health == "" {
+			health = "ok"
+		}
+		resp["result"] = health
+	case "getSlot":
+		resp["result"] = e.slot
+	default:
+		select {
+		case <-time.After(e.delay):
+		case <-r.Context().Done():
+			return
+		}
+		if e.status != 0 {
+			http.Error(w, "upstream unavailable", e.status)
+			return
+		}
+		if e.rpcError != nil {
+			resp["error"] = e.rpcError
+		} else {
+			resp["result"] = e.result
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// count returns how often a method was called
+func (e *fakeEndpoint) count(method string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls[method]
+}
+
+// newTestPool serves each endpoint over HTTP and pools them
+func newTestPool(t *testing.T, cfg RPCConfig, endpoints ...*fakeEndpoint) *RPCPool {
+	t.Helper()
+	if cfg.Strategy == "" {
+		cfg.Strategy = RPCFailover
+	}
+	if cfg.MaxSlotLag == 0 {
+		cfg.MaxSlotLag = 50
+	}
+	if cfg.HealthInterval == 0 {
+		cfg.HealthInterval = time.Hour
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	pool := &RPCPool{cfg: cfg}
+	for i, endpoint := range endpoints {
+		srv := httptest.NewServer(endpoint)
+		t.Cleanup(srv.Close)
+		pool.Endpoints = append(pool.Endpoints, &RPCEndpoint{
+			Name:   string(rune('a' + i)),
+			URL:    srv.URL,
+			client: jsonrpc.NewClientWithOpts(srv.URL, &jsonrpc.RPCClientOpts{HTTPClient: &http.Client{Timeout: cfg.Timeout}}),
+		})
+	}
+	return pool
+}
+
+func TestRPCPoolFailover(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   *fakeEndpoint
+		timeout time.Duration
+	}{
+		{name: "5xx", first: &fakeEndpoint{slot: 100, status: http.StatusBadGateway}},
+		{name: "timeout", first: &fakeEndpoint{slot: 100, delay: time.Second, result: "late"}, timeout: 200 * time.Millisecond},
+		{name: "node unhealthy", first: &fakeEndpoint{slot: 100, rpcError: &jsonrpc.RPCError{Code: rpcNodeUnhealthy, Message: "Node is behind"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			second := &fakeEndpoint{slot: 100, result: "second"}
+			pool := newTestPool(t, RPCConfig{Timeout: tt.timeout}, tt.first, second)
+
+			var out string
+			if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+				t.Fatalf("CallForInto: %v", err)
+			}
+			if out != "second" {
+				t.Errorf("result = %q, want the second endpoint's", out)
+			}
+			if tt.first.count("getVersion") != 1 || second.count("getVersion") != 1 {
+				t.Errorf("calls = %d and %d, want one each", tt.first.count("getVersion"), second.count("getVersion"))
+			}
+			if stats := pool.Endpoints[0].Stats(); stats.LastError == "" {
+				t.Errorf("first endpoint stats = %+v, want the error recorded", stats)
+			}
+		})
+	}
+}
+
+func TestRPCPoolNoFailoverOnNodeError(t *testing.T) {
+	first := &fakeEndpoint{slot: 100, rpcError: &jsonrpc.RPCError{Code: rpcCodePreflightFailure, Message: "Transaction simulation failed"}}
+	second := &fakeEndpoint{slot: 100, result: "second"}
+	pool := newTestPool(t, RPCConfig{}, first, second)
+
+	var out string
+	err := pool.CallForInto(context.Background(), &out, "sendTransaction", nil)
+	var rpcErr *jsonrpc.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != rpcCodePreflightFailure {
+		t.Fatalf("err = %v, want the node's RPC error", err)
+	}
+	if second.count("sendTransaction") != 0 {
+		t.Error("request repeated on the second endpoint")
+	}
+}
+
+func TestRPCPoolAllFail(t *testing.T) {
+	first := &fakeEndpoint{slot: 100, status: http.StatusServiceUnavailable}
+	second := &fakeEndpoint{slot: 100, status: http.StatusInternalServerError}
+	pool := newTestPool(t, RPCConfig{}, first, second)
+
+	var out string
+	err := pool.CallForInto(context.Background(), &out, "getVersion", nil)
+	var httpErr *jsonrpc.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusInternalServerError {
+		t.Fatalf("err = %v, want the last endpoint's HTTP error", err)
+	}
+}
+
+func TestRPCPoolSlotLag(t *testing.T) {
+	ahead := &fakeEndpoint{slot: 1000, result: "ahead"}
+	behind := &fakeEndpoint{slot: 900, result: "behind"}
+	near := &fakeEndpoint{slot: 960, result: "near"}
+	down := &fakeEndpoint{slot: 1000, health: "behind", result: "down"}
+	pool := newTestPool(t, RPCConfig{MaxSlotLag: 50}, behind, down, near, ahead)
+
+	pool.CheckHealth(context.Background())
+	want := []struct {
+		healthy bool
+		lag     uint64
+	}{
+		{healthy: false, lag: 100},
+		{healthy: false},
+		{healthy: true, lag: 40},
+		{healthy: true},
+	}
+	for i, stats := range pool.Stats() {
+		if !stats.Checked || stats.Healthy != want[i].healthy || stats.Lag != want[i].lag {
+			t.Errorf("endpoint %s = %+v, want healthy %v lag %d", stats.Name, stats, want[i].healthy, want[i].lag)
+		}
+	}
+
+	// Healthy endpoints are tried first, the others in config order as a last resort
+	var names []string
+	for _, endpoint := range pool.order() {
+		names = append(names, endpoint.Name)
+	}
+	if got := names[0] + names[1] + names[2] + names[3]; got != "cdab" {
+		t.Errorf("order = %v, want c, d, then a and b", names)
+	}
+
+	var out string
+	if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+		t.Fatalf("CallForInto: %v", err)
+	}
+	if out != "near" || behind.count("getVersion") != 0 {
+		t.Errorf("result = %q, lagging endpoint called %d times", out, behind.count("getVersion"))
+	}
+}
+
+func TestRPCPoolChecksHealthOnFirstUse(t *testing.T) {
+	behind := &fakeEndpoint{slot: 100, result: "behind"}
+	ahead := &fakeEndpoint{slot: 1000, result: "ahead"}
+	pool := newTestPool(t, RPCConfig{}, behind, ahead)
+
+	var out string
+	for i := 0; i < 3; i++ {
+		if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+			t.Fatalf("CallForInto: %v", err)
+		}
+	}
+	if out != "ahead" {
+		t.Errorf("result = %q, want the endpoint that is not behind", out)
+	}
+	if behind.count("getHealth") != 1 || ahead.count("getHealth") != 1 {
+		t.Errorf("health checked %d and %d times, want once within the interval", behind.count("getHealth"), ahead.count("getHealth"))
+	}
+}
+
+func TestRPCPoolRecheckDoesNotBlock(t *testing.T) {
+	behind := &fakeEndpoint{slot: 100, result: "behind"}
+	ahead := &fakeEndpoint{slot: 1000, result: "ahead"}
+	pool := newTestPool(t, RPCConfig{HealthInterval: 50 * time.Millisecond}, behind, ahead)
+
+	var out string
+	if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+		t.Fatalf("CallForInto: %v", err)
+	}
+
+	// The next check hangs on one endpoint
+	behind.mu.Lock()
+	behind.healthDelay = time.Second
+	behind.mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+			t.Fatalf("CallForInto: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("calls took %s, want them not to wait for the health check", elapsed)
+	}
+	if out != "ahead" {
+		t.Errorf("result = %q, want the last known healthy endpoint", out)
+	}
+	// The re-check still runs, once, in the background
+	for deadline := time.Now().Add(time.Second); (ahead.count("getHealth") < 2 || behind.count("getHealth") < 2) && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ahead.count("getHealth") != 2 || behind.count("getHealth") != 2 {
+		t.Errorf("health checked %d and %d times, want one re-check", behind.count("getHealth"), ahead.count("getHealth"))
+	}
+}
+
+func TestRPCPoolRoundRobin(t *testing.T) {
+	endpoints := []*fakeEndpoint{{slot: 100, result: "a"}, {slot: 100, result: "b"}, {slot: 100, result: "c"}}
+	pool := newTestPool(t, RPCConfig{Strategy: RPCRoundRobin}, endpoints...)
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		var out string
+		if err := pool.CallForInto(context.Background(), &out, "getVersion", nil); err != nil {
+			t.Fatalf("CallForInto: %v", err)
+		}
+		got = append(got, out)
+	}
+	for i := range got {
+		if i >= 3 && got[i] != got[i-3] {
+			t.Errorf("results = %v, want a repeating rotation", got)
+			break
+		}
+		if i > 0 && got[i] == got[i-1] {
+			t.Errorf("results = %v, want consecutive requests on different endpoints", got)
+			break
+		}
+	}
+	for i, endpoint := range endpoints {
+		if endpoint.count("getVersion") != 2 {
+			t.Errorf("endpoint %d served %d requests, want 2", i, endpoint.count("getVersion"))
+		}
+	}
+
+	// Failover order still skips endpoints that failed
+	failover := newTestPool(t, RPCConfig{}, &fakeEndpoint{slot: 100, result: "a"}, &fakeEndpoint{slot: 100, result: "b"})
+	for i := 0; i < 3; i++ {
+		var out string
+		if err := failover.CallForInto(context.Background(), &out, "getVersion", nil); err != nil || out != "a" {
+			t.Errorf("failover result = %q, %v; want the first endpoint every time", out, err)
+		}
+	}
+}
+
+func TestRPCPoolBroadcast(t *testing.T) {
+	failing := &fakeEndpoint{slot: 100, status: http.StatusBadGateway}
+	slow := &fakeEndpoint{slot: 100, delay: 300 * time.Millisecond, result: "slow"}
+	fast := &fakeEndpoint{slot: 100, result: "fast"}
+	pool := newTestPool(t, RPCConfig{Broadcast: true}, failing, slow, fast)
+
+	var out string
+	start := time.Now()
+	if err := pool.CallForInto(context.Background(), &out, "sendTransaction", nil); err != nil {
+		t.Fatalf("CallForInto: %v", err)
+	}
+	if out != "fast" {
+		t.Errorf("result = %q, want the first success", out)
+	}
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("broadcast waited %s for the slow endpoint", elapsed)
+	}
+	for i, endpoint := range []*fakeEndpoint{failing, slow, fast} {
+		if endpoint.count("sendTransaction") != 1 {
+			t.Errorf("endpoint %d received %d sends, want 1", i, endpoint.count("sendTransaction"))
+		}
+	}
+
+}
+
+func TestRPCPoolBroadcastPrefersNodeErrors(t *testing.T) {
+	simulation := &jsonrpc.RPCError{Code: rpcCodePreflightFailure, Message: "Transaction simulation failed"}
+	pool := newTestPool(t, RPCConfig{Broadcast: true},
+		&fakeEndpoint{slot: 100, status: http.StatusBadGateway},
+		&fakeEndpoint{slot: 100, rpcError: simulation},
+		&fakeEndpoint{slot: 100, status: http.StatusServiceUnavailable},
+	)
+
+	var out string
+	err := pool.CallForInto(context.Background(), &out, "sendTransaction", nil)
+	var rpcErr *jsonrpc.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != rpcCodePreflightFailure {
+		t.Fatalf("err = %v, want the simulation failure", err)
+	}
+}
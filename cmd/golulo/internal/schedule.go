@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Job log statuses
+const (
+	JobStarted = "started"
+	JobSent    = "sent"
+	JobFailed  = "failed"
+)
+
+// ScheduledDeposit is a recurring deposit
+type ScheduledDeposit struct {
+	ID      string    `json:"id"`
+	Cron    string    `json:"cron"`
+	Mint    string    `json:"mint"`
+	Amount  string    `json:"amount"`
+	Pool    string    `json:"pool,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// JobLogEntry is one line of the schedule job log
+type JobLogEntry struct {
+	Key        string    `json:"key"` // idempotency key, schedule ID and fire time
+	Schedule   string    `json:"schedule"`
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status"`
+	Mint       string    `json:"mint"`
+	Amount     string    `json:"amount"`
+	Pool       string    `json:"pool,omitempty"`
+	Signatures []string  `json:"signatures,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ScheduleStore holds the scheduled deposits of a wallet. Schedules are kept
+// in a JSON file and the job log is an append-only JSON lines file next to it.
+type ScheduleStore struct {
+	Schedules []ScheduledDeposit `json:"schedules"`
+
+	path string
+}
+
+// LoadScheduleStore reads the schedules of a wallet, returning an empty store if none exist
+func LoadScheduleStore(wallet solana.PublicKey) (*ScheduleStore, error) {
+	path, err := cacheFile("schedules", wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &ScheduleStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Save writes the schedules to disk, replacing the file atomically
+func (s *ScheduleStore) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedules: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schedules: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write schedules: %w", err)
+	}
+	return nil
+}
+
+// Add validates and appends a schedule, assigning it an ID
+func (s *ScheduleStore) Add(schedule ScheduledDeposit) (ScheduledDeposit, error) {
+	if _, err := ParseCron(schedule.Cron); err != nil {
+		return schedule, err
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return schedule, fmt.Errorf("failed to generate schedule ID: %w", err)
+	}
+	schedule.ID = hex.EncodeToString(id)
+	s.Schedules = append(s.Schedules, schedule)
+	return schedule, nil
+}
+
+// Remove deletes a schedule by ID, returning whether it existed
+func (s *ScheduleStore) Remove(id string) bool {
+	for i, schedule := range s.Schedules {
+		if schedule.ID == id {
+			s.Schedules = append(s.Schedules[:i], s.Schedules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// JobKey is the idempotency key of a schedule firing at a given minute
+func JobKey(id string, fire time.Time) string {
+	return id + "@" + fire.UTC().Truncate(time.Minute).Format(time.RFC3339)
+}
+
+// logPath is the job log file next to the schedules file
+func (s *ScheduleStore) logPath() string {
+	return strings.TrimSuffix(s.path, ".json") + ".log"
+}
+
+// AppendJobLog appends an entry to the job log and syncs it to disk
+func (s *ScheduleStore) AppendJobLog(entry JobLogEntry) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode job log entry: %w", err)
+	}
+
+	f, err := os.OpenFile(s.logPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open job log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write job log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync job log: %w", err)
+	}
+	return nil
+}
+
+// JobLog reads the job log, oldest entry first
+func (s *ScheduleStore) JobLog() ([]JobLogEntry, error) {
+	f, err := os.Open(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []JobLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry JobLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A crash mid-write can leave a truncated last line
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job log: %w", err)
+	}
+	return entries, nil
+}
+
+// JobStatus returns the latest logged status of a job key, or "" if it never started
+func (s *ScheduleStore) JobStatus(key string) (string, error) {
+	entries, err := s.JobLog()
+	if err != nil {
+		return "", err
+	}
+	status := ""
+	for _, entry := range entries {
+		if entry.Key == key {
+			status = entry.Status
+		}
+	}
+	return status, nil
+}
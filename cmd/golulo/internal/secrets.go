@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Secret source prefixes. Any other value is used as is.
+const (
+	SecretEnv     = "env:"     // env:VAR
+	SecretFile    = "file:"    // file:/path
+	SecretCommand = "cmd:"     // cmd:pass show lulo
+	SecretKeyring = "keyring:" // keyring:service/account
+)
+
+// secretCommandTimeout bounds how long cmd: and keyring: sources may take
+const secretCommandTimeout = 30 * time.Second
+
+// SecretKeys are the config keys holding secrets
+var SecretKeys = []string{"lulo-api-key", "rpc-api-key", "keypair-passphrase", "serve-token"}
+
+var resolvedSecrets sync.Map // source -> resolved value
+
+// IsSecretSource reports whether a config value points to where the secret
+// is kept rather than being the secret itself
+func IsSecretSource(value string) bool {
+	for _, prefix := range []string{SecretEnv, SecretFile, SecretCommand, SecretKeyring} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecret returns the secret a config value refers to. Values are
+// resolved once per process and registered for redaction.
+func ResolveSecret(value string) (string, error) {
+	if !IsSecretSource(value) {
+		RegisterSecret(value)
+		return value, nil
+	}
+	if cached, ok := resolvedSecrets.Load(value); ok {
+		return cached.(string), nil
+	}
+
+	secret, err := resolveSecretSource(value)
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", value)
+	}
+	RegisterSecret(secret)
+	resolvedSecrets.Store(value, secret)
+	return secret, nil
+}
+
+// ConfigSecret resolves the secret stored under a config key, returning an
+// empty string when the key is not set
+func ConfigSecret(key string) (string, error) {
+	value := viper.GetString(key)
+	if value == "" {
+		return "", nil
+	}
+	secret, err := ResolveSecret(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", key, err)
+	}
+	return secret, nil
+}
+
+// resolveSecretSource reads a secret from its source
+func resolveSecretSource(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnv):
+		name := strings.TrimPrefix(value, SecretEnv)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFile):
+		data, err := os.ReadFile(expandHome(strings.TrimPrefix(value, SecretFile)))
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, SecretCommand):
+		return runSecretCommand("sh", "-c", strings.TrimPrefix(value, SecretCommand))
+	case strings.HasPrefix(value, SecretKeyring):
+		service, account, ok := strings.Cut(strings.TrimPrefix(value, SecretKeyring), "/")
+		if !ok || service == "" || account == "" {
+			return "", fmt.Errorf("keyring secret must be keyring:service/account")
+		}
+		return keyringLookup(service, account)
+	}
+	return value, nil
+}
+
+// keyringLookup reads a password from the OS keyring: the Secret Service via
+// secret-tool on Linux and the login keychain via security on macOS. The
+// keyring-tool config key replaces secret-tool, e.g. with a stand-in that
+// takes the same arguments.
+func keyringLookup(service, account string) (string, error) {
+	if tool := viper.GetString("keyring-tool"); tool != "" {
+		return runSecretCommand(tool, "lookup", "service", service, "account", account)
+	}
+	if runtime.GOOS == "darwin" {
+		return runSecretCommand("security", "find-generic-password", "-w", "-s", service, "-a", account)
+	}
+	return runSecretCommand("secret-tool", "lookup", "service", service, "account", account)
+}
+
+// runSecretCommand runs a command and returns its output without the trailing newline
+func runSecretCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + "/" + rest
+		}
+	}
+	return path
+}
+
+// MaskSecret hides a secret for display, keeping its last four characters
+// when it is long enough that they give nothing away. Secret sources are not
+// secret and are shown as is.
+func MaskSecret(value string) string {
+	if value == "" || IsSecretSource(value) {
+		return value
+	}
+	if len(value) < 12 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + value[len(value)-4:]
+}
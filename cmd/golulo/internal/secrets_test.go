@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// resolveUncached resolves a secret source, forgetting it afterwards so
+// tests do not see each other's values
+func resolveUncached(t *testing.T, value string) (string, error) {
+	t.Helper()
+	t.Cleanup(func() { resolvedSecrets.Delete(value) })
+	return ResolveSecret(value)
+}
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("file-secret-value\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOLULO_TEST_SECRET", "env-secret-value")
+	t.Setenv("GOLULO_TEST_EMPTY", "")
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "plain-secret-value", want: "plain-secret-value"},
+		{value: "env:GOLULO_TEST_SECRET", want: "env-secret-value"},
+		{value: "env:GOLULO_TEST_MISSING", wantErr: "GOLULO_TEST_MISSING not set"},
+		{value: "env:GOLULO_TEST_EMPTY", wantErr: "is empty"},
+		{value: "file:" + secretFile, want: "file-secret-value"},
+		{value: "file:" + filepath.Join(dir, "missing"), wantErr: "failed to read secret file"},
+		{value: "file:" + emptyFile, wantErr: "is empty"},
+		{value: "cmd:printf 'cmd-secret-value\\n'", want: "cmd-secret-value"},
+		{value: "cmd:echo denied >&2; exit 3", wantErr: "exit status 3: denied"},
+		{value: "keyring:golulo", wantErr: "keyring:service/account"},
+		{value: "keyring:/account", wantErr: "keyring:service/account"},
+	}
+	for _, tt := range tests {
+		got, err := resolveUncached(t, tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ResolveSecret(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveSecret(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSecretCached(t *testing.T) {
+	t.Setenv("GOLULO_TEST_CACHED", "first-secret-value")
+	if got, err := resolveUncached(t, "env:GOLULO_TEST_CACHED"); err != nil || got != "first-secret-value" {
+		t.Fatalf("ResolveSecret = %q, %v", got, err)
+	}
+	t.Setenv("GOLULO_TEST_CACHED", "second-secret-value")
+	if got, err := ResolveSecret("env:GOLULO_TEST_CACHED"); err != nil || got != "first-secret-value" {
+		t.Errorf("ResolveSecret after the variable changed = %q, %v; want the value resolved first", got, err)
+	}
+	if got := RedactSecrets("key first-secret-value"); strings.Contains(got, "first-secret-value") {
+		t.Errorf("resolved secret not registered for redaction: %q", got)
+	}
+}
+
+func TestResolveSecretKeyring(t *testing.T) {
+	// A stand-in for secret-tool that knows one password
+	tool := filepath.Join(t.TempDir(), "keyring")
+	script := `#!/bin/sh
+if [ "$*" = "lookup service golulo account api-key" ]; then
+	echo keyring-secret-value
+	exit 0
+fi
+echo "no such secret: $*" >&2
+exit 1
+`
+	if err := os.WriteFile(tool, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("keyring-tool", tool)
+	t.Cleanup(func() { viper.Set("keyring-tool", "") })
+
+	if got, err := resolveUncached(t, "keyring:golulo/api-key"); err != nil || got != "keyring-secret-value" {
+		t.Errorf("ResolveSecret = %q, %v", got, err)
+	}
+	if _, err := resolveUncached(t, "keyring:golulo/other"); err == nil || !strings.Contains(err.Error(), "no such secret") {
+		t.Errorf("ResolveSecret of a missing entry = %v", err)
+	}
+}
+
+func TestConfigSecret(t *testing.T) {
+	t.Setenv("GOLULO_TEST_CONFIG", "config-secret-value")
+	t.Cleanup(func() {
+		viper.Set("lulo-api-key", "")
+		resolvedSecrets.Delete("env:GOLULO_TEST_CONFIG")
+	})
+
+	if got, err := ConfigSecret("lulo-api-key"); err != nil || got != "" {
+		t.Errorf("ConfigSecret of an unset key = %q, %v", got, err)
+	}
+	viper.Set("lulo-api-key", "env:GOLULO_TEST_CONFIG")
+	if got, err := ConfigSecret("lulo-api-key"); err != nil || got != "config-secret-value" {
+		t.Errorf("ConfigSecret = %q, %v", got, err)
+	}
+	viper.Set("lulo-api-key", "env:GOLULO_TEST_UNSET")
+	if _, err := ConfigSecret("lulo-api-key"); err == nil || !strings.Contains(err.Error(), "failed to resolve lulo-api-key") {
+		t.Errorf("ConfigSecret of a missing variable = %v", err)
+	}
+}
+
+func TestIsSecretSource(t *testing.T) {
+	tests := map[string]bool{
+		"env:LULO_API_KEY":     true,
+		"file:~/.lulo/key":     true,
+		"cmd:pass show lulo":   true,
+		"keyring:golulo/key":   true,
+		"plain-secret-value":   false,
+		"ENV:LULO_API_KEY":     false,
+		"environment:VARIABLE": false,
+		"":                     false,
+	}
+	for value, want := range tests {
+		if got := IsSecretSource(value); got != want {
+			t.Errorf("IsSecretSource(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "short", want: "********"},
+		{value: "elevenchars", want: "********"},
+		{value: "twelve-chars", want: "********hars"},
+		{value: "a-much-longer-api-key-1234", want: "********1234"},
+		{value: "env:LULO_API_KEY", want: "env:LULO_API_KEY"},
+		{value: "keyring:golulo/key", want: "keyring:golulo/key"},
+	}
+	for _, tt := range tests {
+		if got := MaskSecret(tt.value); got != tt.want {
+			t.Errorf("MaskSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	if got := expandHome("~/.lulo/key"); got != home+"/.lulo/key" {
+		t.Errorf("expandHome = %q", got)
+	}
+	if got := expandHome("/etc/lulo/key"); got != "/etc/lulo/key" {
+		t.Errorf("expandHome of an absolute path = %q", got)
+	}
+}
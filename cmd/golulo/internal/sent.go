@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// Sent transaction statuses
+const (
+	SentOK      = "sent"
+	SentUnknown = "unknown" // the send was interrupted and may have reached the network
+	SentBundle  = "bundled" // accepted by the block engine, lands with the rest of its bundle
+)
+
+// SentTransaction is a transaction this process handed to the network
+type SentTransaction struct {
+	Signature solana.Signature
+	Wallet    solana.PublicKey
+	Status    string
+	Bundle    string // Jito bundle ID when sent in a bundle
+	Time      time.Time
+}
+
+// SentLog records the transactions a command sends so they can be reported
+// when it is interrupted. Only the latest are kept, as long-running commands
+// send without end and the latest are the ones in doubt.
+type SentLog struct {
+	mu    sync.Mutex
+	keep  int
+	txs   []SentTransaction // ring of the latest keep transactions
+	next  int               // index in txs of the oldest once it is full
+	total int
+}
+
+// NewSentLog creates a log keeping the latest keep transactions
+func NewSentLog(keep int) *SentLog {
+	if keep < 1 {
+		keep = 1
+	}
+	return &SentLog{keep: keep}
+}
+
+// sentLogKey is the context key of the command's sent log
+type sentLogKey struct{}
+
+// WithSentLog returns a context whose sent transactions are recorded in log
+func WithSentLog(ctx context.Context, log *SentLog) context.Context {
+	return context.WithValue(ctx, sentLogKey{}, log)
+}
+
+// recordSent records a transaction in the sent log carried by ctx, if any
+func recordSent(ctx context.Context, tx SentTransaction) {
+	if log, ok := ctx.Value(sentLogKey{}).(*SentLog); ok && log != nil {
+		log.Record(tx)
+	}
+}
+
+// Record adds a transaction, dropping the oldest kept one when full
+func (l *SentLog) Record(tx SentTransaction) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tx.Time.IsZero() {
+		tx.Time = time.Now()
+	}
+	l.total++
+	if len(l.txs) < l.keep {
+		l.txs = append(l.txs, tx)
+		return
+	}
+	l.txs[l.next] = tx
+	l.next = (l.next + 1) % l.keep
+}
+
+// Transactions returns the kept transactions, oldest first, and how many
+// were sent in total
+func (l *SentLog) Transactions() ([]SentTransaction, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	txs := make([]SentTransaction, 0, len(l.txs))
+	txs = append(txs, l.txs[l.next:]...)
+	txs = append(txs, l.txs[:l.next]...)
+	return txs, l.total
+}
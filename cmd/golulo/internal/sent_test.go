@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+func TestSentLogKeepsLatest(t *testing.T) {
+	log := NewSentLog(3)
+	if txs, total := log.Transactions(); len(txs) != 0 || total != 0 {
+		t.Fatalf("empty log = %v, %d", txs, total)
+	}
+
+	var sigs []solana.Signature
+	for i := 0; i < 7; i++ {
+		sig := solana.Signature{byte(i + 1)}
+		sigs = append(sigs, sig)
+		log.Record(SentTransaction{Signature: sig, Status: SentOK})
+
+		txs, total := log.Transactions()
+		if total != i+1 {
+			t.Fatalf("total = %d after %d sends", total, i+1)
+		}
+		// The latest three, oldest first
+		want := sigs[max(0, len(sigs)-3):]
+		if len(txs) != len(want) {
+			t.Fatalf("kept %d transactions after %d sends, want %d", len(txs), i+1, len(want))
+		}
+		for j, tx := range txs {
+			if tx.Signature != want[j] {
+				t.Errorf("after %d sends, transaction %d = %s, want %s", i+1, j, tx.Signature, want[j])
+			}
+			if tx.Time.IsZero() {
+				t.Errorf("transaction %d recorded without a time", j)
+			}
+		}
+	}
+}
+
+func TestRecordSentWithoutLog(t *testing.T) {
+	// Nothing to record into, which must not fail
+	recordSent(context.Background(), SentTransaction{Status: SentOK})
+
+	log := NewSentLog(0)
+	ctx := WithSentLog(context.Background(), log)
+	recordSent(ctx, SentTransaction{Status: SentOK})
+	recordSent(ctx, SentTransaction{Status: SentUnknown})
+	txs, total := log.Transactions()
+	if total != 2 || len(txs) != 1 || txs[0].Status != SentUnknown {
+		t.Errorf("log = %+v, %d; want the latest of 2 kept", txs, total)
+	}
+}
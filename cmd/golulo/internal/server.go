@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Server exposes golulo as a local HTTP/JSON API. The signing key never
+// leaves the process; deposits and withdrawals are signed one at a time.
+type Server struct {
+	Client *SolanaClient
+	Lulo   *LuloClient
+	Token  string
+	Log    *logrus.Entry
+
+	signing sync.Mutex
+}
+
+// ServerDepositRequest is the body of POST /deposit
+type ServerDepositRequest struct {
+	Mint   string `json:"mint"`
+	Amount string `json:"amount"`
+	Pool   string `json:"pool,omitempty"`
+	DryRun bool   `json:"dryRun,omitempty"`
+}
+
+// ServerWithdrawRequest is the body of POST /withdraw
+type ServerWithdrawRequest struct {
+	Mint   string `json:"mint"`
+	Amount string `json:"amount,omitempty"`
+	All    bool   `json:"all,omitempty"`
+	Pool   string `json:"pool,omitempty"`
+	DryRun bool   `json:"dryRun,omitempty"`
+}
+
+// ServerTransactionResponse is returned by POST /deposit and /withdraw
+type ServerTransactionResponse struct {
+	Mint         string   `json:"mint"`
+	Amount       string   `json:"amount,omitempty"`
+	DryRun       bool     `json:"dryRun"`
+	Transactions []string `json:"transactions,omitempty"` // unsigned, dry run only
+	Signatures   []string `json:"signatures,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi.json", s.method(http.MethodGet, s.handleOpenAPI))
+	mux.HandleFunc("/account", s.authenticated(s.method(http.MethodGet, s.handleAccount)))
+	mux.HandleFunc("/rates", s.authenticated(s.method(http.MethodGet, s.handleRates)))
+	mux.HandleFunc("/balance", s.authenticated(s.method(http.MethodGet, s.handleBalance)))
+	mux.HandleFunc("/deposit", s.authenticated(s.method(http.MethodPost, s.handleDeposit)))
+	mux.HandleFunc("/withdraw", s.authenticated(s.method(http.MethodPost, s.handleWithdraw)))
+	return logRequests(s.Log, mux)
+}
+
+// authenticated rejects requests without the bearer token
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// method rejects requests with any other HTTP method
+func (s *Server) method(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := s.Lulo.GetAccount(r.Context(), s.Client.WalletPubKey())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to get account: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+func (s *Server) handleRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := s.Lulo.GetRates(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to get rates: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	balances, err := s.Client.GetBalances(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to get balances: %w", err))
+		return
+	}
+
+	type balance struct {
+		TokenBalance
+		UIAmount string `json:"uiAmount"`
+	}
+	out := make([]balance, len(balances))
+	for i, b := range balances {
+		out[i] = balance{TokenBalance: b, UIAmount: FormatAmount(b.Amount, b.Decimals)}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleDeposit(w http.ResponseWriter, r *http.Request) {
+	var req ServerDepositRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mint, amount, err := serverAmount(req.Mint, req.Amount, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := ServerTransactionResponse{Mint: mint, Amount: amount, DryRun: req.DryRun}
+	if req.DryRun {
+		txs, err := s.Lulo.GenerateDeposit(r.Context(), DepositRequest{
+			Owner:         s.Client.WalletPubKey().String(),
+			MintAddress:   mint,
+			DepositAmount: amount,
+			Pool:          req.Pool,
+		})
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		resp.Transactions = txs
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	s.signing.Lock()
+	defer s.signing.Unlock()
+	// Keep going if the caller disconnects, a half sent deposit is worse than a wasted response
+	sigs, err := Deposit(context.WithoutCancel(r.Context()), s.Client, s.Lulo, mint, amount, req.Pool)
+	s.writeTransactionResult(w, resp, sigs, err)
+}
+
+func (s *Server) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	var req ServerWithdrawRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	mint, amount, err := serverAmount(req.Mint, req.Amount, req.All)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp := ServerTransactionResponse{Mint: mint, Amount: amount, DryRun: req.DryRun}
+	if req.All {
+		resp.Amount = ""
+	}
+	if req.DryRun {
+		txs, err := s.Lulo.GenerateWithdraw(r.Context(), WithdrawRequest{
+			Owner:          s.Client.WalletPubKey().String(),
+			MintAddress:    mint,
+			WithdrawAmount: amount,
+			WithdrawAll:    req.All,
+			Pool:           req.Pool,
+		})
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		resp.Transactions = txs
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	s.signing.Lock()
+	defer s.signing.Unlock()
+	sigs, err := Withdraw(context.WithoutCancel(r.Context()), s.Client, s.Lulo, mint, amount, req.All, req.Pool)
+	s.writeTransactionResult(w, resp, sigs, err)
+}
+
+// writeTransactionResult reports the signatures sent, including those sent before a failure
+func (s *Server) writeTransactionResult(w http.ResponseWriter, resp ServerTransactionResponse, sigs []solana.Signature, err error) {
+	for _, sig := range sigs {
+		resp.Signatures = append(resp.Signatures, sig.String())
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		writeJSON(w, http.StatusBadGateway, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serverAmount resolves the mint and validates a whole token amount from a request body
+func serverAmount(mintArg, amountArg string, all bool) (string, string, error) {
+	if mintArg == "" {
+		return "", "", fmt.Errorf("mint is required")
+	}
+	mint := ResolveMint(mintArg)
+	if all {
+		if amountArg != "" {
+			return "", "", fmt.Errorf("amount and all are mutually exclusive")
+		}
+		return mint, WithdrawAllAmount, nil
+	}
+
+	amount, err := FloorAmount(amountArg, TokenDecimals(mint))
+	if err != nil {
+		return "", "", fmt.Errorf("amount must be a positive number of tokens")
+	}
+	if amount == "0" {
+		return "", "", fmt.Errorf("amount is below the token's precision")
+	}
+	return mint, amount, nil
+}
+
+func decodeBody(r *http.Request, out interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.WithError(err).Warn("Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// statusRecorder captures the status code for request logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request to log under the caller's X-Request-Id, or
+// a new one
+func logRequests(log *logrus.Entry, next http.Handler) http.Handler {
+	if log == nil {
+		log = standardLogger()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get("X-Request-Id")
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-Id", requestID)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		log.WithFields(logrus.Fields{
+			"requestId": requestID,
+			"method":    r.Method,
+			"path":      r.URL.Path,
+			"status":    recorder.status,
+			"duration":  time.Since(start),
+		}).Info("Handled request")
+	})
+}
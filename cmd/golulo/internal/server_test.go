@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+const serverToken = "server-test-token"
+
+// newTestServer serves the API for a wallet on a dev environment
+func newTestServer(t *testing.T) (*Server, *devEnv, *httptest.Server) {
+	t.Helper()
+	env := newDevEnv(t, LuloAPILegacy)
+	server := &Server{Client: env.client, Lulo: env.lulo, Token: serverToken}
+	srv := httptest.NewServer(server.Handler())
+	t.Cleanup(srv.Close)
+	return server, env, srv
+}
+
+// serverRequest sends a request with the test token and decodes the JSON response
+func serverRequest(t *testing.T, srv *httptest.Server, method, path, body string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+serverToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServerAuthentication(t *testing.T) {
+	_, _, srv := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		want   int
+	}{
+		{name: "no header", method: http.MethodGet, path: "/account", want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, path: "/account", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "not bearer", method: http.MethodGet, path: "/account", header: serverToken, want: http.StatusUnauthorized},
+		{name: "basic auth", method: http.MethodGet, path: "/account", header: "Basic " + serverToken, want: http.StatusUnauthorized},
+		{name: "deposit without token", method: http.MethodPost, path: "/deposit", want: http.StatusUnauthorized},
+		{name: "withdraw without token", method: http.MethodPost, path: "/withdraw", want: http.StatusUnauthorized},
+		{name: "valid token", method: http.MethodGet, path: "/account", header: "Bearer " + serverToken, want: http.StatusOK},
+		{name: "openapi needs no token", method: http.MethodGet, path: "/openapi.json", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(`{"mint":"USDC","amount":"1"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q", resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestServerAmountValidation(t *testing.T) {
+	_, env, srv := newTestServer(t)
+
+	tests := []struct {
+		path string
+		body string
+		want string
+	}{
+		{path: "/deposit", body: `{"amount":"1"}`, want: "mint is required"},
+		{path: "/deposit", body: `{"mint":"USDC"}`, want: "positive number"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":"abc"}`, want: "positive number"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":"-1"}`, want: "positive number"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":"0"}`, want: "precision"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":"0.0000001"}`, want: "precision"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":1}`, want: "invalid request body"},
+		{path: "/deposit", body: `{"mint":"USDC","amount":"1","extra":true}`, want: "invalid request body"},
+		{path: "/withdraw", body: `{"mint":"USDC","amount":"1","all":true}`, want: "mutually exclusive"},
+		{path: "/withdraw", body: `{"mint":"USDC"}`, want: "positive number"},
+	}
+	for _, tt := range tests {
+		var resp map[string]string
+		if status := serverRequest(t, srv, http.MethodPost, tt.path, tt.body, &resp); status != http.StatusBadRequest {
+			t.Errorf("POST %s %s: status = %d, want 400", tt.path, tt.body, status)
+		}
+		if !strings.Contains(resp["error"], tt.want) {
+			t.Errorf("POST %s %s: error = %q, want it to mention %q", tt.path, tt.body, resp["error"], tt.want)
+		}
+	}
+	if got := env.deposited(t, ResolveMint("USDC")); got != 0 {
+		t.Errorf("deposited = %v after rejected requests", got)
+	}
+
+	if status := serverRequest(t, srv, http.MethodGet, "/deposit", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /deposit: status = %d, want 405", status)
+	}
+}
+
+func TestServerDryRunDoesNotSign(t *testing.T) {
+	_, env, srv := newTestServer(t)
+	usdc := ResolveMint("USDC")
+
+	var resp ServerTransactionResponse
+	status := serverRequest(t, srv, http.MethodPost, "/deposit", `{"mint":"USDC","amount":"1.5","dryRun":true}`, &resp)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, response %+v", status, resp)
+	}
+	if !resp.DryRun || resp.Amount != "1.5" || len(resp.Signatures) != 0 || len(resp.Transactions) != 1 {
+		t.Fatalf("response = %+v, want one unsigned transaction", resp)
+	}
+	tx, err := solana.TransactionFromBase64(resp.Transactions[0])
+	if err != nil {
+		t.Fatalf("decode transaction: %v", err)
+	}
+	for _, sig := range tx.Signatures {
+		if !sig.IsZero() {
+			t.Errorf("dry run transaction carries signature %s", sig)
+		}
+	}
+	if got := env.deposited(t, usdc); got != 0 {
+		t.Errorf("deposited = %v after a dry run", got)
+	}
+}
+
+func TestServerDepositWithdraw(t *testing.T) {
+	_, env, srv := newTestServer(t)
+	usdc := ResolveMint("USDC")
+
+	var resp ServerTransactionResponse
+	if status := serverRequest(t, srv, http.MethodPost, "/deposit", `{"mint":"USDC","amount":"25"}`, &resp); status != http.StatusOK {
+		t.Fatalf("deposit status = %d, response %+v", status, resp)
+	}
+	if len(resp.Signatures) != 1 || resp.DryRun {
+		t.Fatalf("deposit response = %+v", resp)
+	}
+	env.confirm(t, []solana.Signature{solana.MustSignatureFromBase58(resp.Signatures[0])})
+	if got := env.deposited(t, usdc); got != 25 {
+		t.Fatalf("deposited = %v, want 25", got)
+	}
+
+	resp = ServerTransactionResponse{}
+	if status := serverRequest(t, srv, http.MethodPost, "/withdraw", `{"mint":"USDC","all":true}`, &resp); status != http.StatusOK {
+		t.Fatalf("withdraw status = %d, response %+v", status, resp)
+	}
+	if resp.Amount != "" || len(resp.Signatures) != 1 {
+		t.Fatalf("withdraw response = %+v", resp)
+	}
+	env.confirm(t, []solana.Signature{solana.MustSignatureFromBase58(resp.Signatures[0])})
+	if got := env.deposited(t, usdc); got != 0 {
+		t.Fatalf("deposited after withdrawing all = %v, want 0", got)
+	}
+}
+
+func TestServerSerializesSigning(t *testing.T) {
+	server, _, srv := newTestServer(t)
+
+	// Hold the signing lock as an in-flight deposit would
+	server.signing.Lock()
+	done := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/deposit", strings.NewReader(`{"mint":"USDC","amount":"1"}`))
+		req.Header.Set("Authorization", "Bearer "+serverToken)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	select {
+	case status := <-done:
+		server.signing.Unlock()
+		t.Fatalf("deposit finished with status %d while another was signing", status)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Reads and dry runs do not wait for signing
+	if status := serverRequest(t, srv, http.MethodPost, "/deposit", `{"mint":"USDC","amount":"1","dryRun":true}`, nil); status != http.StatusOK {
+		t.Errorf("dry run status = %d while signing", status)
+	}
+	if status := serverRequest(t, srv, http.MethodGet, "/account", "", nil); status != http.StatusOK {
+		t.Errorf("account status = %d while signing", status)
+	}
+
+	server.signing.Unlock()
+	select {
+	case status := <-done:
+		if status != http.StatusOK {
+			t.Errorf("deposit status = %d after signing was released", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("deposit still blocked after signing was released")
+	}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// AccountSnapshot records the Lulo account value at a point in time
+type AccountSnapshot struct {
+	Time           time.Time `json:"time"`
+	TotalValue     float64   `json:"totalValue"`
+	InterestEarned float64   `json:"interestEarned"`
+	RealtimeAPY    float64   `json:"realtimeAPY"`
+}
+
+// LoadSnapshots reads the recorded account snapshots of a wallet
+func LoadSnapshots(wallet solana.PublicKey) ([]AccountSnapshot, error) {
+	path, err := cacheFile("snapshots", wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+
+	var snapshots []AccountSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshots %s: %w", path, err)
+	}
+	return snapshots, nil
+}
+
+// RecordSnapshot appends a snapshot of the account to the wallet's snapshot file
+func RecordSnapshot(wallet solana.PublicKey, account *Account, at time.Time) ([]AccountSnapshot, error) {
+	snapshots, err := LoadSnapshots(wallet)
+	if err != nil {
+		return nil, err
+	}
+	snapshots = append(snapshots, AccountSnapshot{
+		Time:           at.UTC(),
+		TotalValue:     account.TotalValue,
+		InterestEarned: account.InterestEarned,
+		RealtimeAPY:    account.RealtimeAPY,
+	})
+
+	path, err := cacheFile("snapshots", wallet)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(snapshots, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshots: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write snapshots: %w", err)
+	}
+	return snapshots, nil
+}
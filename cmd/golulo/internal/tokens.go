@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// TokenInfo describes a token known to the CLI
+type TokenInfo struct {
+	Symbol      string `json:"symbol"`
+	Mint        string `json:"mint"`
+	Decimals    uint8  `json:"decimals"`
+	Stable      bool   `json:"stable,omitempty"`
+	CoingeckoID string `json:"coingeckoId,omitempty"`
+}
+
+// NativeSOL is the registry entry for native SOL, keyed by the wrapped SOL mint
+var NativeSOL = TokenInfo{Symbol: "SOL", Mint: solana.SolMint.String(), Decimals: 9, CoingeckoID: "solana"}
+
+// tokenRegistry lists tokens commonly used with Lulo
+var tokenRegistry = []TokenInfo{
+	NativeSOL,
+	{Symbol: "USDC", Mint: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Decimals: 6, Stable: true, CoingeckoID: "usd-coin"},
+	{Symbol: "USDT", Mint: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", Decimals: 6, Stable: true, CoingeckoID: "tether"},
+	{Symbol: "PYUSD", Mint: "2b1kV6DkPAnxd5ixfnxCpjxmKwqjjaYmCZfHsFu24GXo", Decimals: 6, Stable: true, CoingeckoID: "paypal-usd"},
+	{Symbol: "mSOL", Mint: "mSoLzYCxHdYgdzU16g5QSh3i5K3z3KZK7ytfqcJm7So", Decimals: 9, CoingeckoID: "msol"},
+	{Symbol: "JitoSOL", Mint: "J1toso1uCk3RLmjorhTtrVwY9HJ7X8V9yYac6Y7kGCPn", Decimals: 9, CoingeckoID: "jito-staked-sol"},
+	{Symbol: "bSOL", Mint: "bSo13r4TkiE4KumL71LsHTjpL2euBYLFx6h9HP3piy1", Decimals: 9, CoingeckoID: "blazestake-staked-sol"},
+}
+
+// LookupToken finds a token by symbol (case-insensitive) or mint address
+func LookupToken(token string) (TokenInfo, bool) {
+	for _, info := range tokenRegistry {
+		if info.Mint == token || strings.EqualFold(info.Symbol, token) {
+			return info, true
+		}
+	}
+	return TokenInfo{}, false
+}
+
+// ResolveMint returns the mint address for a symbol or mint address.
+// Unknown symbols are returned unchanged so raw mint addresses keep working.
+func ResolveMint(token string) string {
+	if info, ok := LookupToken(token); ok {
+		return info.Mint
+	}
+	return token
+}
+
+// TokenSymbol returns the registry symbol for a mint, or a shortened mint address
+func TokenSymbol(mint string) string {
+	if info, ok := LookupToken(mint); ok {
+		return info.Symbol
+	}
+	if len(mint) > 8 {
+		return mint[:4] + "…" + mint[len(mint)-4:]
+	}
+	return mint
+}
+
+// FormatAmount converts a raw token amount into a decimal string
+func FormatAmount(raw uint64, decimals uint8) string {
+	if decimals == 0 {
+		return strconv.FormatUint(raw, 10)
+	}
+	unit := uint64(math.Pow10(int(decimals)))
+	frac := strings.TrimRight(fmt.Sprintf("%0*d", decimals, raw%unit), "0")
+	if frac == "" {
+		return strconv.FormatUint(raw/unit, 10)
+	}
+	return fmt.Sprintf("%d.%s", raw/unit, frac)
+}
+
+// UIAmount converts a raw token amount into a float
+func UIAmount(raw uint64, decimals uint8) float64 {
+	return float64(raw) / math.Pow10(int(decimals))
+}
+
+// parseDecimal splits a non-negative decimal string such as "1.005" into its
+// digits and the number of them after the point, so amounts stay exact
+func parseDecimal(amount string) (*big.Int, int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(amount), ".")
+	digits := whole + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return nil, 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	return value, len(frac), nil
+}
+
+// ParseDecimal parses a non-negative decimal string exactly, with no bound
+// on its size or precision
+func ParseDecimal(amount string) (*big.Rat, error) {
+	value, scale, err := parseDecimal(amount)
+	if err != nil {
+		return nil, err
+	}
+	denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	return new(big.Rat).SetFrac(value, denom), nil
+}
+
+// scaleDown divides value by 10^scale, rounding down, and checks it fits in a uint64
+func scaleDown(value *big.Int, scale int, amount string) (uint64, error) {
+	value = new(big.Int).Quo(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	if !value.IsUint64() {
+		return 0, fmt.Errorf("amount %q is too large", amount)
+	}
+	return value.Uint64(), nil
+}
+
+// ToBaseUnits converts a decimal token amount into raw base units. Digits
+// beyond the token's decimals are dropped so we never request more than was asked for.
+func ToBaseUnits(amount string, decimals uint8) (uint64, error) {
+	value, scale, err := parseDecimal(amount)
+	if err != nil {
+		return 0, err
+	}
+	value.Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	return scaleDown(value, scale, amount)
+}
+
+// FloorAmount rounds a decimal token amount down to the token's decimals
+func FloorAmount(amount string, decimals uint8) (string, error) {
+	raw, err := ToBaseUnits(amount, decimals)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(raw, decimals), nil
+}
+
+// PercentOf returns a decimal percentage of a raw amount, rounded down
+func PercentOf(raw uint64, percent string) (uint64, error) {
+	value, scale, err := parseDecimal(percent)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage %q", percent)
+	}
+	value.Mul(value, new(big.Int).SetUint64(raw))
+	return scaleDown(value.Quo(value, big.NewInt(100)), scale, percent)
+}
+
+// FloatAmount formats an amount that only exists as a float, such as one the
+// Lulo API reported, as the shortest decimal that reads back as the same float.
+// Parsing that string avoids the binary error of scaling the float itself.
+func FloatAmount(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// TokenDecimals returns the registry decimals of a mint, defaulting to 9 for unknown tokens
+func TokenDecimals(mint string) uint8 {
+	if info, ok := LookupToken(mint); ok {
+		return info.Decimals
+	}
+	return 9
+}
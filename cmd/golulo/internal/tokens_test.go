@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToBaseUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     uint64
+		wantErr  bool
+	}{
+		{amount: "1.005", decimals: 6, want: 1_005_000},
+		{amount: "100", decimals: 6, want: 100_000_000},
+		{amount: "0.000001", decimals: 6, want: 1},
+		{amount: "0.0000009", decimals: 6, want: 0},
+		{amount: ".5", decimals: 9, want: 500_000_000},
+		{amount: "5.", decimals: 0, want: 5},
+		{amount: " 2.5 ", decimals: 1, want: 25},
+		{amount: "1.123456789", decimals: 9, want: 1_123_456_789},
+		{amount: "1.1234567899", decimals: 9, want: 1_123_456_789},
+		{amount: "18446744073709.551615", decimals: 6, want: math.MaxUint64},
+		{amount: "18446744073709.551616", decimals: 6, wantErr: true},
+		{amount: "", decimals: 6, wantErr: true},
+		{amount: ".", decimals: 6, wantErr: true},
+		{amount: "-1", decimals: 6, wantErr: true},
+		{amount: "1e3", decimals: 6, wantErr: true},
+		{amount: "1/3", decimals: 6, wantErr: true},
+		{amount: "1.2.3", decimals: 6, wantErr: true},
+		{amount: "NaN", decimals: 6, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ToBaseUnits(tt.amount, tt.decimals)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ToBaseUnits(%q, %d) error = %v, wantErr %v", tt.amount, tt.decimals, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ToBaseUnits(%q, %d) = %d, want %d", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestFloorAmount(t *testing.T) {
+	// Added at run time, constant arithmetic would be exact
+	tenth, fifth := 0.1, 0.2
+	tests := []struct {
+		amount   string
+		decimals uint8
+		want     string
+	}{
+		{amount: "1.005", decimals: 6, want: "1.005"},
+		{amount: FloatAmount(tenth + fifth), decimals: 6, want: "0.3"},
+		{amount: FloatAmount(tenth + fifth), decimals: 18, want: "0.30000000000000004"},
+		{amount: FloatAmount(1.005), decimals: 6, want: "1.005"},
+		{amount: "0.123456789123", decimals: 9, want: "0.123456789"},
+		{amount: "2.999999999", decimals: 6, want: "2.999999"},
+		{amount: "007.500", decimals: 6, want: "7.5"},
+		{amount: "0.0000001", decimals: 6, want: "0"},
+		{amount: "42", decimals: 0, want: "42"},
+	}
+	for _, tt := range tests {
+		got, err := FloorAmount(tt.amount, tt.decimals)
+		if err != nil {
+			t.Errorf("FloorAmount(%q, %d): %v", tt.amount, tt.decimals, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FloorAmount(%q, %d) = %s, want %s", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		raw     uint64
+		percent string
+		want    uint64
+		wantErr bool
+	}{
+		{raw: 1_005_000, percent: "50", want: 502_500},
+		{raw: 1_005_000, percent: "100", want: 1_005_000},
+		{raw: 3, percent: "33.3", want: 0},
+		{raw: 1_000_000, percent: "33.3333", want: 333_333},
+		{raw: 10, percent: "0.5", want: 0},
+		{raw: math.MaxUint64, percent: "100", want: math.MaxUint64},
+		{raw: 100, percent: "-5", wantErr: true},
+		{raw: 100, percent: "half", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := PercentOf(tt.raw, tt.percent)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("PercentOf(%d, %q) error = %v, wantErr %v", tt.raw, tt.percent, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("PercentOf(%d, %q) = %d, want %d", tt.raw, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		amount  string
+		want    string
+		wantErr bool
+	}{
+		{amount: "100", want: "100/1"},
+		{amount: "0.25", want: "1/4"},
+		{amount: "100000000000000000000000", want: "100000000000000000000000/1"},
+		{amount: "0.000000000000000000001", want: "1/1000000000000000000000"},
+		{amount: "0", want: "0/1"},
+		{amount: "1.", want: "1/1"},
+		{amount: "-1", wantErr: true},
+		{amount: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.amount)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDecimal(%q) error = %v, wantErr %v", tt.amount, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		raw      uint64
+		decimals uint8
+		want     string
+	}{
+		{raw: 1_005_000, decimals: 6, want: "1.005"},
+		{raw: 1, decimals: 9, want: "0.000000001"},
+		{raw: 0, decimals: 6, want: "0"},
+		{raw: 7, decimals: 0, want: "7"},
+		{raw: math.MaxUint64, decimals: 6, want: "18446744073709.551615"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.raw, tt.decimals); got != tt.want {
+			t.Errorf("FormatAmount(%d, %d) = %s, want %s", tt.raw, tt.decimals, got, tt.want)
+		}
+		// Formatting and parsing back is lossless
+		if back, err := ToBaseUnits(FormatAmount(tt.raw, tt.decimals), tt.decimals); err != nil || back != tt.raw {
+			t.Errorf("ToBaseUnits(FormatAmount(%d, %d)) = %d, %v", tt.raw, tt.decimals, back, err)
+		}
+	}
+}
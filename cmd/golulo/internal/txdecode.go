@@ -0,0 +1,726 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	addresslookuptable "github.com/gagliardetto/solana-go/programs/address-lookup-table"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// DecodedTransaction is a transaction with its accounts resolved and its
+// instructions decoded for display
+type DecodedTransaction struct {
+	Signature    string               `json:"signature,omitempty"` // empty until signed
+	Version      string               `json:"version"`
+	FeePayer     string               `json:"feePayer"`
+	Blockhash    string               `json:"recentBlockhash"`
+	Accounts     []DecodedAccount     `json:"accounts"`
+	LookupTables []DecodedLookupTable `json:"lookupTables,omitempty"`
+	Instructions []DecodedInstruction `json:"instructions"`
+
+	// Outcome, when the transaction was fetched from the chain or simulated
+	Slot          uint64   `json:"slot,omitempty"`
+	Status        string   `json:"status,omitempty"` // "success", or why it failed
+	Fee           *uint64  `json:"fee,omitempty"`
+	UnitsConsumed *uint64  `json:"unitsConsumed,omitempty"`
+	Logs          []string `json:"logs,omitempty"`
+}
+
+// DecodedAccount is an account of a transaction, in message order
+type DecodedAccount struct {
+	Address     string `json:"address"` // empty when its lookup table was not resolved
+	Signer      bool   `json:"signer"`
+	Writable    bool   `json:"writable"`
+	LookupTable string `json:"lookupTable,omitempty"` // table the address was loaded from
+	Label       string `json:"label,omitempty"`
+}
+
+// DecodedLookupTable is an address lookup table used by a transaction
+type DecodedLookupTable struct {
+	Address  string `json:"address"`
+	Writable int    `json:"writable"`
+	Readonly int    `json:"readonly"`
+}
+
+// DecodedInstruction is an instruction with its program and, when the
+// program is known, its name and arguments
+type DecodedInstruction struct {
+	ProgramID string               `json:"programId"`
+	Program   string               `json:"program"` // display name, or the program ID
+	Name      string               `json:"name,omitempty"`
+	Args      []DecodedArg         `json:"args,omitempty"`
+	Accounts  []InstructionAccount `json:"accounts"`
+	Data      string               `json:"data,omitempty"`    // hex, when the data was not decoded
+	Invoked   []string             `json:"invoked,omitempty"` // programs it called, from logs
+}
+
+// DecodedArg is a named instruction argument
+type DecodedArg struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// InstructionAccount is an account passed to an instruction
+type InstructionAccount struct {
+	Index int    `json:"index"` // into the transaction's accounts
+	Role  string `json:"role,omitempty"`
+}
+
+// ResolveLookupTables fetches the address lookup tables a transaction uses and
+// returns the addresses it loads from them, writable ones first as the runtime
+// orders them
+func ResolveLookupTables(ctx context.Context, client RPC, tx *solana.Transaction) (*rpc.LoadedAddresses, error) {
+	tables := map[solana.PublicKey]solana.PublicKeySlice{}
+	for _, lookup := range tx.Message.AddressTableLookups {
+		if _, ok := tables[lookup.AccountKey]; ok {
+			continue
+		}
+		out, err := client.GetAccountInfoWithOpts(ctx, lookup.AccountKey, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get address lookup table %s: %w", lookup.AccountKey, err)
+		}
+		state, err := addresslookuptable.DecodeAddressLookupTableState(out.GetBinary())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode address lookup table %s: %w", lookup.AccountKey, err)
+		}
+		tables[lookup.AccountKey] = state.Addresses
+	}
+
+	loaded := &rpc.LoadedAddresses{}
+	load := func(key solana.PublicKey, indexes []uint8, into *solana.PublicKeySlice) error {
+		table := tables[key]
+		for _, i := range indexes {
+			if int(i) >= len(table) {
+				return fmt.Errorf("address lookup table %s has no index %d", key, i)
+			}
+			*into = append(*into, table[i])
+		}
+		return nil
+	}
+	for _, lookup := range tx.Message.AddressTableLookups {
+		if err := load(lookup.AccountKey, lookup.WritableIndexes, &loaded.Writable); err != nil {
+			return nil, err
+		}
+	}
+	for _, lookup := range tx.Message.AddressTableLookups {
+		if err := load(lookup.AccountKey, lookup.ReadonlyIndexes, &loaded.ReadOnly); err != nil {
+			return nil, err
+		}
+	}
+	return loaded, nil
+}
+
+// DecodeTransaction decodes a transaction for display. loaded holds the
+// addresses from its lookup tables; when nil they are left unresolved.
+// Accounts of wallet are labelled as the wallet's.
+func DecodeTransaction(tx *solana.Transaction, loaded *rpc.LoadedAddresses, wallet solana.PublicKey) *DecodedTransaction {
+	msg := tx.Message
+	decoded := &DecodedTransaction{
+		Version:   "legacy",
+		Blockhash: msg.RecentBlockhash.String(),
+	}
+	if msg.IsVersioned() {
+		decoded.Version = "v0"
+	}
+	if len(tx.Signatures) > 0 && !tx.Signatures[0].IsZero() {
+		decoded.Signature = tx.Signatures[0].String()
+	}
+
+	labels := accountLabels(wallet)
+	add := func(key solana.PublicKey, signer, writable bool, table string) {
+		account := DecodedAccount{Signer: signer, Writable: writable, LookupTable: table}
+		if !key.IsZero() || table == "" {
+			account.Address = key.String()
+			account.Label = labels.label(key)
+		}
+		decoded.Accounts = append(decoded.Accounts, account)
+	}
+
+	// Static accounts are ordered signers first, and writable before readonly
+	// within signers and non-signers
+	static := msg.AccountKeys
+	lookups := 0
+	for _, lookup := range msg.AddressTableLookups {
+		lookups += len(lookup.WritableIndexes) + len(lookup.ReadonlyIndexes)
+	}
+	if msg.IsResolved() && lookups <= len(static) {
+		static = static[:len(static)-lookups]
+	}
+	signers := int(msg.Header.NumRequiredSignatures)
+	for i, key := range static {
+		signer := i < signers
+		writable := i < signers-int(msg.Header.NumReadonlySignedAccounts)
+		if !signer {
+			writable = i < len(static)-int(msg.Header.NumReadonlyUnsignedAccounts)
+		}
+		add(key, signer, writable, "")
+	}
+
+	// Then the writable and the readonly addresses of every lookup table
+	var addresses solana.PublicKeySlice
+	if loaded != nil && len(loaded.Writable)+len(loaded.ReadOnly) == lookups {
+		addresses = append(append(addresses, loaded.Writable...), loaded.ReadOnly...)
+	}
+	next := 0
+	for _, writable := range []bool{true, false} {
+		for _, lookup := range msg.AddressTableLookups {
+			indexes := lookup.ReadonlyIndexes
+			if writable {
+				indexes = lookup.WritableIndexes
+			}
+			for range indexes {
+				var key solana.PublicKey
+				if addresses != nil {
+					key = addresses[next]
+				}
+				next++
+				add(key, false, writable, lookup.AccountKey.String())
+			}
+		}
+	}
+	for _, lookup := range msg.AddressTableLookups {
+		decoded.LookupTables = append(decoded.LookupTables, DecodedLookupTable{
+			Address:  lookup.AccountKey.String(),
+			Writable: len(lookup.WritableIndexes),
+			Readonly: len(lookup.ReadonlyIndexes),
+		})
+	}
+	if len(decoded.Accounts) > 0 {
+		decoded.FeePayer = decoded.Accounts[0].Address
+	}
+
+	for _, compiled := range msg.Instructions {
+		decoded.Instructions = append(decoded.Instructions, decoded.decodeInstruction(compiled))
+	}
+	return decoded
+}
+
+// decodeInstruction decodes an instruction with the parser of its program
+func (d *DecodedTransaction) decodeInstruction(compiled solana.CompiledInstruction) DecodedInstruction {
+	address := func(index uint16) solana.PublicKey {
+		if int(index) >= len(d.Accounts) || d.Accounts[index].Address == "" {
+			return solana.PublicKey{}
+		}
+		key, _ := solana.PublicKeyFromBase58(d.Accounts[index].Address)
+		return key
+	}
+
+	programID := address(compiled.ProgramIDIndex)
+	inst := DecodedInstruction{ProgramID: programID.String(), Program: programID.String()}
+	if name, ok := ProgramName(programID); ok {
+		inst.Program = name
+	}
+	keys := make([]solana.PublicKey, len(compiled.Accounts))
+	for i, index := range compiled.Accounts {
+		keys[i] = address(index)
+		inst.Accounts = append(inst.Accounts, InstructionAccount{Index: int(index)})
+	}
+
+	parse, ok := instructionParsers[programID]
+	if !ok || !parse(&inst, keys, compiled.Data) {
+		inst.Data = hex.EncodeToString(compiled.Data)
+	}
+	return inst
+}
+
+// instructionParser fills in the name, arguments and account roles of an
+// instruction, reporting whether its data was understood
+type instructionParser func(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool
+
+var instructionParsers = map[solana.PublicKey]instructionParser{
+	solana.SystemProgramID:                    parseSystemInstruction,
+	solana.TokenProgramID:                     parseTokenInstruction,
+	solana.Token2022ProgramID:                 parseTokenInstruction,
+	solana.SPLAssociatedTokenAccountProgramID: parseAssociatedTokenInstruction,
+	solana.ComputeBudget:                      parseComputeBudgetInstruction,
+	solana.MemoProgramID:                      parseMemoInstruction,
+	LuloProgramID:                             parseLuloInstruction,
+}
+
+// setRoles names the accounts of an instruction in order
+func (inst *DecodedInstruction) setRoles(roles ...string) {
+	for i := range inst.Accounts {
+		if i < len(roles) {
+			inst.Accounts[i].Role = roles[i]
+		}
+	}
+}
+
+// arg appends an argument
+func (inst *DecodedInstruction) arg(name, value string) {
+	inst.Args = append(inst.Args, DecodedArg{Name: name, Value: value})
+}
+
+func parseSystemInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	var decoded system.Instruction
+	if err := bin.NewBinDecoder(data).Decode(&decoded); err != nil {
+		return false
+	}
+	inst.Name = system.InstructionIDToName(decoded.TypeID.Uint32())
+	switch impl := decoded.Impl.(type) {
+	case *system.Transfer:
+		inst.arg("amount", formatLamports(impl.Lamports))
+		inst.setRoles("from", "to")
+	case *system.CreateAccount:
+		inst.arg("amount", formatLamports(impl.Lamports))
+		inst.arg("space", formatUint(impl.Space))
+		inst.arg("owner", formatProgram(impl.Owner))
+		inst.setRoles("funder", "new account")
+	case *system.Assign:
+		inst.arg("owner", formatProgram(impl.Owner))
+		inst.setRoles("account")
+	case *system.Allocate:
+		inst.arg("space", formatUint(impl.Space))
+		inst.setRoles("account")
+	}
+	return true
+}
+
+func parseTokenInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	var decoded token.Instruction
+	if err := bin.NewBinDecoder(data).Decode(&decoded); err != nil {
+		return false
+	}
+	inst.Name = token.InstructionIDToName(decoded.TypeID.Uint8())
+	switch impl := decoded.Impl.(type) {
+	case *token.Transfer:
+		inst.arg("amount", formatUint(impl.Amount)+" base units")
+		inst.setRoles("source", "destination", "owner")
+	case *token.TransferChecked:
+		mint := solana.PublicKey{}
+		if len(accounts) > 1 {
+			mint = accounts[1]
+		}
+		inst.arg("amount", formatTokenAmount(impl.Amount, impl.Decimals, mint))
+		inst.setRoles("source", "mint", "destination", "owner")
+	case *token.Approve:
+		inst.arg("amount", formatUint(impl.Amount)+" base units")
+		inst.setRoles("source", "delegate", "owner")
+	case *token.Revoke:
+		inst.setRoles("source", "owner")
+	case *token.CloseAccount:
+		inst.setRoles("account", "destination", "owner")
+	case *token.SyncNative:
+		inst.setRoles("account")
+	case *token.InitializeAccount:
+		inst.setRoles("account", "mint", "owner", "rent sysvar")
+	case *token.InitializeAccount3:
+		inst.arg("owner", formatAddress(impl.Owner))
+		inst.setRoles("account", "mint")
+	}
+	return true
+}
+
+func parseAssociatedTokenInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	switch {
+	case len(data) == 0 || (len(data) == 1 && data[0] == 0):
+		inst.Name = "Create"
+	case len(data) == 1 && data[0] == 1:
+		inst.Name = "CreateIdempotent"
+	case len(data) == 1 && data[0] == 2:
+		inst.Name = "RecoverNested"
+		inst.setRoles("nested account", "nested mint", "destination", "owner account", "owner mint", "wallet", "token program")
+		return true
+	default:
+		return false
+	}
+	inst.setRoles("payer", "associated account", "wallet", "mint", "system program", "token program")
+	return true
+}
+
+func parseComputeBudgetInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	var decoded computebudget.Instruction
+	if err := bin.NewBinDecoder(data).Decode(&decoded); err != nil {
+		return false
+	}
+	inst.Name = computebudget.InstructionIDToName(decoded.TypeID.Uint8())
+	switch impl := decoded.Impl.(type) {
+	case *computebudget.SetComputeUnitLimit:
+		inst.arg("units", strconv.FormatUint(uint64(impl.Units), 10))
+	case *computebudget.SetComputeUnitPrice:
+		inst.arg("price", strconv.FormatUint(impl.MicroLamports, 10)+" micro-lamports per unit")
+	case *computebudget.RequestHeapFrame:
+		inst.arg("bytes", strconv.FormatUint(uint64(impl.HeapSize), 10))
+	}
+	return true
+}
+
+func parseMemoInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	inst.Name = "Memo"
+	inst.arg("text", strconv.Quote(string(data)))
+	return true
+}
+
+// luloInstructionNames are the instructions the Lulo program is known to log.
+// Its IDL is not published, so they are matched by their Anchor discriminator,
+// which cannot match under a wrong name; unknown ones keep their raw data.
+var luloInstructionNames = []string{
+	"Deposit", "Withdraw",
+	"DepositProtected", "WithdrawProtected",
+	"DepositBoosted", "WithdrawBoosted",
+	"InitiateRegularWithdraw", "CompleteRegularWithdraw",
+	"InitializeUser", "UpdateUserSettings",
+}
+
+// luloDiscriminators maps the Anchor discriminator of each Lulo instruction,
+// the first 8 bytes of sha256("global:<snake_case name>"), to its name
+var luloDiscriminators = func() map[[8]byte]string {
+	discriminators := map[[8]byte]string{}
+	for _, name := range luloInstructionNames {
+		discriminators[anchorDiscriminator(name)] = name
+	}
+	return discriminators
+}()
+
+// anchorDiscriminator returns the discriminator Anchor prefixes the data of
+// an instruction with, from its name as the program logs it, e.g. "DepositProtected"
+func anchorDiscriminator(name string) [8]byte {
+	var snake strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			snake.WriteByte('_')
+		}
+		snake.WriteRune(unicode.ToLower(r))
+	}
+	var discriminator [8]byte
+	sum := sha256.Sum256([]byte("global:" + snake.String()))
+	copy(discriminator[:], sum[:8])
+	return discriminator
+}
+
+// parseLuloInstruction names a Lulo instruction from its discriminator. The
+// account layout is not published either, so accounts are given roles by what
+// they are rather than by position, and the arguments are left as raw data.
+func parseLuloInstruction(inst *DecodedInstruction, accounts []solana.PublicKey, data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	name, ok := luloDiscriminators[[8]byte(data[:8])]
+	if !ok {
+		return false
+	}
+	inst.Name = name
+	if len(data) > 8 {
+		inst.arg("data", hex.EncodeToString(data[8:]))
+	}
+	for i, key := range accounts {
+		if i < len(inst.Accounts) {
+			inst.Accounts[i].Role = luloAccountRole(key)
+		}
+	}
+	return true
+}
+
+// luloAccountRole names an account passed to Lulo when it is a token mint, a
+// program or a sysvar
+func luloAccountRole(key solana.PublicKey) string {
+	if key.IsZero() {
+		// Not resolved from its lookup table
+		return ""
+	}
+	if _, ok := LookupToken(key.String()); ok {
+		return "mint"
+	}
+	if name, ok := ProgramName(key); ok {
+		return name + " program"
+	}
+	switch key {
+	case solana.SysVarRentPubkey:
+		return "rent sysvar"
+	case solana.SysVarClockPubkey:
+		return "clock sysvar"
+	case solana.SysVarInstructionsPubkey:
+		return "instructions sysvar"
+	}
+	return ""
+}
+
+func formatUint(v *uint64) string {
+	if v == nil {
+		return "?"
+	}
+	return strconv.FormatUint(*v, 10)
+}
+
+func formatLamports(lamports *uint64) string {
+	if lamports == nil {
+		return "?"
+	}
+	return FormatAmount(*lamports, NativeSOL.Decimals) + " SOL"
+}
+
+func formatTokenAmount(amount *uint64, decimals *uint8, mint solana.PublicKey) string {
+	if amount == nil || decimals == nil {
+		return "?"
+	}
+	formatted := FormatAmount(*amount, *decimals)
+	if mint.IsZero() {
+		return formatted
+	}
+	return formatted + " " + TokenSymbol(mint.String())
+}
+
+func formatAddress(key *solana.PublicKey) string {
+	if key == nil {
+		return "?"
+	}
+	return key.String()
+}
+
+func formatProgram(key *solana.PublicKey) string {
+	if key == nil {
+		return "?"
+	}
+	if name, ok := ProgramName(*key); ok {
+		return name
+	}
+	return key.String()
+}
+
+// accountLabeller names well-known accounts: the wallet and its token
+// accounts, programs, token mints and sysvars
+type accountLabeller map[solana.PublicKey]string
+
+func accountLabels(wallet solana.PublicKey) accountLabeller {
+	labels := accountLabeller{
+		solana.SysVarRentPubkey:         "Rent sysvar",
+		solana.SysVarClockPubkey:        "Clock sysvar",
+		solana.SysVarInstructionsPubkey: "Instructions sysvar",
+	}
+	for _, info := range tokenRegistry {
+		mint := solana.MustPublicKeyFromBase58(info.Mint)
+		labels[mint] = info.Symbol + " mint"
+		if wallet.IsZero() {
+			continue
+		}
+		if ata, _, err := solana.FindAssociatedTokenAddress(wallet, mint); err == nil {
+			labels[ata] = "wallet " + info.Symbol + " account"
+		}
+	}
+	if !wallet.IsZero() {
+		labels[wallet] = "wallet"
+	}
+	return labels
+}
+
+func (l accountLabeller) label(key solana.PublicKey) string {
+	if label, ok := l[key]; ok {
+		return label
+	}
+	if name, ok := ProgramName(key); ok {
+		return name + " program"
+	}
+	return ""
+}
+
+// ApplyLogs adds what the program logs of an executed or simulated
+// transaction tell about its instructions: the names Anchor programs such as
+// Lulo log, and the programs each instruction invoked
+func (d *DecodedTransaction) ApplyLogs(logs []string) {
+	d.Logs = logs
+	index, depth := -1, 0
+	for _, line := range logs {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 4 && fields[0] == "Program" && fields[2] == "invoke":
+			depth, _ = strconv.Atoi(strings.Trim(fields[3], "[]"))
+			if depth == 1 {
+				index++
+				continue
+			}
+			if index < 0 || index >= len(d.Instructions) {
+				continue
+			}
+			program := fields[1]
+			if key, err := solana.PublicKeyFromBase58(program); err == nil {
+				if name, ok := ProgramName(key); ok {
+					program = name
+				}
+			}
+			inst := &d.Instructions[index]
+			if !containsString(inst.Invoked, program) {
+				inst.Invoked = append(inst.Invoked, program)
+			}
+		case len(fields) >= 3 && fields[0] == "Program" && (fields[2] == "success" || fields[2] == "failed:"):
+			depth--
+		case depth == 1 && strings.HasPrefix(line, "Program log: Instruction: "):
+			if index >= 0 && index < len(d.Instructions) && d.Instructions[index].Name == "" {
+				d.Instructions[index].Name = strings.TrimPrefix(line, "Program log: Instruction: ")
+			}
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Title is the program and name of an instruction, e.g. "System: Transfer"
+func (inst DecodedInstruction) Title() string {
+	if inst.Name == "" {
+		return inst.Program
+	}
+	return inst.Program + ": " + inst.Name
+}
+
+// Summary lists the instructions of a transaction on one line
+func (d *DecodedTransaction) Summary() string {
+	titles := make([]string, len(d.Instructions))
+	for i, inst := range d.Instructions {
+		titles[i] = inst.Title()
+	}
+	return strings.Join(titles, ", ")
+}
+
+// WritableAccounts returns how many accounts the transaction can modify
+func (d *DecodedTransaction) WritableAccounts() int {
+	n := 0
+	for _, account := range d.Accounts {
+		if account.Writable {
+			n++
+		}
+	}
+	return n
+}
+
+// describe formats an account with its flags and label
+func (d *DecodedTransaction) describe(index int) string {
+	if index >= len(d.Accounts) {
+		return fmt.Sprintf("#%d (missing)", index)
+	}
+	account := d.Accounts[index]
+	address := account.Address
+	if address == "" {
+		address = "(unresolved)"
+	}
+
+	var flags []string
+	if account.Signer {
+		flags = append(flags, "signer")
+	}
+	if account.Writable {
+		flags = append(flags, "writable")
+	} else {
+		flags = append(flags, "readonly")
+	}
+	s := fmt.Sprintf("#%d %s [%s]", index, address, strings.Join(flags, ", "))
+	if account.Label != "" {
+		s += " " + account.Label
+	}
+	if account.LookupTable != "" {
+		s += " via lookup table " + shortAddress(account.LookupTable)
+	}
+	return s
+}
+
+// shortAddress abbreviates an address for display
+func shortAddress(address string) string {
+	if len(address) <= 8 {
+		return address
+	}
+	return address[:4] + "…" + address[len(address)-4:]
+}
+
+// treeNode is a line of a printed tree
+type treeNode struct {
+	text     string
+	children []*treeNode
+}
+
+func (n *treeNode) add(format string, args ...interface{}) *treeNode {
+	child := &treeNode{text: fmt.Sprintf(format, args...)}
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *treeNode) write(w io.Writer, prefix string) {
+	for i, child := range n.children {
+		branch, indent := "├─ ", "│  "
+		if i == len(n.children)-1 {
+			branch, indent = "└─ ", "   "
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, child.text)
+		child.write(w, prefix+indent)
+	}
+}
+
+// WriteTree prints the transaction as a tree of its accounts and instructions
+func (d *DecodedTransaction) WriteTree(w io.Writer) {
+	signature := d.Signature
+	if signature == "" {
+		signature = "(unsigned)"
+	}
+	root := &treeNode{}
+	fmt.Fprintf(w, "Transaction %s\n", signature)
+	root.add("version: %s", d.Version)
+	if len(d.Accounts) > 0 {
+		root.add("fee payer: %s", strings.TrimPrefix(d.describe(0), "#0 "))
+	}
+	root.add("recent blockhash: %s", d.Blockhash)
+	if d.Status != "" {
+		root.add("status: %s", d.Status)
+	}
+	if d.Slot != 0 {
+		root.add("slot: %d", d.Slot)
+	}
+	if d.Fee != nil {
+		root.add("fee: %s SOL", FormatAmount(*d.Fee, NativeSOL.Decimals))
+	}
+	if d.UnitsConsumed != nil {
+		root.add("compute units: %d", *d.UnitsConsumed)
+	}
+
+	if len(d.LookupTables) > 0 {
+		tables := root.add("lookup tables (%d)", len(d.LookupTables))
+		for _, table := range d.LookupTables {
+			tables.add("%s: %d writable, %d readonly", table.Address, table.Writable, table.Readonly)
+		}
+	}
+
+	accounts := root.add("accounts (%d, %d writable)", len(d.Accounts), d.WritableAccounts())
+	for i := range d.Accounts {
+		accounts.add("%s", d.describe(i))
+	}
+
+	instructions := root.add("instructions (%d)", len(d.Instructions))
+	for i, inst := range d.Instructions {
+		node := instructions.add("#%d %s", i, inst.Title())
+		for _, arg := range inst.Args {
+			node.add("%s: %s", arg.Name, arg.Value)
+		}
+		if inst.Data != "" {
+			node.add("data: %s", inst.Data)
+		}
+		if len(inst.Invoked) > 0 {
+			node.add("invoked: %s", strings.Join(inst.Invoked, ", "))
+		}
+		if len(inst.Accounts) > 0 {
+			list := node.add("accounts")
+			for _, account := range inst.Accounts {
+				text := d.describe(account.Index)
+				if account.Role != "" {
+					text = account.Role + ": " + text
+				}
+				list.add("%s", text)
+			}
+		}
+	}
+	root.write(w, "")
+}
@@ -0,0 +1,285 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	computebudget "github.com/gagliardetto/solana-go/programs/compute-budget"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// lookupTableAccount encodes an active address lookup table holding addresses
+func lookupTableAccount(addresses ...solana.PublicKey) *rpc.Account {
+	data := make([]byte, 56) // metadata, without an authority
+	binary.LittleEndian.PutUint32(data[0:], 1)
+	binary.LittleEndian.PutUint64(data[4:], math.MaxUint64)
+	for _, address := range addresses {
+		data = append(data, address[:]...)
+	}
+	return &rpc.Account{
+		Owner: solana.MustPublicKeyFromBase58("AddressLookupTab1e1111111111111111111111111"),
+		Data:  rpc.DataBytesOrJSONFromBytes(data),
+	}
+}
+
+// depositLikeTransaction builds a v0 transaction shaped like a Lulo deposit:
+// compute budget, an idempotent ATA creation, a token transfer and a Lulo
+// instruction whose accounts come from a lookup table
+func depositLikeTransaction(t *testing.T, wallet solana.PublicKey, table solana.PublicKey, tableAddresses solana.PublicKeySlice) *solana.Transaction {
+	t.Helper()
+	usdc := solana.MustPublicKeyFromBase58(ResolveMint("USDC"))
+	walletATA, _, _ := solana.FindAssociatedTokenAddress(wallet, usdc)
+	vault := tableAddresses[0]
+
+	instructions := []solana.Instruction{
+		computebudget.NewSetComputeUnitLimitInstruction(400_000).Build(),
+		computebudget.NewSetComputeUnitPriceInstruction(1_000).Build(),
+		solana.NewInstruction(solana.SPLAssociatedTokenAccountProgramID, solana.AccountMetaSlice{
+			solana.Meta(wallet).WRITE().SIGNER(),
+			solana.Meta(walletATA).WRITE(),
+			solana.Meta(wallet),
+			solana.Meta(usdc),
+			solana.Meta(solana.SystemProgramID),
+			solana.Meta(solana.TokenProgramID),
+		}, []byte{1}),
+		token.NewTransferCheckedInstruction(100_000_000, 6, walletATA, usdc, vault, wallet, nil).Build(),
+		solana.NewInstruction(LuloProgramID, solana.AccountMetaSlice{
+			solana.Meta(wallet).WRITE().SIGNER(),
+			solana.Meta(vault).WRITE(),
+			solana.Meta(usdc),
+			solana.Meta(solana.TokenProgramID),
+		}, []byte{0xf2, 0x23, 0xc6, 0x89, 0x52, 0xe1, 0xf2, 0xb6, 0x01}), // Anchor "deposit"
+		system.NewTransferInstruction(5_000, wallet, tableAddresses[1]).Build(),
+	}
+	tx, err := solana.NewTransaction(instructions, solana.Hash{7}, solana.TransactionPayer(wallet),
+		solana.TransactionAddressTables(map[solana.PublicKey]solana.PublicKeySlice{table: tableAddresses}))
+	if err != nil {
+		t.Fatalf("NewTransaction: %v", err)
+	}
+	if len(tx.Message.AddressTableLookups) != 1 {
+		t.Fatalf("transaction uses %d lookup tables, want 1", len(tx.Message.AddressTableLookups))
+	}
+	return tx
+}
+
+func newLookupTable(t *testing.T, fake *FakeRPC) (solana.PublicKey, solana.PublicKeySlice) {
+	t.Helper()
+	table := solana.NewWallet().PublicKey()
+	addresses := solana.PublicKeySlice{solana.NewWallet().PublicKey(), solana.NewWallet().PublicKey()}
+	fake.SetAccount(table, lookupTableAccount(addresses...))
+	return table, addresses
+}
+
+func TestInspectTransaction(t *testing.T) {
+	fake := NewFakeRPC()
+	wallet := solana.NewWallet().PublicKey()
+	table, addresses := newLookupTable(t, fake)
+	tx := depositLikeTransaction(t, wallet, table, addresses)
+
+	decoded, err := InspectTransaction(context.Background(), fake, tx, wallet, false)
+	if err != nil {
+		t.Fatalf("InspectTransaction: %v", err)
+	}
+
+	if decoded.Version != "v0" || decoded.FeePayer != wallet.String() || decoded.Signature != "" {
+		t.Errorf("version %s, fee payer %s, signature %q; want an unsigned v0 transaction paid by the wallet",
+			decoded.Version, decoded.FeePayer, decoded.Signature)
+	}
+	if got := decoded.Accounts[0]; !got.Signer || !got.Writable || got.Label != "wallet" {
+		t.Errorf("fee payer account = %+v, want a writable signer labelled wallet", got)
+	}
+	if len(decoded.LookupTables) != 1 || decoded.LookupTables[0].Writable != 2 || decoded.LookupTables[0].Readonly != 0 {
+		t.Errorf("lookup tables = %+v, want one with two writable addresses", decoded.LookupTables)
+	}
+
+	// The vault and the transfer destination come from the table, in its order
+	var loaded []string
+	for _, account := range decoded.Accounts {
+		if account.LookupTable == "" {
+			continue
+		}
+		loaded = append(loaded, account.Address)
+		if !account.Writable || account.Signer || account.LookupTable != table.String() {
+			t.Errorf("loaded account = %+v, want a writable non-signer from the table", account)
+		}
+	}
+	if strings.Join(loaded, ",") != addresses[0].String()+","+addresses[1].String() {
+		t.Errorf("loaded %v, want %v", loaded, addresses)
+	}
+
+	want := "Compute Budget: SetComputeUnitLimit, Compute Budget: SetComputeUnitPrice, " +
+		"Associated Token: CreateIdempotent, SPL Token: TransferChecked, Lulo: Deposit, System: Transfer"
+	if got := decoded.Summary(); got != want {
+		t.Errorf("Summary() =\n  %s\nwant\n  %s", got, want)
+	}
+
+	transfer := decoded.Instructions[3]
+	if len(transfer.Args) != 1 || transfer.Args[0].Value != "100 USDC" {
+		t.Errorf("TransferChecked args = %+v, want 100 USDC", transfer.Args)
+	}
+	source := decoded.Accounts[transfer.Accounts[0].Index]
+	if transfer.Accounts[0].Role != "source" || source.Label != "wallet USDC account" {
+		t.Errorf("TransferChecked source = %s %+v, want the wallet's USDC account", transfer.Accounts[0].Role, source)
+	}
+	if got := decoded.Instructions[5].Args[0].Value; got != "0.000005 SOL" {
+		t.Errorf("System Transfer amount = %s, want 0.000005 SOL", got)
+	}
+	lulo := decoded.Instructions[4]
+	if lulo.Name != "Deposit" || lulo.Data != "" || len(lulo.Args) != 1 || lulo.Args[0].Value != "01" {
+		t.Errorf("Lulo instruction = %+v, want Deposit from its discriminator", lulo)
+	}
+	var roles []string
+	for _, account := range lulo.Accounts {
+		roles = append(roles, account.Role)
+	}
+	if strings.Join(roles, ",") != ",,mint,SPL Token program" {
+		t.Errorf("Lulo account roles = %q, want the mint and token program named", roles)
+	}
+
+	var out bytes.Buffer
+	decoded.WriteTree(&out)
+	for _, line := range []string{
+		"Transaction (unsigned)",
+		"├─ fee payer: " + wallet.String() + " [signer, writable] wallet",
+		"via lookup table " + shortAddress(table.String()),
+		"#3 SPL Token: TransferChecked",
+		"amount: 100 USDC",
+		"#4 Lulo: Deposit",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("tree does not contain %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestParseLuloInstruction(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "deposit", data: []byte{0xf2, 0x23, 0xc6, 0x89, 0x52, 0xe1, 0xf2, 0xb6}, want: "Deposit"},
+		{name: "withdraw protected", data: anchorDiscriminatorBytes("WithdrawProtected"), want: "WithdrawProtected"},
+		{name: "unknown discriminator", data: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "short data", data: []byte{0xf2, 0x23, 0xc6}},
+	}
+	for _, tt := range tests {
+		inst := DecodedInstruction{Accounts: []InstructionAccount{{Index: 0}}}
+		ok := parseLuloInstruction(&inst, []solana.PublicKey{{}}, tt.data)
+		if ok != (tt.want != "") || inst.Name != tt.want {
+			t.Errorf("%s: parsed = %v, name %q; want %q", tt.name, ok, inst.Name, tt.want)
+		}
+		if inst.Accounts[0].Role != "" {
+			t.Errorf("%s: unresolved account given role %q", tt.name, inst.Accounts[0].Role)
+		}
+	}
+
+	if got := anchorDiscriminator("DepositProtected"); hex.EncodeToString(got[:]) != sha256Prefix("global:deposit_protected") {
+		t.Errorf("discriminator of DepositProtected = %x", got)
+	}
+}
+
+// anchorDiscriminatorBytes returns the discriminator of an instruction as data
+func anchorDiscriminatorBytes(name string) []byte {
+	discriminator := anchorDiscriminator(name)
+	return discriminator[:]
+}
+
+// sha256Prefix returns the first 8 bytes of the hash of s in hex
+func sha256Prefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+func TestDecodeTransactionUnresolvedLookups(t *testing.T) {
+	fake := NewFakeRPC()
+	wallet := solana.NewWallet().PublicKey()
+	table, addresses := newLookupTable(t, fake)
+	tx := depositLikeTransaction(t, wallet, table, addresses)
+
+	decoded := DecodeTransaction(tx, nil, wallet)
+	for _, account := range decoded.Accounts {
+		if account.LookupTable != "" && account.Address != "" {
+			t.Errorf("account %+v was resolved without its lookup table", account)
+		}
+	}
+	if got := len(decoded.Instructions); got != 6 {
+		t.Errorf("decoded %d instructions, want 6", got)
+	}
+}
+
+func TestApplyLogs(t *testing.T) {
+	wallet := solana.NewWallet().PublicKey()
+	table, addresses := newLookupTable(t, NewFakeRPC())
+	decoded := DecodeTransaction(depositLikeTransaction(t, wallet, table, addresses), nil, wallet)
+	// As for a Lulo instruction whose discriminator is not known
+	decoded.Instructions[4].Name = ""
+
+	kamino := "KLend2g3cP87fffoy8q1mQqGKjrxjC8boSyAYavgmjD"
+	decoded.ApplyLogs([]string{
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program ComputeBudget111111111111111111111111111111 success",
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program ComputeBudget111111111111111111111111111111 success",
+		"Program ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL invoke [1]",
+		"Program ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL success",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA invoke [1]",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA success",
+		"Program " + LuloProgramID.String() + " invoke [1]",
+		"Program log: Instruction: DepositProtected",
+		"Program " + kamino + " invoke [2]",
+		"Program log: Instruction: DepositReserveLiquidity",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA invoke [3]",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA success",
+		"Program " + kamino + " success",
+		"Program " + LuloProgramID.String() + " success",
+		"Program 11111111111111111111111111111111 invoke [1]",
+		"Program 11111111111111111111111111111111 success",
+	})
+
+	lulo := decoded.Instructions[4]
+	if lulo.Name != "DepositProtected" {
+		t.Errorf("Lulo instruction named %q, want DepositProtected from the logs", lulo.Name)
+	}
+	if strings.Join(lulo.Invoked, ",") != "Kamino,SPL Token" {
+		t.Errorf("Lulo instruction invoked %v, want Kamino and SPL Token", lulo.Invoked)
+	}
+	// Names decoded from the data are kept
+	decoded.ApplyLogs([]string{
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program log: Instruction: Other",
+		"Program ComputeBudget111111111111111111111111111111 success",
+	})
+	if decoded.Instructions[0].Name != "SetComputeUnitLimit" {
+		t.Errorf("Compute Budget instruction renamed %q from the logs", decoded.Instructions[0].Name)
+	}
+	if decoded.Instructions[5].Name != "Transfer" || len(decoded.Instructions[5].Invoked) != 0 {
+		t.Errorf("System instruction = %+v, want it unchanged", decoded.Instructions[5])
+	}
+}
+
+func TestHandleB64TransactionsResolvesLookupTables(t *testing.T) {
+	client, fake := newFakeClient(t)
+	table, addresses := newLookupTable(t, fake)
+	tx := depositLikeTransaction(t, client.WalletPubKey(), table, addresses)
+	b64_tx, err := tx.ToBase64()
+	if err != nil {
+		t.Fatalf("ToBase64: %v", err)
+	}
+
+	if _, err := client.HandleB64Transactions(context.Background(), []string{b64_tx}); err != nil {
+		t.Fatalf("HandleB64Transactions: %v", err)
+	}
+	if got := fake.Calls("getAccountInfo"); got != 1 {
+		t.Errorf("fetched %d accounts for the pre-sign summary, want the lookup table", got)
+	}
+}
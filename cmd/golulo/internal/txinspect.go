@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// ParseB64Transaction decodes a base64 encoded transaction, as returned by
+// the Lulo API
+func ParseB64Transaction(b64_tx string) (*solana.Transaction, error) {
+	txBytes, err := base64.StdEncoding.DecodeString(b64_tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
+	}
+	tx, err := solana.TransactionFromDecoder(bin.NewBinDecoder(txBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// InspectTransaction decodes a transaction, resolving its address lookup
+// tables over RPC. With simulate set it is also simulated against the current
+// chain state, which names the Lulo instructions from the program logs.
+func InspectTransaction(ctx context.Context, client RPC, tx *solana.Transaction, wallet solana.PublicKey, simulate bool) (*DecodedTransaction, error) {
+	var loaded *rpc.LoadedAddresses
+	if len(tx.Message.AddressTableLookups) > 0 {
+		var err error
+		if loaded, err = ResolveLookupTables(ctx, client, tx); err != nil {
+			return nil, err
+		}
+	}
+	decoded := DecodeTransaction(tx, loaded, wallet)
+	if !simulate {
+		return decoded, nil
+	}
+
+	// The transaction may be unsigned or its blockhash expired, neither of
+	// which matters to what it would do
+	out, err := client.SimulateTransactionWithOpts(ctx, tx, &rpc.SimulateTransactionOpts{
+		Commitment:             rpc.CommitmentConfirmed,
+		ReplaceRecentBlockhash: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to simulate transaction: %w", err)
+	}
+	if out.Value == nil {
+		return nil, fmt.Errorf("failed to simulate transaction: empty result")
+	}
+	decoded.Slot = out.Context.Slot
+	decoded.Status = transactionStatus(out.Value.Err)
+	decoded.UnitsConsumed = out.Value.UnitsConsumed
+	decoded.ApplyLogs(out.Value.Logs)
+	return decoded, nil
+}
+
+// InspectSignature fetches a transaction from the chain and decodes it with
+// its outcome
+func InspectSignature(ctx context.Context, client RPC, sig solana.Signature, wallet solana.PublicKey) (*DecodedTransaction, error) {
+	maxVersion := uint64(0)
+	out, err := client.GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &maxVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", sig, err)
+	}
+	if out.Transaction == nil {
+		return nil, fmt.Errorf("transaction %s not found", sig)
+	}
+	tx, err := out.Transaction.GetTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transaction %s: %w", sig, err)
+	}
+
+	// The node reports the addresses the lookup tables held when the
+	// transaction ran, which stay valid after a table is closed
+	var loaded *rpc.LoadedAddresses
+	if out.Meta != nil && len(out.Meta.LoadedAddresses.Writable)+len(out.Meta.LoadedAddresses.ReadOnly) > 0 {
+		loaded = &out.Meta.LoadedAddresses
+	} else if len(tx.Message.AddressTableLookups) > 0 {
+		if loaded, err = ResolveLookupTables(ctx, client, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	decoded := DecodeTransaction(tx, loaded, wallet)
+	decoded.Slot = out.Slot
+	if out.Meta != nil {
+		decoded.Status = transactionStatus(out.Meta.Err)
+		decoded.Fee = &out.Meta.Fee
+		decoded.UnitsConsumed = out.Meta.ComputeUnitsConsumed
+		decoded.ApplyLogs(out.Meta.LogMessages)
+	}
+	return decoded, nil
+}
+
+// transactionStatus describes a transaction error, or its success
+func transactionStatus(txErr interface{}) string {
+	if txErr == nil {
+		return "success"
+	}
+	return fmt.Sprintf("failed: %v", txErr)
+}
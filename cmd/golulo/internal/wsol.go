@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/system"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+// createIdempotentDiscriminator selects the ATA program's CreateIdempotent instruction
+const createIdempotentDiscriminator = 1
+
+// WrappedSOLAccount returns the wallet's associated wSOL token account
+func (c *SolanaClient) WrappedSOLAccount() (solana.PublicKey, error) {
+	ata, _, err := solana.FindAssociatedTokenAddress(c.PublicKey, solana.SolMint)
+	if err != nil {
+		return solana.PublicKey{}, fmt.Errorf("failed to derive wSOL account: %w", err)
+	}
+	return ata, nil
+}
+
+// GetWrappedSOLBalance returns the lamports held in the wallet's wSOL account,
+// and whether the account exists
+func (c *SolanaClient) GetWrappedSOLBalance(ctx context.Context) (uint64, bool, error) {
+	ata, err := c.WrappedSOLAccount()
+	if err != nil {
+		return 0, false, err
+	}
+
+	out, err := c.RpcClient.GetAccountInfoWithOpts(ctx, ata, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+	if errors.Is(err, rpc.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get wSOL account: %w", err)
+	}
+
+	var account token.Account
+	if err := bin.NewBinDecoder(out.GetBinary()).Decode(&account); err != nil {
+		return 0, false, fmt.Errorf("failed to decode wSOL account: %w", err)
+	}
+	return account.Amount, true, nil
+}
+
+// WrapSOLInstructions returns the instructions that move lamports into the
+// wallet's wSOL account, creating it if needed
+func (c *SolanaClient) WrapSOLInstructions(lamports uint64) ([]solana.Instruction, error) {
+	ata, err := c.WrappedSOLAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	createATA := solana.NewInstruction(
+		solana.SPLAssociatedTokenAccountProgramID,
+		solana.AccountMetaSlice{
+			solana.Meta(c.PublicKey).SIGNER().WRITE(),
+			solana.Meta(ata).WRITE(),
+			solana.Meta(c.PublicKey),
+			solana.Meta(solana.SolMint),
+			solana.Meta(solana.SystemProgramID),
+			solana.Meta(solana.TokenProgramID),
+		},
+		[]byte{createIdempotentDiscriminator},
+	)
+
+	return []solana.Instruction{
+		createATA,
+		system.NewTransferInstruction(lamports, c.PublicKey, ata).Build(),
+		token.NewSyncNativeInstruction(ata).Build(),
+	}, nil
+}
+
+// UnwrapSOLInstructions returns the instructions that close the wallet's wSOL
+// account, returning all wrapped lamports and rent to the wallet
+func (c *SolanaClient) UnwrapSOLInstructions() ([]solana.Instruction, error) {
+	ata, err := c.WrappedSOLAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	return []solana.Instruction{
+		token.NewCloseAccountInstruction(ata, c.PublicKey, c.PublicKey, nil).Build(),
+	}, nil
+}
+
+// PartialUnwrapSOLInstructions returns the instructions that unwrap lamports
+// out of the wallet's wSOL account and leave the rest wrapped. The lamports
+// move to a new token account at temp, which is closed into the wallet in the
+// same transaction, so temp must sign it.
+func (c *SolanaClient) PartialUnwrapSOLInstructions(lamports, rent uint64, temp solana.PublicKey) ([]solana.Instruction, error) {
+	ata, err := c.WrappedSOLAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	return []solana.Instruction{
+		system.NewCreateAccountInstruction(rent, tokenAccountSize, solana.TokenProgramID, c.PublicKey, temp).Build(),
+		token.NewInitializeAccount3Instruction(c.PublicKey, temp, solana.SolMint).Build(),
+		token.NewTransferInstruction(lamports, ata, temp, c.PublicKey, nil).Build(),
+		token.NewCloseAccountInstruction(temp, c.PublicKey, c.PublicKey, nil).Build(),
+	}, nil
+}
+
+// WrapSOL wraps lamports into the wallet's wSOL account and waits for confirmation
+func (c *SolanaClient) WrapSOL(ctx context.Context, lamports uint64) (solana.Signature, error) {
+	instructions, err := c.WrapSOLInstructions(lamports)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+
+	sig, err := c.CreateSignAndSendTransaction(ctx, instructions)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to wrap SOL: %w", err)
+	}
+
+	c.log().WithFields(logrus.Fields{
+		"lamports":  lamports,
+		"signature": sig.String(),
+	}).Info("Wrap SOL transaction sent")
+
+	if err := c.ConfirmTransaction(ctx, sig, DefaultConfirmTimeout); err != nil {
+		return sig, err
+	}
+	return sig, nil
+}
+
+// UnwrapSOL unwraps lamports from the wallet's wSOL account and waits for
+// confirmation. Unwrapping the whole balance closes the account; less leaves
+// the rest wrapped, so wSOL held for other uses is not touched.
+func (c *SolanaClient) UnwrapSOL(ctx context.Context, lamports uint64) (solana.Signature, error) {
+	wrapped, exists, err := c.GetWrappedSOLBalance(ctx)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	if !exists || lamports > wrapped {
+		return solana.Signature{}, fmt.Errorf("wSOL account holds %s SOL, cannot unwrap %s",
+			FormatAmount(wrapped, NativeSOL.Decimals), FormatAmount(lamports, NativeSOL.Decimals))
+	}
+	if lamports == wrapped {
+		return c.UnwrapAllSOL(ctx)
+	}
+
+	rent, err := c.RpcClient.GetMinimumBalanceForRentExemption(ctx, tokenAccountSize, rpc.CommitmentConfirmed)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to get rent exemption: %w", err)
+	}
+	temp, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to create temporary account key: %w", err)
+	}
+	instructions, err := c.PartialUnwrapSOLInstructions(lamports, rent, temp.PublicKey())
+	if err != nil {
+		return solana.Signature{}, err
+	}
+
+	tx, err := c.CreateTransaction(ctx, instructions)
+	if err != nil {
+		return solana.Signature{}, err
+	}
+	if _, err := tx.PartialSign(func(key solana.PublicKey) *solana.PrivateKey {
+		if key.Equals(temp.PublicKey()) {
+			return &temp
+		}
+		return nil
+	}); err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to sign with temporary account: %w", err)
+	}
+	if _, err := c.SignTransaction(tx); err != nil {
+		return solana.Signature{}, err
+	}
+	sig, err := c.SendTransaction(ctx, tx)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to unwrap SOL: %w", err)
+	}
+
+	c.log().WithFields(logrus.Fields{
+		"lamports":  lamports,
+		"signature": sig.String(),
+	}).Info("Unwrap SOL transaction sent")
+
+	if err := c.ConfirmTransaction(ctx, sig, DefaultConfirmTimeout); err != nil {
+		return sig, err
+	}
+	return sig, nil
+}
+
+// UnwrapAllSOL closes the wallet's wSOL account and waits for confirmation
+func (c *SolanaClient) UnwrapAllSOL(ctx context.Context) (solana.Signature, error) {
+	instructions, err := c.UnwrapSOLInstructions()
+	if err != nil {
+		return solana.Signature{}, err
+	}
+
+	sig, err := c.CreateSignAndSendTransaction(ctx, instructions)
+	if err != nil {
+		return solana.Signature{}, fmt.Errorf("failed to unwrap SOL: %w", err)
+	}
+
+	c.log().WithField("signature", sig.String()).Info("Unwrap SOL transaction sent")
+
+	if err := c.ConfirmTransaction(ctx, sig, DefaultConfirmTimeout); err != nil {
+		return sig, err
+	}
+	return sig, nil
+}
+
+// EnsureWrappedSOL tops up the wallet's wSOL account so it holds at least
+// lamports, returning how many it wrapped
+func (c *SolanaClient) EnsureWrappedSOL(ctx context.Context, lamports uint64) (uint64, error) {
+	wrapped, _, err := c.GetWrappedSOLBalance(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if wrapped >= lamports {
+		c.log().WithField("wrapped", wrapped).Debug("wSOL account already funded")
+		return 0, nil
+	}
+
+	if _, err := c.WrapSOL(ctx, lamports-wrapped); err != nil {
+		return 0, err
+	}
+	return lamports - wrapped, nil
+}
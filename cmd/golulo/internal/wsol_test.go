@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/programs/token"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// setWrappedSOL gives the client's wallet a wSOL account holding lamports
+func setWrappedSOL(t *testing.T, client *SolanaClient, fake *FakeRPC, lamports uint64) {
+	t.Helper()
+	ata, err := client.WrappedSOLAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	account := token.Account{Mint: solana.SolMint, Owner: client.WalletPubKey(), Amount: lamports, State: token.Initialized}
+	if err := bin.NewBinEncoder(&buf).Encode(account); err != nil {
+		t.Fatalf("encode token account: %v", err)
+	}
+	fake.SetAccount(ata, &rpc.Account{Owner: solana.TokenProgramID, Data: rpc.DataBytesOrJSONFromBytes(buf.Bytes())})
+}
+
+func TestUnwrapSOLLeavesOtherWSOL(t *testing.T) {
+	client, fake := newFakeClient(t)
+	setWrappedSOL(t, client, fake, 5_000_000_000)
+
+	if _, err := client.UnwrapSOL(context.Background(), 2_000_000_000); err != nil {
+		t.Fatalf("UnwrapSOL: %v", err)
+	}
+	sent := fake.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d transactions, want 1", len(sent))
+	}
+	tx := sent[0]
+	if err := tx.VerifySignatures(); err != nil || len(tx.Signatures) != 2 {
+		t.Fatalf("transaction has %d signatures (%v), want the wallet's and the temporary account's", len(tx.Signatures), err)
+	}
+
+	decoded := DecodeTransaction(tx, nil, client.WalletPubKey())
+	want := "System: CreateAccount, SPL Token: InitializeAccount3, SPL Token: Transfer, SPL Token: CloseAccount"
+	if got := decoded.Summary(); got != want {
+		t.Errorf("Summary() = %s, want %s", got, want)
+	}
+	if got := decoded.Instructions[2].Args[0].Value; got != "2000000000 base units" {
+		t.Errorf("transferred %s, want 2000000000 base units", got)
+	}
+	ata, _ := client.WrappedSOLAccount()
+	if closed := decoded.Accounts[decoded.Instructions[3].Accounts[0].Index]; closed.Address == ata.String() {
+		t.Errorf("closed the wallet's wSOL account instead of the temporary one")
+	}
+}
+
+func TestUnwrapSOLWholeBalanceClosesAccount(t *testing.T) {
+	client, fake := newFakeClient(t)
+	setWrappedSOL(t, client, fake, 5_000_000_000)
+
+	if _, err := client.UnwrapSOL(context.Background(), 6_000_000_000); err == nil {
+		t.Fatal("UnwrapSOL of more than the wSOL balance succeeded")
+	}
+	if _, err := client.UnwrapSOL(context.Background(), 5_000_000_000); err != nil {
+		t.Fatalf("UnwrapSOL: %v", err)
+	}
+	sent := fake.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d transactions, want 1", len(sent))
+	}
+	if got := DecodeTransaction(sent[0], nil, client.WalletPubKey()).Summary(); got != "SPL Token: CloseAccount" {
+		t.Errorf("Summary() = %s, want the wSOL account closed", got)
+	}
+}